@@ -0,0 +1,254 @@
+package apu
+
+import (
+	"github.com/dqn/gones/region"
+)
+
+// https://wiki.nesdev.com/w/index.php/APU
+
+// アドレス	       用途
+// 0x4000～0x4003	矩形波 1
+// 0x4004～0x4007	矩形波 2
+// 0x4008～0x400B	三角波
+// 0x400C～0x400F	ノイズ
+// 0x4010～0x4013	DMC
+// 0x4015	      チャンネルの有効化、ステータス
+// 0x4017	      フレームカウンタ
+
+// FrameCounter clocks the envelopes, length counters and sweeps, and
+// raises the frame IRQ in the 4-step mode.
+// https://wiki.nesdev.com/w/index.php/APU_Frame_Counter
+type FrameCounter struct {
+	FiveStep   bool
+	IRQInhibit bool
+	Cycle      uint16
+	Step       uint8
+	IRQ        bool
+}
+
+type APU struct {
+	region       *region.Region
+	pulse1       Pulse
+	pulse2       Pulse
+	triangle     Triangle
+	noise        Noise
+	dmc          DMC
+	frameCounter FrameCounter
+	odd          bool
+
+	read     func(addr uint16) uint8
+	frameIRQ func(asserted bool)
+	dmcIRQ   func(asserted bool)
+	// IRQ lines as last reported
+	frameLine bool
+	dmcLine   bool
+
+	expansions []Expansion
+}
+
+func New(r *region.Region) *APU {
+	a := &APU{region: r}
+	a.pulse1.OnesComplement = true
+	a.noise.Shift = 1
+	a.noise.Period = r.NoisePeriods[0]
+	a.dmc.Rate = r.DMCRates[0]
+	return a
+}
+
+// SetMemory sets the function the DMC reads samples with. It must not
+// have side effects.
+func (a *APU) SetMemory(read func(addr uint16) uint8) {
+	a.read = read
+}
+
+// SetIRQ sets the functions called when the frame counter and DMC IRQ
+// lines change.
+func (a *APU) SetIRQ(frameCounter, dmc func(asserted bool)) {
+	a.frameIRQ, a.dmcIRQ = frameCounter, dmc
+}
+
+func (a *APU) WriteRegister(addr uint16, data uint8) {
+	switch {
+	case addr < 0x4004:
+		a.pulse1.write(addr-0x4000, data)
+	case addr < 0x4008:
+		a.pulse2.write(addr-0x4004, data)
+	case addr < 0x400C:
+		a.triangle.write(addr-0x4008, data)
+	case addr == 0x400C:
+		a.noise.Length.Halt = data&0x20 != 0
+		a.noise.Envelope.write(data)
+	case addr == 0x400E:
+		a.noise.Mode = data&0x80 != 0
+		a.noise.Period = a.region.NoisePeriods[data&0x0F]
+	case addr == 0x400F:
+		a.noise.Length.load(data >> 3)
+		a.noise.Envelope.Start = true
+	case addr == 0x4010:
+		a.dmc.IRQEnabled = data&0x80 != 0
+		a.dmc.Loop = data&0x40 != 0
+		a.dmc.Rate = a.region.DMCRates[data&0x0F]
+		if !a.dmc.IRQEnabled {
+			a.dmc.IRQ = false
+		}
+	case addr == 0x4011:
+		a.dmc.Level = data & 0x7F
+	case addr == 0x4012:
+		a.dmc.SampleAddress = 0xC000 + uint16(data)*64
+	case addr == 0x4013:
+		a.dmc.SampleLength = uint16(data)*16 + 1
+	case addr == 0x4015:
+		a.pulse1.Length.setEnabled(data&0x01 != 0)
+		a.pulse2.Length.setEnabled(data&0x02 != 0)
+		a.triangle.Length.setEnabled(data&0x04 != 0)
+		a.noise.Length.setEnabled(data&0x08 != 0)
+		if data&0x10 == 0 {
+			a.dmc.Remaining = 0
+		} else if a.dmc.Remaining == 0 {
+			a.dmc.restart()
+		}
+		a.dmc.IRQ = false
+	case addr == 0x4017:
+		f := &a.frameCounter
+		f.FiveStep = data&0x80 != 0
+		f.IRQInhibit = data&0x40 != 0
+		if f.IRQInhibit {
+			f.IRQ = false
+		}
+		f.Cycle, f.Step = 0, 0
+		if f.FiveStep {
+			a.quarterFrame()
+			a.halfFrame()
+		}
+	}
+	a.updateIRQ()
+}
+
+// ReadStatus reads $4015 and acknowledges the frame IRQ.
+func (a *APU) ReadStatus() uint8 {
+	v := a.PeekStatus()
+	a.frameCounter.IRQ = false
+	a.updateIRQ()
+	return v
+}
+
+// PeekStatus returns what ReadStatus would without side effects.
+func (a *APU) PeekStatus() uint8 {
+	var v uint8
+	v |= boolBit(a.pulse1.Length.Value > 0) << 0
+	v |= boolBit(a.pulse2.Length.Value > 0) << 1
+	v |= boolBit(a.triangle.Length.Value > 0) << 2
+	v |= boolBit(a.noise.Length.Value > 0) << 3
+	v |= boolBit(a.dmc.Remaining > 0) << 4
+	v |= boolBit(a.frameCounter.IRQ) << 6
+	v |= boolBit(a.dmc.IRQ) << 7
+	return v
+}
+
+func boolBit(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (a *APU) quarterFrame() {
+	a.pulse1.Envelope.clock()
+	a.pulse2.Envelope.clock()
+	a.noise.Envelope.clock()
+	a.triangle.clockLinear()
+}
+
+func (a *APU) halfFrame() {
+	a.pulse1.Length.clock()
+	a.pulse2.Length.clock()
+	a.triangle.Length.clock()
+	a.noise.Length.clock()
+	a.pulse1.clockSweep()
+	a.pulse2.clockSweep()
+}
+
+func (a *APU) clockFrameCounter() {
+	f := &a.frameCounter
+	f.Cycle++
+	if f.Cycle < a.region.FrameCounterPeriod {
+		return
+	}
+	f.Cycle = 0
+	f.Step++
+
+	switch {
+	case f.Step == 1 || f.Step == 3:
+		a.quarterFrame()
+	case f.Step == 2:
+		a.quarterFrame()
+		a.halfFrame()
+	case f.Step == 4 && !f.FiveStep:
+		a.quarterFrame()
+		a.halfFrame()
+		if !f.IRQInhibit {
+			f.IRQ = true
+		}
+		f.Step = 0
+	case f.Step == 5:
+		a.quarterFrame()
+		a.halfFrame()
+		f.Step = 0
+	}
+}
+
+// Step advances the APU by a CPU cycle.
+func (a *APU) Step() {
+	a.odd = !a.odd
+	if a.odd {
+		a.pulse1.clockTimer()
+		a.pulse2.clockTimer()
+	}
+	a.triangle.clockTimer()
+	a.noise.clockTimer()
+	a.dmc.clockTimer(a.read)
+	for _, e := range a.expansions {
+		e.Step()
+	}
+	a.clockFrameCounter()
+	a.updateIRQ()
+}
+
+func (a *APU) updateIRQ() {
+	if a.frameCounter.IRQ != a.frameLine {
+		a.frameLine = a.frameCounter.IRQ
+		if a.frameIRQ != nil {
+			a.frameIRQ(a.frameLine)
+		}
+	}
+	if a.dmc.IRQ != a.dmcLine {
+		a.dmcLine = a.dmc.IRQ
+		if a.dmcIRQ != nil {
+			a.dmcIRQ(a.dmcLine)
+		}
+	}
+}
+
+// Output returns the mixed output of the channels and of the expansion
+// chips. The APU alone goes from 0 to about 1.
+func (a *APU) Output() float32 {
+	out := pulseTable[a.pulse1.output()+a.pulse2.output()] +
+		tndTable[3*int(a.triangle.output())+2*int(a.noise.output())+int(a.dmc.output())]
+	for _, e := range a.expansions {
+		out += e.Output()
+	}
+	return out
+}
+
+// Channels names the channels in the order of ChannelOutputs.
+var Channels = []string{"pulse1", "pulse2", "triangle", "noise", "dmc"}
+
+// ChannelOutputs writes the output of each channel, as if it played
+// alone, to out, which must have room for len(Channels) values.
+func (a *APU) ChannelOutputs(out []float32) {
+	out[0] = pulseTable[a.pulse1.output()]
+	out[1] = pulseTable[a.pulse2.output()]
+	out[2] = tndTable[3*int(a.triangle.output())]
+	out[3] = tndTable[2*int(a.noise.output())]
+	out[4] = tndTable[a.dmc.output()]
+}
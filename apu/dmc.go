@@ -0,0 +1,87 @@
+package apu
+
+// DMC plays 1-bit delta encoded samples read from CPU memory. Rate is in
+// CPU cycles and comes from the region's table.
+// https://wiki.nesdev.com/w/index.php/APU_DMC
+type DMC struct {
+	IRQEnabled bool
+	Loop       bool
+	Rate       uint16
+	Timer      uint16
+	Level      uint8
+
+	SampleAddress uint16
+	SampleLength  uint16
+	Address       uint16
+	Remaining     uint16
+	Buffer        uint8
+	BufferFull    bool
+
+	Shift   uint8
+	Bits    uint8
+	Silence bool
+	IRQ     bool
+}
+
+func (d *DMC) restart() {
+	d.Address = d.SampleAddress
+	d.Remaining = d.SampleLength
+}
+
+// fill reads the next sample byte once the buffer has been emptied.
+func (d *DMC) fill(read func(addr uint16) uint8) {
+	if d.BufferFull || d.Remaining == 0 {
+		return
+	}
+	d.Buffer = read(d.Address)
+	d.BufferFull = true
+	d.Address++
+	if d.Address == 0 {
+		d.Address = 0x8000
+	}
+	d.Remaining--
+	if d.Remaining > 0 {
+		return
+	}
+	if d.Loop {
+		d.restart()
+	} else if d.IRQEnabled {
+		d.IRQ = true
+	}
+}
+
+// clockTimer is called every CPU cycle.
+func (d *DMC) clockTimer(read func(addr uint16) uint8) {
+	if read != nil {
+		d.fill(read)
+	}
+	if d.Timer > 0 {
+		d.Timer--
+		return
+	}
+	d.Timer = d.Rate - 1
+
+	if d.Bits == 0 {
+		d.Bits = 8
+		d.Silence = !d.BufferFull
+		if d.BufferFull {
+			d.Shift = d.Buffer
+			d.BufferFull = false
+		}
+	}
+	if !d.Silence {
+		if d.Shift&1 == 1 {
+			if d.Level <= 125 {
+				d.Level += 2
+			}
+		} else if d.Level >= 2 {
+			d.Level -= 2
+		}
+	}
+	d.Shift >>= 1
+	d.Bits--
+}
+
+func (d *DMC) output() uint8 {
+	return d.Level
+}
@@ -0,0 +1,79 @@
+package apu
+
+// https://wiki.nesdev.com/w/index.php/APU_Length_Counter
+var lengthTable = [32]uint8{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+// Envelope is the volume unit of the pulse and noise channels. Period is
+// also the volume when Constant is set.
+// https://wiki.nesdev.com/w/index.php/APU_Envelope
+type Envelope struct {
+	Start    bool
+	Loop     bool
+	Constant bool
+	Period   uint8
+	Divider  uint8
+	Decay    uint8
+}
+
+func (e *Envelope) write(data uint8) {
+	e.Loop = data&0x20 != 0
+	e.Constant = data&0x10 != 0
+	e.Period = data & 0x0F
+}
+
+// clock is called on every quarter frame.
+func (e *Envelope) clock() {
+	if e.Start {
+		e.Start = false
+		e.Decay = 15
+		e.Divider = e.Period
+		return
+	}
+	if e.Divider > 0 {
+		e.Divider--
+		return
+	}
+	e.Divider = e.Period
+	if e.Decay > 0 {
+		e.Decay--
+	} else if e.Loop {
+		e.Decay = 15
+	}
+}
+
+func (e *Envelope) volume() uint8 {
+	if e.Constant {
+		return e.Period
+	}
+	return e.Decay
+}
+
+// LengthCounter silences a channel once it counts down to 0.
+type LengthCounter struct {
+	Enabled bool
+	Halt    bool
+	Value   uint8
+}
+
+func (l *LengthCounter) load(index uint8) {
+	if l.Enabled {
+		l.Value = lengthTable[index&0x1F]
+	}
+}
+
+func (l *LengthCounter) setEnabled(enabled bool) {
+	l.Enabled = enabled
+	if !enabled {
+		l.Value = 0
+	}
+}
+
+// clock is called on every half frame.
+func (l *LengthCounter) clock() {
+	if !l.Halt && l.Value > 0 {
+		l.Value--
+	}
+}
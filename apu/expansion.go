@@ -0,0 +1,34 @@
+package apu
+
+// Expansion is a sound chip on the cartridge whose output is mixed with
+// the APU's. Registers are at their addresses in the NSF memory map;
+// mappers that decode them differently translate the addresses.
+// https://wiki.nesdev.com/w/index.php/Expansion_audio
+type Expansion interface {
+	WriteRegister(addr uint16, data uint8)
+	// ReadRegister reports false for addresses the chip does not answer.
+	ReadRegister(addr uint16) (uint8, bool)
+	// Step advances the chip by a CPU cycle.
+	Step()
+	// Output is in the scale of APU.Output.
+	Output() float32
+}
+
+// squareLevel is the output of a 2A03 pulse channel alone at full volume.
+// The chips are mixed linearly, scaled to the peak level of one of their
+// channels at full volume relative to it, roughly as measured on hardware.
+const (
+	squareLevel = 95.52 / (8128.0/15 + 100)
+
+	vrc6Level    = 1.0
+	vrc7Level    = 1.25
+	fdsLevel     = 2.4
+	mmc5Level    = 1.0
+	n163Level    = 1.5
+	sunsoftLevel = 1.3
+)
+
+// AddExpansion mixes the chip with the APU and steps it with it.
+func (a *APU) AddExpansion(e Expansion) {
+	a.expansions = append(a.expansions, e)
+}
@@ -0,0 +1,226 @@
+package apu
+
+import "math"
+
+// https://wiki.nesdev.com/w/index.php/FDS_audio
+
+// アドレス	       用途
+// 0x4040～0x407F	波形テーブル
+// 0x4080	      音量エンベロープ
+// 0x4082～0x4083	周波数
+// 0x4084	      モジュレータのエンベロープ
+// 0x4085	      モジュレータのカウンタ
+// 0x4086～0x4087	モジュレータの周波数
+// 0x4088	      モジュレータのテーブル
+// 0x4089	      マスターボリューム、波形の書き込み許可
+// 0x408A	      エンベロープの速度
+// 0x4090, 0x4092	エンベロープのゲイン (読み込み)
+
+// fdsCutoff is the cutoff frequency of the low-pass filter on the output.
+const fdsCutoff = 2000
+
+var (
+	fdsModSteps     = [8]int8{0, 1, 2, 4, 0, -4, -2, -1}
+	fdsMasterVolume = [4]float32{2.0 / 2, 2.0 / 3, 2.0 / 4, 2.0 / 5}
+)
+
+// FDSEnvelope is the volume or the modulator envelope. Gain goes from 0
+// to 32 (and up to 63 if written directly).
+type FDSEnvelope struct {
+	Disabled bool
+	Increase bool
+	Speed    uint8
+	Gain     uint8
+	Timer    uint32
+}
+
+func (e *FDSEnvelope) write(data uint8) {
+	e.Disabled = data&0x80 != 0
+	e.Increase = data&0x40 != 0
+	e.Speed = data & 0x3F
+	e.Timer = 0
+	if e.Disabled {
+		e.Gain = e.Speed
+	}
+}
+
+func (e *FDSEnvelope) clock(masterSpeed uint8) {
+	if e.Disabled {
+		return
+	}
+	e.Timer++
+	if e.Timer < 8*(uint32(masterSpeed)+1)*(uint32(e.Speed)+1) {
+		return
+	}
+	e.Timer = 0
+	if e.Increase && e.Gain < 32 {
+		e.Gain++
+	} else if !e.Increase && e.Gain > 0 {
+		e.Gain--
+	}
+}
+
+// FDS is the wavetable channel of the Famicom Disk System: a 64-step wave
+// whose pitch is bent by a modulator stepping through a table of deltas.
+type FDS struct {
+	Wave      [64]uint8
+	WaveWrite bool
+	WaveHalt  bool
+	Frequency uint16
+	WavePhase uint32
+	Volume    FDSEnvelope
+
+	ModTable     [64]uint8
+	ModPosition  uint8
+	ModHalt      bool
+	ModFrequency uint16
+	ModPhase     uint32
+	// ModCounter is a 7-bit signed value.
+	ModCounter int8
+	Mod        FDSEnvelope
+
+	EnvelopeHalt bool
+	MasterSpeed  uint8
+	MasterVolume uint8
+	Sample       float32
+	Filtered     float32
+	filter       float32
+}
+
+func NewFDS(cpuClock float64) *FDS {
+	return &FDS{
+		MasterSpeed: 0xE8,
+		filter:      float32(1 - math.Exp(-2*math.Pi*fdsCutoff/cpuClock)),
+	}
+}
+
+func (f *FDS) WriteRegister(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x4040 && addr < 0x4080:
+		if f.WaveWrite {
+			f.Wave[addr-0x4040] = data & 0x3F
+		}
+	case addr == 0x4080:
+		f.Volume.write(data)
+	case addr == 0x4082:
+		f.Frequency = f.Frequency&0x0F00 | uint16(data)
+	case addr == 0x4083:
+		f.Frequency = f.Frequency&0x00FF | uint16(data&0x0F)<<8
+		f.WaveHalt = data&0x80 != 0
+		f.EnvelopeHalt = data&0x40 != 0
+		if f.WaveHalt {
+			f.WavePhase = 0
+		}
+	case addr == 0x4084:
+		f.Mod.write(data)
+	case addr == 0x4085:
+		f.ModCounter = int8(data<<1) >> 1
+	case addr == 0x4086:
+		f.ModFrequency = f.ModFrequency&0x0F00 | uint16(data)
+	case addr == 0x4087:
+		f.ModFrequency = f.ModFrequency&0x00FF | uint16(data&0x0F)<<8
+		f.ModHalt = data&0x80 != 0
+		if f.ModHalt {
+			f.ModPhase = 0
+		}
+	case addr == 0x4088:
+		// each write fills two entries while the modulator is halted
+		if f.ModHalt {
+			f.ModTable[f.ModPosition] = data & 0x07
+			f.ModTable[f.ModPosition+1] = data & 0x07
+			f.ModPosition = (f.ModPosition + 2) & 0x3F
+		}
+	case addr == 0x4089:
+		f.WaveWrite = data&0x80 != 0
+		f.MasterVolume = data & 0x03
+	case addr == 0x408A:
+		f.MasterSpeed = data
+	}
+}
+
+func (f *FDS) ReadRegister(addr uint16) (uint8, bool) {
+	switch {
+	case addr >= 0x4040 && addr < 0x4080:
+		return f.Wave[addr-0x4040] | 0x40, true
+	case addr == 0x4090:
+		return f.Volume.Gain | 0x40, true
+	case addr == 0x4092:
+		return f.Mod.Gain | 0x40, true
+	}
+	return 0, false
+}
+
+func (f *FDS) Step() {
+	if !f.EnvelopeHalt && !f.WaveHalt && f.MasterSpeed != 0 {
+		f.Volume.clock(f.MasterSpeed)
+		f.Mod.clock(f.MasterSpeed)
+	}
+
+	if !f.ModHalt && f.ModFrequency != 0 {
+		f.ModPhase += uint32(f.ModFrequency)
+		if f.ModPhase >= 0x10000 {
+			f.ModPhase -= 0x10000
+			f.stepModulator()
+		}
+	}
+
+	if !f.WaveHalt && !f.WaveWrite {
+		f.WavePhase = (f.WavePhase + f.pitch()) & 0x3FFFFF
+		gain := f.Volume.Gain
+		if gain > 32 {
+			gain = 32
+		}
+		f.Sample = float32(f.Wave[f.WavePhase>>16]) * float32(gain) * fdsMasterVolume[f.MasterVolume]
+	}
+	f.Filtered += (f.Sample - f.Filtered) * f.filter
+}
+
+func (f *FDS) stepModulator() {
+	step := f.ModTable[f.ModPosition]
+	f.ModPosition = (f.ModPosition + 1) & 0x3F
+	if step == 4 {
+		f.ModCounter = 0
+	} else {
+		// wrap to 7 bits
+		f.ModCounter = int8(uint8(f.ModCounter+fdsModSteps[step])<<1) >> 1
+	}
+}
+
+// pitch returns the wave frequency bent by the modulator, as the hardware
+// computes it.
+func (f *FDS) pitch() uint32 {
+	pitch := int32(f.Frequency)
+	if f.ModHalt {
+		return uint32(pitch)
+	}
+	temp := int32(f.ModCounter) * int32(f.Mod.Gain)
+	remainder := temp & 0x0F
+	temp >>= 4
+	if remainder > 0 && temp&0x80 == 0 {
+		if f.ModCounter < 0 {
+			temp--
+		} else {
+			temp += 2
+		}
+	}
+	if temp >= 192 {
+		temp -= 256
+	} else if temp < -64 {
+		temp += 256
+	}
+	temp *= pitch
+	remainder = temp & 0x3F
+	temp >>= 6
+	if remainder >= 32 {
+		temp++
+	}
+	if pitch += temp; pitch < 0 {
+		return 0
+	}
+	return uint32(pitch)
+}
+
+// Output scales the filtered wave, which peaks at 63*32.
+func (f *FDS) Output() float32 {
+	return f.Filtered * fdsLevel * squareLevel / (63 * 32)
+}
@@ -0,0 +1,17 @@
+package apu
+
+// The channels are mixed nonlinearly, as the DACs of the 2A03 are.
+// https://wiki.nesdev.com/w/index.php/APU_Mixer
+var (
+	pulseTable [31]float32
+	tndTable   [203]float32
+)
+
+func init() {
+	for i := 1; i < len(pulseTable); i++ {
+		pulseTable[i] = float32(95.52 / (8128.0/float64(i) + 100))
+	}
+	for i := 1; i < len(tndTable); i++ {
+		tndTable[i] = float32(163.67 / (24329.0/float64(i) + 100))
+	}
+}
@@ -0,0 +1,80 @@
+package apu
+
+// https://wiki.nesdev.com/w/index.php/MMC5_audio
+
+// アドレス	       用途
+// 0x5000～0x5003	矩形波 1
+// 0x5004～0x5007	矩形波 2
+// 0x5010～0x5011	PCM
+// 0x5015	      チャンネルの有効化、ステータス
+
+// MMC5 has two pulse channels like the APU's, without sweep, whose
+// envelopes and length counters are clocked at 240 Hz, and a PCM channel.
+// Only the write mode of the PCM channel is supported.
+type MMC5 struct {
+	Pulse1, Pulse2 Pulse
+	PCM            uint8
+	PCMRead        bool
+	PCMIRQEnabled  bool
+	// Frame counts the CPU cycles to the next quarter frame.
+	Frame  float64
+	Odd    bool
+	period float64
+}
+
+func NewMMC5(cpuClock float64) *MMC5 {
+	m := &MMC5{period: cpuClock / 240}
+	m.Pulse1.NoSweep = true
+	m.Pulse2.NoSweep = true
+	return m
+}
+
+func (m *MMC5) WriteRegister(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x5000 && addr <= 0x5003:
+		m.Pulse1.write(addr-0x5000, data)
+	case addr >= 0x5004 && addr <= 0x5007:
+		m.Pulse2.write(addr-0x5004, data)
+	case addr == 0x5010:
+		m.PCMRead = data&0x01 != 0
+		m.PCMIRQEnabled = data&0x80 != 0
+	case addr == 0x5011:
+		// 0 is ignored, it ends samples in the read mode
+		if !m.PCMRead && data != 0 {
+			m.PCM = data
+		}
+	case addr == 0x5015:
+		m.Pulse1.Length.setEnabled(data&0x01 != 0)
+		m.Pulse2.Length.setEnabled(data&0x02 != 0)
+	}
+}
+
+func (m *MMC5) ReadRegister(addr uint16) (uint8, bool) {
+	if addr != 0x5015 {
+		return 0, false
+	}
+	return boolBit(m.Pulse1.Length.Value > 0) | boolBit(m.Pulse2.Length.Value > 0)<<1, true
+}
+
+func (m *MMC5) Step() {
+	m.Odd = !m.Odd
+	if m.Odd {
+		m.Pulse1.clockTimer()
+		m.Pulse2.clockTimer()
+	}
+	m.Frame++
+	if m.Frame >= m.period {
+		m.Frame -= m.period
+		for _, p := range []*Pulse{&m.Pulse1, &m.Pulse2} {
+			p.Envelope.clock()
+			p.Length.clock()
+		}
+	}
+}
+
+// Output mixes the pulses like the 2A03's and the PCM channel like the DMC
+// at half its resolution.
+func (m *MMC5) Output() float32 {
+	pulses := float32(m.Pulse1.output()+m.Pulse2.output()) * mmc5Level * squareLevel / 15
+	return pulses + tndTable[m.PCM>>1]
+}
@@ -0,0 +1,106 @@
+package apu
+
+// https://wiki.nesdev.com/w/index.php/Namco_163_audio
+
+// アドレス	       用途
+// 0x4800	      内部 RAM のデータ
+// 0xF800	      内部 RAM のアドレス (bit 7 で自動インクリメント)
+
+// n163Cycles is the number of CPU cycles a channel update takes.
+const n163Cycles = 15
+
+// N163 plays up to 8 channels of 4-bit wavetables from its 128 bytes of
+// RAM, which also hold the channel registers from $40. The channels are
+// updated in turn and time multiplexed; the output is their average,
+// which is what the multiplexing sounds like once filtered.
+type N163 struct {
+	RAM           [0x80]uint8
+	Address       uint8
+	AutoIncrement bool
+	// Channel is the channel updated next and Timer counts to its update.
+	Channel uint8
+	Timer   uint8
+	Outputs [8]int16
+}
+
+func NewN163() *N163 {
+	return &N163{}
+}
+
+func (n *N163) WriteRegister(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x4800 && addr < 0x5000:
+		n.RAM[n.Address] = data
+		n.increment()
+	case addr >= 0xF800:
+		n.Address = data & 0x7F
+		n.AutoIncrement = data&0x80 != 0
+	}
+}
+
+func (n *N163) ReadRegister(addr uint16) (uint8, bool) {
+	if addr < 0x4800 || addr >= 0x5000 {
+		return 0, false
+	}
+	data := n.RAM[n.Address]
+	n.increment()
+	return data, true
+}
+
+func (n *N163) increment() {
+	if n.AutoIncrement {
+		n.Address = (n.Address + 1) & 0x7F
+	}
+}
+
+// channels returns the number of enabled channels, which are the last ones.
+func (n *N163) channels() uint8 {
+	return (n.RAM[0x7F]>>4)&0x07 + 1
+}
+
+func (n *N163) Step() {
+	n.Timer++
+	if n.Timer < n163Cycles {
+		return
+	}
+	n.Timer = 0
+
+	count := n.channels()
+	if n.Channel < 8-count {
+		n.Channel = 8 - count
+	}
+	r := n.RAM[0x40+8*uint16(n.Channel):][:8]
+	freq := uint32(r[0]) | uint32(r[2])<<8 | uint32(r[4]&0x03)<<16
+	phase := uint32(r[1]) | uint32(r[3])<<8 | uint32(r[5])<<16
+	length := 256 - uint32(r[4]&0xFC)
+	phase = (phase + freq) % (length << 16)
+	r[1], r[3], r[5] = uint8(phase), uint8(phase>>8), uint8(phase>>16)
+
+	sample := n.sample(r[6] + uint8(phase>>16))
+	n.Outputs[n.Channel] = (int16(sample) - 8) * int16(r[7]&0x0F)
+
+	n.Channel++
+	if n.Channel == 8 {
+		n.Channel = 8 - count
+	}
+}
+
+// sample reads a 4-bit sample, the low nibble first.
+func (n *N163) sample(addr uint8) uint8 {
+	b := n.RAM[(addr>>1)&0x7F]
+	if addr&1 != 0 {
+		return b >> 4
+	}
+	return b & 0x0F
+}
+
+// Output averages the enabled channels. One channel alone ranges over
+// 15*15 steps.
+func (n *N163) Output() float32 {
+	count := n.channels()
+	var sum int16
+	for _, o := range n.Outputs[8-count:] {
+		sum += o
+	}
+	return float32(sum) / float32(count) * n163Level * squareLevel / 225
+}
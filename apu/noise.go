@@ -0,0 +1,35 @@
+package apu
+
+// Noise is the pseudo-random noise channel. Period is in CPU cycles and
+// comes from the region's table.
+// https://wiki.nesdev.com/w/index.php/APU_Noise
+type Noise struct {
+	Envelope Envelope
+	Length   LengthCounter
+	Mode     bool
+	Period   uint16
+	Timer    uint16
+	Shift    uint16
+}
+
+// clockTimer is called every CPU cycle.
+func (n *Noise) clockTimer() {
+	if n.Timer > 0 {
+		n.Timer--
+		return
+	}
+	n.Timer = n.Period - 1
+	tap := uint16(1)
+	if n.Mode {
+		tap = 6
+	}
+	feedback := (n.Shift ^ n.Shift>>tap) & 1
+	n.Shift = n.Shift>>1 | feedback<<14
+}
+
+func (n *Noise) output() uint8 {
+	if n.Length.Value == 0 || n.Shift&1 == 1 {
+		return 0
+	}
+	return n.Envelope.volume()
+}
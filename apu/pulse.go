@@ -0,0 +1,100 @@
+package apu
+
+// https://wiki.nesdev.com/w/index.php/APU_Pulse
+var dutyTable = [4][8]uint8{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+// Pulse is a square wave channel with a sweep unit.
+type Pulse struct {
+	Envelope Envelope
+	Length   LengthCounter
+	Duty     uint8
+	Step     uint8
+	Period   uint16
+	Timer    uint16
+
+	SweepEnabled bool
+	SweepPeriod  uint8
+	SweepNegate  bool
+	SweepShift   uint8
+	SweepReload  bool
+	SweepDivider uint8
+	// OnesComplement is set on pulse 1, whose sweep subtracts one more.
+	OnesComplement bool
+	// NoSweep is set on the MMC5 pulses, which have no sweep unit to mute them.
+	NoSweep bool
+}
+
+func (p *Pulse) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		p.Duty = data >> 6
+		p.Length.Halt = data&0x20 != 0
+		p.Envelope.write(data)
+	case 1:
+		p.SweepEnabled = data&0x80 != 0
+		p.SweepPeriod = (data >> 4) & 0x07
+		p.SweepNegate = data&0x08 != 0
+		p.SweepShift = data & 0x07
+		p.SweepReload = true
+	case 2:
+		p.Period = p.Period&0x0700 | uint16(data)
+	case 3:
+		p.Period = p.Period&0x00FF | uint16(data&0x07)<<8
+		p.Length.load(data >> 3)
+		p.Step = 0
+		p.Envelope.Start = true
+	}
+}
+
+// clockTimer is called every APU cycle, every other CPU cycle.
+func (p *Pulse) clockTimer() {
+	if p.Timer > 0 {
+		p.Timer--
+		return
+	}
+	p.Timer = p.Period
+	p.Step = (p.Step - 1) & 0x07
+}
+
+func (p *Pulse) target() uint16 {
+	change := p.Period >> p.SweepShift
+	if !p.SweepNegate {
+		return p.Period + change
+	}
+	if p.OnesComplement {
+		change++
+	}
+	return p.Period - change
+}
+
+func (p *Pulse) muted() bool {
+	if p.NoSweep {
+		return false
+	}
+	return p.Period < 8 || p.target() > 0x07FF
+}
+
+// clockSweep is called on every half frame.
+func (p *Pulse) clockSweep() {
+	if p.SweepDivider == 0 && p.SweepEnabled && p.SweepShift > 0 && !p.muted() {
+		p.Period = p.target()
+	}
+	if p.SweepDivider == 0 || p.SweepReload {
+		p.SweepDivider = p.SweepPeriod
+		p.SweepReload = false
+	} else {
+		p.SweepDivider--
+	}
+}
+
+func (p *Pulse) output() uint8 {
+	if p.Length.Value == 0 || p.muted() || dutyTable[p.Duty][p.Step] == 0 {
+		return 0
+	}
+	return p.Envelope.volume()
+}
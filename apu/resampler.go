@@ -0,0 +1,120 @@
+package apu
+
+import "math"
+
+// Each change of the input is added to the output as a band-limited step:
+// the difference is spread over kernelTaps output samples by a windowed
+// sinc, picked among kernelPhases sub-sample positions, and the output is
+// the running sum. A constant input costs nothing.
+// http://www.slack.net/~ant/bl-synth/
+const (
+	kernelTaps   = 16
+	kernelPhases = 64
+	// cutoff is relative to the output sample rate.
+	cutoff = 0.45
+	// highPass removes DC, like the high-pass filters of the console.
+	highPass = 0.995
+)
+
+var kernel [kernelPhases][kernelTaps]float32
+
+func init() {
+	for p := range kernel {
+		frac := float64(p) / kernelPhases
+		var sum float64
+		var k [kernelTaps]float64
+		for i := range k {
+			x := float64(i) - kernelTaps/2 + 1 - frac
+			// Blackman window over [-kernelTaps/2, kernelTaps/2]
+			w := 0.42 + 0.5*math.Cos(2*math.Pi*x/kernelTaps) + 0.08*math.Cos(4*math.Pi*x/kernelTaps)
+			k[i] = sinc(2*cutoff*x) * w
+			sum += k[i]
+		}
+		for i := range k {
+			kernel[p][i] = float32(k[i] / sum)
+		}
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// Resampler converts a signal sampled once per CPU cycle to the output
+// sample rate.
+type Resampler struct {
+	// ratio is the number of output samples per input sample.
+	ratio float64
+	// time is the position of the next input sample in buf.
+	time  float64
+	last  float32
+	buf   []float32
+	sum   float32
+	hpIn  float32
+	hpOut float32
+}
+
+func NewResampler(inputRate, outputRate float64) *Resampler {
+	return &Resampler{ratio: outputRate / inputRate}
+}
+
+func (r *Resampler) Ratio() float64 {
+	return r.ratio
+}
+
+// SetRatio changes the number of output samples per input sample.
+func (r *Resampler) SetRatio(ratio float64) {
+	r.ratio = ratio
+}
+
+// Add adds the next input sample.
+func (r *Resampler) Add(sample float32) {
+	if sample != r.last {
+		r.addDelta(sample - r.last)
+		r.last = sample
+	}
+	r.time += r.ratio
+}
+
+func (r *Resampler) addDelta(delta float32) {
+	i := int(r.time)
+	phase := int((r.time - float64(i)) * kernelPhases)
+	for len(r.buf) < i+kernelTaps {
+		r.buf = append(r.buf, 0)
+	}
+	buf := r.buf[i : i+kernelTaps]
+	for j, k := range kernel[phase] {
+		buf[j] += delta * k
+	}
+}
+
+// Available returns the number of output samples ready to be read.
+func (r *Resampler) Available() int {
+	return int(r.time)
+}
+
+// Read moves up to len(out) output samples to out and returns how many.
+func (r *Resampler) Read(out []float32) int {
+	n := r.Available()
+	if n > len(out) {
+		n = len(out)
+	}
+	for i := 0; i < n; i++ {
+		if i < len(r.buf) {
+			r.sum += r.buf[i]
+		}
+		r.hpOut = r.sum - r.hpIn + highPass*r.hpOut
+		r.hpIn = r.sum
+		out[i] = r.hpOut
+	}
+	if n < len(r.buf) {
+		r.buf = r.buf[:copy(r.buf, r.buf[n:])]
+	} else {
+		r.buf = r.buf[:0]
+	}
+	r.time -= float64(n)
+	return n
+}
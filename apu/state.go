@@ -0,0 +1,33 @@
+package apu
+
+// State is a copy of the APU registers and counters for savestates.
+type State struct {
+	Pulse1, Pulse2 Pulse
+	Triangle       Triangle
+	Noise          Noise
+	DMC            DMC
+	FrameCounter   FrameCounter
+	Odd            bool
+}
+
+func (a *APU) State() *State {
+	return &State{
+		Pulse1:       a.pulse1,
+		Pulse2:       a.pulse2,
+		Triangle:     a.triangle,
+		Noise:        a.noise,
+		DMC:          a.dmc,
+		FrameCounter: a.frameCounter,
+		Odd:          a.odd,
+	}
+}
+
+func (a *APU) SetState(s *State) {
+	a.pulse1, a.pulse2 = s.Pulse1, s.Pulse2
+	a.triangle = s.Triangle
+	a.noise = s.Noise
+	a.dmc = s.DMC
+	a.frameCounter = s.FrameCounter
+	a.odd = s.Odd
+	a.updateIRQ()
+}
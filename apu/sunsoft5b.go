@@ -0,0 +1,163 @@
+package apu
+
+import "math"
+
+// https://wiki.nesdev.com/w/index.php/Sunsoft_5B_audio
+
+// アドレス	       用途
+// 0xC000	      レジスタの選択
+// 0xE000	      レジスタへの書き込み
+
+// sunsoftVolumes maps the 5-bit envelope levels to amplitudes, 1.5 dB
+// apart. Fixed volumes v are levels 2v+1.
+var sunsoftVolumes [32]float32
+
+func init() {
+	for i := 1; i < len(sunsoftVolumes); i++ {
+		sunsoftVolumes[i] = float32(math.Pow(10, -1.5*float64(31-i)/20))
+	}
+}
+
+// Sunsoft5B is a YM2149F, an AY-3-8910 variant, with three square wave
+// channels, a noise generator and an envelope. Its timers are clocked
+// every 16 CPU cycles.
+type Sunsoft5B struct {
+	Register  uint8
+	Registers [16]uint8
+	Divider   uint8
+	Tones     [3]struct {
+		Timer uint16
+		High  bool
+	}
+	NoiseTimer uint8
+	// Noise is a 17-bit LFSR.
+	Noise         uint32
+	EnvelopeTimer uint16
+	// EnvelopeStep counts the 32 steps of a cycle. Holding stops it at 31.
+	EnvelopeStep    uint8
+	EnvelopeHolding bool
+	EnvelopeCycle   bool
+}
+
+func NewSunsoft5B() *Sunsoft5B {
+	return &Sunsoft5B{Noise: 1}
+}
+
+func (s *Sunsoft5B) WriteRegister(addr uint16, data uint8) {
+	switch addr & 0xE000 {
+	case 0xC000:
+		s.Register = data & 0x0F
+	case 0xE000:
+		s.Registers[s.Register] = data
+		if s.Register == 0x0D {
+			s.EnvelopeStep, s.EnvelopeHolding, s.EnvelopeCycle = 0, false, false
+			s.EnvelopeTimer = 0
+		}
+	}
+}
+
+func (s *Sunsoft5B) ReadRegister(addr uint16) (uint8, bool) {
+	return 0, false
+}
+
+func (s *Sunsoft5B) tonePeriod(i int) uint16 {
+	return uint16(s.Registers[2*i]) | uint16(s.Registers[2*i+1]&0x0F)<<8
+}
+
+func (s *Sunsoft5B) Step() {
+	s.Divider++
+	if s.Divider < 16 {
+		return
+	}
+	s.Divider = 0
+
+	for i := range s.Tones {
+		t := &s.Tones[i]
+		t.Timer++
+		if t.Timer >= s.tonePeriod(i) {
+			t.Timer = 0
+			t.High = !t.High
+		}
+	}
+
+	s.NoiseTimer++
+	if s.NoiseTimer >= 2*(s.Registers[6]&0x1F) {
+		s.NoiseTimer = 0
+		bit := (s.Noise ^ s.Noise>>3) & 1
+		s.Noise = s.Noise>>1 | bit<<16
+	}
+
+	// 32 steps take 256 times the envelope period
+	s.EnvelopeTimer++
+	if period := uint16(s.Registers[0x0B]) | uint16(s.Registers[0x0C])<<8; s.EnvelopeTimer >= period/2 {
+		s.EnvelopeTimer = 0
+		s.clockEnvelope()
+	}
+}
+
+// clockEnvelope follows the shape in $0D: continue, attack, alternate, hold.
+func (s *Sunsoft5B) clockEnvelope() {
+	if s.EnvelopeHolding {
+		return
+	}
+	s.EnvelopeStep++
+	if s.EnvelopeStep < 32 {
+		return
+	}
+	shape := s.Registers[0x0D]
+	switch {
+	case shape&0x08 == 0:
+		// shapes 0-7 decay or attack once and stay at 0
+		s.EnvelopeHolding = true
+		s.EnvelopeStep = 31
+	case shape&0x01 != 0:
+		s.EnvelopeHolding = true
+		s.EnvelopeStep = 31
+		if shape&0x02 != 0 {
+			s.EnvelopeCycle = !s.EnvelopeCycle
+		}
+	default:
+		s.EnvelopeStep = 0
+		if shape&0x02 != 0 {
+			s.EnvelopeCycle = !s.EnvelopeCycle
+		}
+	}
+}
+
+// envelope returns the current 5-bit level.
+func (s *Sunsoft5B) envelope() uint8 {
+	shape := s.Registers[0x0D]
+	if shape&0x08 == 0 && s.EnvelopeHolding {
+		return 0
+	}
+	level := s.EnvelopeStep
+	attack := shape&0x04 != 0
+	if attack == s.EnvelopeCycle {
+		level = 31 - level
+	}
+	return level
+}
+
+// Output sums the channels. A channel is high unless its enabled tone or
+// noise is low.
+func (s *Sunsoft5B) Output() float32 {
+	var sum float32
+	mixer := s.Registers[7]
+	for i, t := range s.Tones {
+		toneOff := mixer&(1<<i) != 0
+		noiseOff := mixer&(8<<i) != 0
+		if !(toneOff || t.High) || !(noiseOff || s.Noise&1 != 0) {
+			continue
+		}
+		v := s.Registers[8+i]
+		level := 2*(v&0x0F) + 1
+		if v&0x0F == 0 {
+			level = 0
+		}
+		if v&0x10 != 0 {
+			level = s.envelope()
+		}
+		sum += sunsoftVolumes[level]
+	}
+	return sum * sunsoftLevel * float32(squareLevel)
+}
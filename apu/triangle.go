@@ -0,0 +1,62 @@
+package apu
+
+// https://wiki.nesdev.com/w/index.php/APU_Triangle
+var triangleTable = [32]uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// Triangle is the triangle wave channel with its linear counter.
+type Triangle struct {
+	Length       LengthCounter
+	Control      bool
+	LinearPeriod uint8
+	Linear       uint8
+	LinearReload bool
+	Period       uint16
+	Timer        uint16
+	Step         uint8
+}
+
+func (t *Triangle) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		t.Control = data&0x80 != 0
+		t.Length.Halt = t.Control
+		t.LinearPeriod = data & 0x7F
+	case 2:
+		t.Period = t.Period&0x0700 | uint16(data)
+	case 3:
+		t.Period = t.Period&0x00FF | uint16(data&0x07)<<8
+		t.Length.load(data >> 3)
+		t.LinearReload = true
+	}
+}
+
+// clockTimer is called every CPU cycle.
+func (t *Triangle) clockTimer() {
+	if t.Timer > 0 {
+		t.Timer--
+		return
+	}
+	t.Timer = t.Period
+	if t.Length.Value > 0 && t.Linear > 0 {
+		t.Step = (t.Step + 1) & 0x1F
+	}
+}
+
+// clockLinear is called on every quarter frame.
+func (t *Triangle) clockLinear() {
+	if t.LinearReload {
+		t.Linear = t.LinearPeriod
+	} else if t.Linear > 0 {
+		t.Linear--
+	}
+	if !t.Control {
+		t.LinearReload = false
+	}
+}
+
+func (t *Triangle) output() uint8 {
+	return triangleTable[t.Step]
+}
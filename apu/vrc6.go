@@ -0,0 +1,158 @@
+package apu
+
+// https://wiki.nesdev.com/w/index.php/VRC6_audio
+
+// アドレス	       用途
+// 0x9000～0x9002	矩形波 1
+// 0x9003	      周波数の倍率、停止
+// 0xA000～0xA002	矩形波 2
+// 0xB000～0xB002	のこぎり波
+
+// VRC6Pulse has 16 steps of which Duty+1 are high.
+type VRC6Pulse struct {
+	Enabled bool
+	// Digitized outputs the volume without the duty cycle.
+	Digitized bool
+	Duty      uint8
+	Volume    uint8
+	Period    uint16
+	Timer     uint16
+	Step      uint8
+}
+
+func (p *VRC6Pulse) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		p.Digitized = data&0x80 != 0
+		p.Duty = (data >> 4) & 0x07
+		p.Volume = data & 0x0F
+	case 1:
+		p.Period = p.Period&0x0F00 | uint16(data)
+	case 2:
+		p.Period = p.Period&0x00FF | uint16(data&0x0F)<<8
+		p.Enabled = data&0x80 != 0
+		if !p.Enabled {
+			p.Step = 15
+		}
+	}
+}
+
+func (p *VRC6Pulse) clockTimer(shift uint) {
+	if !p.Enabled {
+		return
+	}
+	if p.Timer > 0 {
+		p.Timer--
+		return
+	}
+	p.Timer = p.Period >> shift
+	p.Step = (p.Step - 1) & 0x0F
+}
+
+func (p *VRC6Pulse) output() uint8 {
+	if !p.Enabled || !p.Digitized && p.Step > p.Duty {
+		return 0
+	}
+	return p.Volume
+}
+
+// VRC6Saw adds Rate to the accumulator on every other of 14 steps and
+// outputs its top 5 bits.
+type VRC6Saw struct {
+	Enabled     bool
+	Rate        uint8
+	Period      uint16
+	Timer       uint16
+	Step        uint8
+	Accumulator uint8
+}
+
+func (s *VRC6Saw) write(reg uint16, data uint8) {
+	switch reg {
+	case 0:
+		s.Rate = data & 0x3F
+	case 1:
+		s.Period = s.Period&0x0F00 | uint16(data)
+	case 2:
+		s.Period = s.Period&0x00FF | uint16(data&0x0F)<<8
+		s.Enabled = data&0x80 != 0
+		if !s.Enabled {
+			s.Step, s.Accumulator = 0, 0
+		}
+	}
+}
+
+func (s *VRC6Saw) clockTimer(shift uint) {
+	if !s.Enabled {
+		return
+	}
+	if s.Timer > 0 {
+		s.Timer--
+		return
+	}
+	s.Timer = s.Period >> shift
+	s.Step++
+	switch {
+	case s.Step == 14:
+		s.Step, s.Accumulator = 0, 0
+	case s.Step%2 == 0:
+		s.Accumulator += s.Rate
+	}
+}
+
+func (s *VRC6Saw) output() uint8 {
+	return s.Accumulator >> 3
+}
+
+type VRC6 struct {
+	Pulse1, Pulse2 VRC6Pulse
+	Saw            VRC6Saw
+	Halt           bool
+	// Shift divides the periods by 16 or 256.
+	Shift uint
+}
+
+func NewVRC6() *VRC6 {
+	return &VRC6{}
+}
+
+func (v *VRC6) WriteRegister(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x9000 && addr <= 0x9002:
+		v.Pulse1.write(addr-0x9000, data)
+	case addr == 0x9003:
+		v.Halt = data&0x01 != 0
+		switch {
+		case data&0x04 != 0:
+			v.Shift = 8
+		case data&0x02 != 0:
+			v.Shift = 4
+		default:
+			v.Shift = 0
+		}
+	case addr >= 0xA000 && addr <= 0xA002:
+		v.Pulse2.write(addr-0xA000, data)
+	case addr >= 0xB000 && addr <= 0xB002:
+		v.Saw.write(addr-0xB000, data)
+	}
+}
+
+func (v *VRC6) ReadRegister(addr uint16) (uint8, bool) {
+	return 0, false
+}
+
+func (v *VRC6) Step() {
+	if v.Halt {
+		return
+	}
+	v.Pulse1.clockTimer(v.Shift)
+	v.Pulse2.clockTimer(v.Shift)
+	v.Saw.clockTimer(v.Shift)
+}
+
+// Output scales the 6-bit sum of the channels. A pulse at full volume is
+// as loud as a 2A03 pulse.
+func (v *VRC6) Output() float32 {
+	sum := v.Pulse1.output() + v.Pulse2.output() + v.Saw.output()
+	return float32(sum) * vrc6Level * squareLevel / 15
+}
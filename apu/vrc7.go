@@ -0,0 +1,307 @@
+package apu
+
+import "math"
+
+// https://wiki.nesdev.com/w/index.php/VRC7_audio
+
+// アドレス	       用途
+// 0x9010	      レジスタの選択
+// 0x9030	      レジスタへの書き込み
+
+// The VRC7 is a YM2413 (OPLL) with 6 channels, each a modulator operator
+// bending the phase of a carrier. It makes a sample every 72 cycles of
+// its own 3.58 MHz clock. Envelopes count attenuation in 0.375 dB units.
+const (
+	vrc7Clock = 3579545.0
+	vrc7Rate  = vrc7Clock / 72
+	// an attenuation of 128 units, 48 dB, is silence
+	vrc7Silence = 128
+	// LFOs of the tremolo (AM) and the vibrato (VIB)
+	vrc7TremoloRate  = 3.7
+	vrc7TremoloDepth = 4.8 / 0.375
+	vrc7VibratoRate  = 6.4
+	vrc7VibratoDepth = 0.008
+)
+
+// vrc7Patches are the built-in instruments 1-15; 0 is the custom one.
+var vrc7Patches = [16][8]uint8{
+	{},
+	{0x03, 0x21, 0x05, 0x06, 0xE8, 0x81, 0x42, 0x27},
+	{0x13, 0x41, 0x14, 0x0D, 0xD8, 0xF6, 0x23, 0x12},
+	{0x11, 0x11, 0x08, 0x08, 0xFA, 0xB2, 0x20, 0x12},
+	{0x31, 0x61, 0x0C, 0x07, 0xA8, 0x64, 0x61, 0x27},
+	{0x32, 0x21, 0x1E, 0x06, 0xE1, 0x76, 0x01, 0x28},
+	{0x02, 0x01, 0x06, 0x00, 0xA3, 0xE2, 0xF4, 0xF4},
+	{0x21, 0x61, 0x1D, 0x07, 0x82, 0x81, 0x11, 0x07},
+	{0x23, 0x21, 0x22, 0x17, 0xA2, 0x72, 0x01, 0x17},
+	{0x35, 0x11, 0x25, 0x00, 0x40, 0x73, 0x72, 0x01},
+	{0xB5, 0x01, 0x0F, 0x0F, 0xA8, 0xA5, 0x51, 0x02},
+	{0x17, 0xC1, 0x24, 0x07, 0xF8, 0xF8, 0x22, 0x12},
+	{0x71, 0x23, 0x11, 0x06, 0x65, 0x74, 0x18, 0x16},
+	{0x01, 0x02, 0xD3, 0x05, 0xC9, 0x95, 0x03, 0x02},
+	{0x61, 0x63, 0x0C, 0x00, 0x94, 0xC0, 0x33, 0xF6},
+	{0x21, 0x72, 0x0D, 0x00, 0xC1, 0xD5, 0x56, 0x06},
+}
+
+var (
+	vrc7Multipliers = [16]float64{0.5, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 10, 12, 12, 15, 15}
+	// key scale levels by the top 4 bits of the frequency, at block 7
+	vrc7KeyScale = [16]float64{0, 48, 64, 74, 80, 86, 90, 94, 96, 100, 102, 104, 106, 108, 110, 112}
+)
+
+type vrc7Stage uint8
+
+const (
+	vrc7Attack vrc7Stage = iota
+	vrc7Decay
+	vrc7Sustain
+	vrc7Release
+)
+
+type VRC7Operator struct {
+	Stage    vrc7Stage
+	Envelope float64
+	// Phase is in cycles.
+	Phase float64
+	// Outputs are the last two outputs, for the feedback of the modulator.
+	Outputs [2]float64
+}
+
+// operator is a decoded half of a patch.
+type operator struct {
+	am, vibrato, sustained, ksr bool
+	multiplier                  float64
+	ksl                         uint8
+	rectify                     bool
+	attack, decay               uint8
+	sustainLevel, release       uint8
+}
+
+func decodeOperator(p *[8]uint8, i int) operator {
+	o := operator{
+		am:           p[i]&0x80 != 0,
+		vibrato:      p[i]&0x40 != 0,
+		sustained:    p[i]&0x20 != 0,
+		ksr:          p[i]&0x10 != 0,
+		multiplier:   vrc7Multipliers[p[i]&0x0F],
+		ksl:          p[2+i] >> 6,
+		attack:       p[4+i] >> 4,
+		decay:        p[4+i] & 0x0F,
+		sustainLevel: p[6+i] >> 4,
+		release:      p[6+i] & 0x0F,
+	}
+	if i == 0 {
+		o.rectify = p[3]&0x08 != 0
+	} else {
+		o.rectify = p[3]&0x10 != 0
+	}
+	return o
+}
+
+type VRC7Channel struct {
+	Frequency  uint16
+	Block      uint8
+	Key        bool
+	Sustain    bool
+	Instrument uint8
+	Volume     uint8
+	Modulator  VRC7Operator
+	Carrier    VRC7Operator
+}
+
+type VRC7 struct {
+	Register uint8
+	Custom   [8]uint8
+	Channels [6]VRC7Channel
+	// Timer counts the CPU cycles to the next sample.
+	Timer        float64
+	TremoloPhase float64
+	VibratoPhase float64
+	Sample       float32
+	period       float64
+}
+
+func NewVRC7(cpuClock float64) *VRC7 {
+	v := &VRC7{period: cpuClock / vrc7Rate}
+	for i := range v.Channels {
+		c := &v.Channels[i]
+		c.Modulator.Stage, c.Modulator.Envelope = vrc7Release, vrc7Silence
+		c.Carrier.Stage, c.Carrier.Envelope = vrc7Release, vrc7Silence
+	}
+	return v
+}
+
+func (v *VRC7) WriteRegister(addr uint16, data uint8) {
+	switch addr {
+	case 0x9010:
+		v.Register = data
+	case 0x9030:
+		v.write(v.Register, data)
+	}
+}
+
+func (v *VRC7) write(reg, data uint8) {
+	if reg < 0x08 {
+		v.Custom[reg] = data
+		return
+	}
+	i := int(reg & 0x0F)
+	if i >= len(v.Channels) {
+		return
+	}
+	c := &v.Channels[i]
+	switch reg & 0xF0 {
+	case 0x10:
+		c.Frequency = c.Frequency&0x100 | uint16(data)
+	case 0x20:
+		c.Frequency = c.Frequency&0xFF | uint16(data&0x01)<<8
+		c.Block = (data >> 1) & 0x07
+		c.Sustain = data&0x20 != 0
+		key := data&0x10 != 0
+		if key && !c.Key {
+			for _, o := range []*VRC7Operator{&c.Modulator, &c.Carrier} {
+				o.Stage, o.Phase = vrc7Attack, 0
+			}
+		} else if !key && c.Key {
+			c.Modulator.Stage, c.Carrier.Stage = vrc7Release, vrc7Release
+		}
+		c.Key = key
+	case 0x30:
+		c.Instrument = data >> 4
+		c.Volume = data & 0x0F
+	}
+}
+
+func (v *VRC7) ReadRegister(addr uint16) (uint8, bool) {
+	return 0, false
+}
+
+func (v *VRC7) Step() {
+	v.Timer++
+	if v.Timer < v.period {
+		return
+	}
+	v.Timer -= v.period
+
+	v.TremoloPhase = math.Mod(v.TremoloPhase+vrc7TremoloRate/vrc7Rate, 1)
+	v.VibratoPhase = math.Mod(v.VibratoPhase+vrc7VibratoRate/vrc7Rate, 1)
+	tremolo := (1 - math.Cos(2*math.Pi*v.TremoloPhase)) / 2 * vrc7TremoloDepth
+	vibrato := 1 + vrc7VibratoDepth*math.Sin(2*math.Pi*v.VibratoPhase)
+
+	var sum float64
+	for i := range v.Channels {
+		sum += v.clockChannel(&v.Channels[i], tremolo, vibrato)
+	}
+	v.Sample = float32(sum)
+}
+
+func (v *VRC7) clockChannel(c *VRC7Channel, tremolo, vibrato float64) float64 {
+	p := &vrc7Patches[c.Instrument]
+	if c.Instrument == 0 {
+		p = &v.Custom
+	}
+	mod, car := decodeOperator(p, 0), decodeOperator(p, 1)
+
+	// key scaling by the top bits of the frequency and the block
+	keyScale := vrc7KeyScale[c.Frequency>>5] - 16*float64(7-c.Block)
+	if keyScale < 0 {
+		keyScale = 0
+	}
+	keyRate := c.Block<<1 | uint8(c.Frequency>>8)
+
+	feedback := 0.0
+	if fb := p[3] & 0x07; fb > 0 {
+		feedback = (c.Modulator.Outputs[0] + c.Modulator.Outputs[1]) * math.Exp2(float64(fb)-7)
+	}
+	tl := float64(p[2]&0x3F) * 2
+	m := v.clockOperator(&c.Modulator, mod, c, keyScale, keyRate, tl, tremolo, vibrato, feedback)
+	c.Modulator.Outputs[1], c.Modulator.Outputs[0] = c.Modulator.Outputs[0], m
+
+	// a full modulator output bends the carrier by 2 cycles
+	return v.clockOperator(&c.Carrier, car, c, keyScale, keyRate, float64(c.Volume)*8, tremolo, vibrato, 2*m)
+}
+
+func (v *VRC7) clockOperator(o *VRC7Operator, op operator, c *VRC7Channel, keyScale float64, keyRate uint8, level, tremolo, vibrato, modulation float64) float64 {
+	increment := float64(c.Frequency) * float64(uint(1)<<c.Block) * op.multiplier / (1 << 19)
+	if op.vibrato {
+		increment *= vibrato
+	}
+	o.Phase = math.Mod(o.Phase+increment, 1)
+
+	if !op.ksr {
+		keyRate >>= 2
+	}
+	v.clockEnvelope(o, op, c, keyRate)
+
+	attenuation := o.Envelope + level
+	if op.ksl > 0 {
+		attenuation += keyScale / float64(uint(1)<<(3-op.ksl))
+	}
+	if op.am {
+		attenuation += tremolo
+	}
+	if attenuation >= vrc7Silence {
+		return 0
+	}
+	s := math.Sin(2 * math.Pi * (o.Phase + modulation))
+	if op.rectify && s < 0 {
+		return 0
+	}
+	return s * math.Pow(10, -attenuation*0.375/20)
+}
+
+// envelopeRate returns the change in units per sample at a 4-bit rate:
+// the rate doubles every 4 steps of 4*rate+keyRate.
+func envelopeRate(rate, keyRate uint8) float64 {
+	if rate == 0 {
+		return 0
+	}
+	r := 4*rate + keyRate
+	if r > 63 {
+		r = 63
+	}
+	return float64(4+r&3) * math.Exp2(float64(r>>2)-2) / 8192
+}
+
+func (v *VRC7) clockEnvelope(o *VRC7Operator, op operator, c *VRC7Channel, keyRate uint8) {
+	switch o.Stage {
+	case vrc7Attack:
+		if r := 4*op.attack + keyRate; op.attack == 15 || r >= 60 {
+			o.Envelope = 0
+		} else {
+			o.Envelope -= envelopeRate(op.attack, keyRate) * (o.Envelope/4 + 1)
+		}
+		if o.Envelope <= 0 {
+			o.Envelope = 0
+			o.Stage = vrc7Decay
+		}
+	case vrc7Decay:
+		o.Envelope += envelopeRate(op.decay, keyRate)
+		if sl := float64(op.sustainLevel) * 8; o.Envelope >= sl {
+			o.Envelope = sl
+			o.Stage = vrc7Sustain
+		}
+	case vrc7Sustain:
+		// percussive instruments keep decaying
+		if !op.sustained {
+			o.Envelope += envelopeRate(op.release, keyRate)
+		}
+	case vrc7Release:
+		rate := uint8(7)
+		switch {
+		case c.Sustain:
+			rate = 5
+		case op.sustained:
+			rate = op.release
+		}
+		o.Envelope += envelopeRate(rate, keyRate)
+	}
+	if o.Envelope > vrc7Silence {
+		o.Envelope = vrc7Silence
+	}
+}
+
+// Output scales the sum of the carriers, each from -1 to 1.
+func (v *VRC7) Output() float32 {
+	return v.Sample * vrc7Level * squareLevel / 2
+}
@@ -0,0 +1,91 @@
+package cartridge
+
+// Board is the hardware of the cartridge between the console and its
+// memory: bank switching, registers, extra RAM and the nametable
+// mirroring. Program addresses are CPU addresses from $4020 and character
+// addresses PPU addresses below $2000.
+//
+// Boards may also implement:
+//
+//	Step()                        called on every CPU cycle
+//	Scanline(line int)            called by the PPU as it starts drawing a
+//	                              line with rendering enabled, and with the
+//	                              first vblank line (past 239)
+//	SetIRQ(irq func(bool))        given the function driving the IRQ line
+//	Audio() apu.Expansion         the sound chip mixed with the APU
+type Board interface {
+	ReadProgram(addr uint16) uint8
+	// PeekProgram returns what ReadProgram would without side effects.
+	PeekProgram(addr uint16) uint8
+	WriteProgram(addr uint16, data uint8)
+	// PokeProgram writes the RAM mapped at addr, if any, without decoding
+	// registers.
+	PokeProgram(addr uint16, data uint8)
+	ReadCharacter(addr uint16) uint8
+	PeekCharacter(addr uint16) uint8
+	WriteCharacter(addr uint16, data uint8)
+	// Mirroring is the current nametable mirroring.
+	Mirroring() Mirroring
+}
+
+// nrom is the board without a mapper.
+// https://wiki.nesdev.com/w/index.php/NROM
+type nrom struct {
+	c *Cartridge
+}
+
+func (b *nrom) ReadProgram(addr uint16) uint8 {
+	c := b.c
+	switch {
+	case addr >= 0x6000 && addr < 0x8000:
+		return c.ProgramRAM[addr-0x6000]
+	case addr >= 0x8000:
+		// NROM-128 mirrors its 16 KiB at 0xC000
+		return c.ProgramROM[int(addr-0x8000)%len(c.ProgramROM)]
+	}
+	return 0
+}
+
+func (b *nrom) PeekProgram(addr uint16) uint8 {
+	return b.ReadProgram(addr)
+}
+
+func (b *nrom) WriteProgram(addr uint16, data uint8) {
+	if addr >= 0x6000 && addr < 0x8000 {
+		b.c.ProgramRAM[addr-0x6000] = data
+	}
+}
+
+func (b *nrom) PokeProgram(addr uint16, data uint8) {
+	b.WriteProgram(addr, data)
+}
+
+func (b *nrom) ReadCharacter(addr uint16) uint8 {
+	return b.c.CharacterROM[addr]
+}
+
+func (b *nrom) PeekCharacter(addr uint16) uint8 {
+	return b.c.CharacterROM[addr]
+}
+
+func (b *nrom) WriteCharacter(addr uint16, data uint8) {
+	if b.c.characterRAM {
+		b.c.CharacterROM[addr] = data
+	}
+}
+
+func (b *nrom) Mirroring() Mirroring {
+	return b.c.Mirroring
+}
+
+// NametableBoard is a Board that maps the nametables itself, to its own
+// memory or to pages of the console's VRAM (CIRAM), instead of wiring
+// them with Mirroring.
+type NametableBoard interface {
+	Board
+	// SetCIRAM gives the board the 2 KiB of console VRAM.
+	SetCIRAM(ciram []uint8)
+	ReadNametable(addr uint16) uint8
+	PeekNametable(addr uint16) uint8
+	WriteNametable(addr uint16, data uint8)
+}
@@ -0,0 +1,322 @@
+package cartridge
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+)
+
+// https://wiki.nesdev.com/w/index.php/INES
+
+const (
+	nesHeaderSize           = 0x0010 // 16 Byte
+	trainerSize             = 0x0200 // 512 Byte
+	programROMSizePerPage   = 0x4000 // 16 KiB
+	characterROMSizePerPage = 0x2000 //  8 KiB
+	programRAMSize          = 0x2000 //  8 KiB
+)
+
+var magic = []byte("NES\x1A")
+
+var ErrInvalidROM = errors.New("not an iNES ROM")
+
+// Mirroring maps the four nametables to 1 KiB pages of VRAM, 2 bits each
+// from bit 0. The console has pages 0 and 1; four-screen cartridges add
+// pages 2 and 3.
+// https://wiki.nesdev.com/w/index.php/Mirroring#Nametable_Mirroring
+type Mirroring uint8
+
+const (
+	MirroringHorizontal  Mirroring = 0b01_01_00_00
+	MirroringVertical    Mirroring = 0b01_00_01_00
+	MirroringFourScreen  Mirroring = 0b11_10_01_00
+	MirroringSingleLower Mirroring = 0b00_00_00_00
+	MirroringSingleUpper Mirroring = 0b01_01_01_01
+)
+
+// Page returns the page of nametable i (0-3).
+func (m Mirroring) Page(i uint16) uint16 {
+	return uint16(m>>(2*i)) & 0b11
+}
+
+// Timing is the console timing the ROM was made for.
+type Timing uint8
+
+// https://wiki.nesdev.com/w/index.php/NES_2.0#Byte_12_.28CPU.2FPPU_Timing.29
+const (
+	TimingNTSC Timing = iota
+	TimingPAL
+	// TimingMulti runs on both NTSC and PAL consoles.
+	TimingMulti
+	TimingDendy
+)
+
+type Cartridge struct {
+	ProgramROM   []uint8
+	CharacterROM []uint8
+	ProgramRAM   []uint8
+	Mapper       uint8
+	Mirroring    Mirroring
+	Battery      bool
+	Timing       Timing
+	// characterRAM is set when the cartridge has no CHR-ROM and
+	// CharacterROM is writable RAM instead.
+	characterRAM bool
+	board        Board
+}
+
+var boards = map[uint8]func(c *Cartridge) Board{
+	0: func(c *Cartridge) Board { return &nrom{c: c} },
+}
+
+// RegisterBoard makes Parse accept ROMs of the iNES mapper number, mapped
+// by the board newBoard returns. Packages implementing boards register
+// them in init.
+func RegisterBoard(mapper uint8, newBoard func(c *Cartridge) Board) {
+	boards[mapper] = newBoard
+}
+
+func Parse(buf []byte) (*Cartridge, error) {
+	c, err := ReadImage(buf)
+	if err != nil {
+		return nil, err
+	}
+	newBoard, ok := boards[c.Mapper]
+	if !ok {
+		return nil, fmt.Errorf("unsupported mapper: %d", c.Mapper)
+	}
+	c.board = newBoard(c)
+	return c, nil
+}
+
+// ReadImage parses an iNES image without checking that its mapper is
+// supported, for tools that only inspect the ROM.
+func ReadImage(buf []byte) (*Cartridge, error) {
+	if len(buf) < nesHeaderSize || !bytes.Equal(buf[:4], magic) {
+		return nil, ErrInvalidROM
+	}
+
+	programROMPages, characterROMPages := int(buf[4]), int(buf[5])
+	flags6, flags7 := buf[6], buf[7]
+	if programROMPages == 0 {
+		return nil, fmt.Errorf("%w: no PRG-ROM", ErrInvalidROM)
+	}
+
+	c := &Cartridge{
+		Mapper:     flags7&0xF0 | flags6>>4,
+		Battery:    flags6&0b0010 != 0,
+		ProgramRAM: make([]uint8, programRAMSize),
+	}
+	if flags7&0b1100 == 0b1000 {
+		// NES 2.0
+		c.Timing = Timing(buf[12] & 0b11)
+	} else if buf[9]&0b1 != 0 {
+		c.Timing = TimingPAL
+	}
+
+	switch {
+	case flags6&0b1000 != 0:
+		c.Mirroring = MirroringFourScreen
+	case flags6&0b0001 != 0:
+		c.Mirroring = MirroringVertical
+	default:
+		c.Mirroring = MirroringHorizontal
+	}
+
+	programROMStart := nesHeaderSize
+	if flags6&0b0100 != 0 {
+		programROMStart += trainerSize
+	}
+	programROMEnd := programROMStart + programROMSizePerPage*programROMPages
+	characterROMEnd := programROMEnd + characterROMSizePerPage*characterROMPages
+	if len(buf) < characterROMEnd {
+		return nil, fmt.Errorf("%w: header declares %d bytes of ROM but the file has %d", ErrInvalidROM, characterROMEnd-nesHeaderSize, len(buf)-nesHeaderSize)
+	}
+
+	c.ProgramROM = buf[programROMStart:programROMEnd]
+	if characterROMPages == 0 {
+		c.CharacterROM = make([]uint8, characterROMSizePerPage)
+		c.characterRAM = true
+	} else {
+		c.CharacterROM = buf[programROMEnd:characterROMEnd]
+	}
+
+	return c, nil
+}
+
+func Load(path string) (*Cartridge, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Board returns the board mapping the memory, NROM unless SetBoard
+// installed another.
+func (c *Cartridge) Board() Board {
+	if c.board == nil {
+		c.board = &nrom{c: c}
+	}
+	return c.board
+}
+
+func (c *Cartridge) SetBoard(b Board) {
+	c.board = b
+}
+
+// HasCharacterRAM reports whether CharacterROM is writable RAM.
+func (c *Cartridge) HasCharacterRAM() bool {
+	return c.characterRAM
+}
+
+// ReadProgram reads the CPU address space from $4020.
+func (c *Cartridge) ReadProgram(addr uint16) uint8 {
+	return c.Board().ReadProgram(addr)
+}
+
+// PeekProgram returns what ReadProgram would without side effects.
+func (c *Cartridge) PeekProgram(addr uint16) uint8 {
+	return c.Board().PeekProgram(addr)
+}
+
+func (c *Cartridge) WriteProgram(addr uint16, data uint8) {
+	c.Board().WriteProgram(addr, data)
+}
+
+// PokeProgram writes the RAM mapped at addr without side effects.
+func (c *Cartridge) PokeProgram(addr uint16, data uint8) {
+	c.Board().PokeProgram(addr, data)
+}
+
+// ReadCharacter reads the PPU address space below $2000.
+func (c *Cartridge) ReadCharacter(addr uint16) uint8 {
+	return c.Board().ReadCharacter(addr)
+}
+
+// PeekCharacter returns what ReadCharacter would without side effects.
+func (c *Cartridge) PeekCharacter(addr uint16) uint8 {
+	return c.Board().PeekCharacter(addr)
+}
+
+func (c *Cartridge) WriteCharacter(addr uint16, data uint8) {
+	c.Board().WriteCharacter(addr, data)
+}
+
+// LoadSave restores battery-backed PRG-RAM. A missing file is not an error.
+func (c *Cartridge) LoadSave(path string) error {
+	if !c.Battery {
+		return nil
+	}
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	copy(c.ProgramRAM, buf)
+	return nil
+}
+
+func (c *Cartridge) Save(path string) error {
+	if !c.Battery {
+		return nil
+	}
+	return ioutil.WriteFile(path, c.ProgramRAM, 0644)
+}
+
+// State is a copy of the cartridge RAM and of the board registers for
+// savestates.
+type State struct {
+	ProgramRAM   []uint8
+	CharacterRAM []uint8
+	// Board is the exported fields of the board, gob encoded.
+	Board []byte
+}
+
+func (c *Cartridge) State() (*State, error) {
+	s := &State{ProgramRAM: append([]uint8(nil), c.ProgramRAM...)}
+	if c.characterRAM {
+		s.CharacterRAM = append([]uint8(nil), c.CharacterROM...)
+	}
+	board, ok := boardStruct(c.Board())
+	if !ok || !hasExportedFields(board.Type()) {
+		// boards without registers, like NROM, have nothing to save
+		return s, nil
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(board.Addr().Interface()); err != nil {
+		return nil, fmt.Errorf("board state: %w", err)
+	}
+	s.Board = buf.Bytes()
+	return s, nil
+}
+
+func (c *Cartridge) SetState(s *State) error {
+	copy(c.ProgramRAM, s.ProgramRAM)
+	if c.characterRAM {
+		copy(c.CharacterROM, s.CharacterRAM)
+	}
+	board, ok := boardStruct(c.Board())
+	if s.Board == nil || !ok {
+		return nil
+	}
+	// gob skips zero values and Decode leaves their fields as they are, so
+	// the state is decoded into a zero board whose fields are then copied
+	saved := reflect.New(board.Type())
+	if err := gob.NewDecoder(bytes.NewReader(s.Board)).Decode(saved.Interface()); err != nil {
+		return fmt.Errorf("board state: %w", err)
+	}
+	copyExported(board, saved.Elem())
+	return nil
+}
+
+// boardStruct returns the struct a board points to.
+func boardStruct(b Board) (reflect.Value, bool) {
+	v := reflect.ValueOf(b)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	return v.Elem(), true
+}
+
+func hasExportedFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// copyExported copies the exported fields of src to dst. It goes into
+// structs and the structs pointed to, so the unexported fields of dst,
+// set up by the board's constructor, are kept.
+func copyExported(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		if dst.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		d, s := dst.Field(i), src.Field(i)
+		switch {
+		case d.Kind() == reflect.Struct:
+			copyExported(d, s)
+		case d.Kind() == reflect.Ptr && d.Type().Elem().Kind() == reflect.Struct && !d.IsNil():
+			if s.IsNil() {
+				s = reflect.New(d.Type().Elem())
+			}
+			copyExported(d.Elem(), s.Elem())
+		default:
+			d.Set(s)
+		}
+	}
+}
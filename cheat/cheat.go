@@ -0,0 +1,206 @@
+package cheat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// http://tuxnes.sourceforge.net/gamegenie.html
+// https://wiki.nesdev.com/w/index.php/Game_Genie
+
+const letters = "APZLGITYEOXUKSVN"
+
+// Cheat is a Game Genie code patching PRG reads, or a Pro Action Replay
+// code freezing a RAM address.
+type Cheat struct {
+	Code    string
+	Name    string
+	Address uint16
+	Value   uint8
+	// Compare is only checked by 8-letter Game Genie codes: the value is
+	// only substituted when the ROM holds Compare.
+	Compare    uint8
+	HasCompare bool
+	Enabled    bool
+}
+
+// Freeze reports whether the cheat is a RAM freeze rather than a ROM patch.
+func (c *Cheat) Freeze() bool {
+	return c.Address < 0x8000
+}
+
+func (c *Cheat) String() string {
+	s := fmt.Sprintf("%s  $%04X = $%02X", c.Code, c.Address, c.Value)
+	if c.HasCompare {
+		s += fmt.Sprintf(" if $%02X", c.Compare)
+	}
+	if c.Name != "" {
+		s += "  " + c.Name
+	}
+	return s
+}
+
+// Decode parses a 6- or 8-letter Game Genie code, or a Pro Action Replay
+// code as 6 hex digits AAAAVV (or AAAA:VV) freezing RAM address AAAA to VV.
+func Decode(code string) (*Cheat, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if c, ok := decodeGameGenie(code); ok {
+		return c, nil
+	}
+	hex := strings.Replace(code, ":", "", 1)
+	if len(hex) == 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil && v>>8 < 0x2000 {
+			return &Cheat{Code: code, Address: uint16(v >> 8), Value: uint8(v), Enabled: true}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid cheat code: %q", code)
+}
+
+func decodeGameGenie(code string) (*Cheat, bool) {
+	if len(code) != 6 && len(code) != 8 {
+		return nil, false
+	}
+	n := make([]uint16, len(code))
+	for i, r := range code {
+		v := strings.IndexRune(letters, r)
+		if v < 0 {
+			return nil, false
+		}
+		n[i] = uint16(v)
+	}
+
+	c := &Cheat{Code: code, Enabled: true}
+	c.Address = 0x8000 | (n[3]&7)<<12 | (n[5]&7)<<8 | (n[4]&8)<<8 | (n[2]&7)<<4 | (n[1]&8)<<4 | n[4]&7 | n[3]&8
+	value := (n[1]&7)<<4 | (n[0]&8)<<4 | n[0]&7
+	if len(code) == 6 {
+		c.Value = uint8(value | n[5]&8)
+		return c, true
+	}
+	c.Value = uint8(value | n[7]&8)
+	c.Compare = uint8((n[7]&7)<<4 | (n[6]&8)<<4 | n[6]&7 | n[5]&8)
+	c.HasCompare = true
+	return c, true
+}
+
+// List holds the cheats of a game. A nil *List has no cheats.
+type List struct {
+	Cheats []*Cheat
+	// Disabled turns all cheats off without changing each one.
+	Disabled bool
+	patches  map[uint16][]*Cheat
+}
+
+func (l *List) Add(c *Cheat) {
+	l.Cheats = append(l.Cheats, c)
+	l.Update()
+}
+
+// Update must be called after changing a cheat.
+func (l *List) Update() {
+	l.patches = map[uint16][]*Cheat{}
+	for _, c := range l.Cheats {
+		if c.Enabled {
+			l.patches[c.Address] = append(l.patches[c.Address], c)
+		}
+	}
+}
+
+// Patch returns the value a read of addr sees with the cheats applied.
+func (l *List) Patch(addr uint16, data uint8) uint8 {
+	if l == nil || l.Disabled || len(l.patches) == 0 {
+		return data
+	}
+	if addr < 0x2000 {
+		addr %= 0x0800
+	}
+	for _, c := range l.patches[addr] {
+		if !c.HasCompare || c.Compare == data {
+			return c.Value
+		}
+	}
+	return data
+}
+
+// Parse reads a cheats file: one code per line followed by an optional
+// name. Lines starting with "-" are disabled cheats and "#" comments.
+//
+//	SXIOPO infinite lives
+//	-0075:09 start at world 8
+func Parse(r io.Reader) (*List, error) {
+	l := &List{}
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		enabled := !strings.HasPrefix(text, "-")
+		fields := strings.SplitN(strings.TrimPrefix(text, "-"), " ", 2)
+		c, err := Decode(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(fields) == 2 {
+			c.Name = strings.TrimSpace(fields[1])
+		}
+		c.Enabled = enabled
+		l.Cheats = append(l.Cheats, c)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	l.Update()
+	return l, nil
+}
+
+// Write writes the cheats in the format read by Parse.
+func (l *List) Write(w io.Writer) error {
+	for _, c := range l.Cheats {
+		line := c.Code
+		if !c.Enabled {
+			line = "-" + line
+		}
+		if c.Name != "" {
+			line += " " + c.Name
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *List) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := l.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads a cheats file. A missing file is an empty list.
+func Load(path string) (*List, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &List{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return l, nil
+}
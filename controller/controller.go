@@ -1,38 +1,78 @@
 package controller
 
-import "github.com/hajimehoshi/ebiten"
+// https://wiki.nesdev.com/w/index.php/Standard_controller
+
+type Button uint8
+
+const (
+	ButtonA Button = iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+// Device is a peripheral plugged into a controller port. Read returns the
+// bits the port puts on the data bus and Write receives the $4016 strobe.
+// Peek returns what Read would without shifting anything out.
+type Device interface {
+	Read() uint8
+	Peek() uint8
+	Write(data uint8)
+}
 
 type Controller struct {
 	buttons uint8
+	latch   uint8
+	strobe  bool
+}
+
+func (c *Controller) SetButtons(buttons uint8) {
+	c.buttons = buttons
+}
+
+func (c *Controller) Buttons() uint8 {
+	return c.buttons
+}
+
+func (c *Controller) IsPressed(b Button) bool {
+	return c.buttons&(1<<b) != 0
 }
 
-func (c *Controller) Clear() {
-	c.buttons = 0
-}
-
-func (c *Controller) ReadButton() uint8 {
-	var k ebiten.Key
-	switch c.buttons {
-	case 0: // A
-		k = ebiten.KeyZ
-	case 1: // B
-		k = ebiten.KeyC
-	case 2: // Select
-		k = ebiten.KeySpace
-	case 3: // Start
-		k = ebiten.KeyEnter
-	case 4: // Up
-		k = ebiten.KeyUp
-	case 5: // Down
-		k = ebiten.KeyDown
-	case 6: // Left
-		k = ebiten.KeyLeft
-	case 7: // Right
-		k = ebiten.KeyRight
+// Latch returns the shift register. The next Read returns bit 0.
+func (c *Controller) Latch() uint8 {
+	return c.latch
+}
+
+func (c *Controller) Strobe() bool {
+	return c.strobe
+}
+
+func (c *Controller) Write(data uint8) {
+	strobe := data&0b1 == 1
+	if c.strobe && !strobe {
+		c.latch = c.buttons
 	}
-	c.buttons++
-	if ebiten.IsKeyPressed(k) {
-		return 1
+	c.strobe = strobe
+}
+
+func (c *Controller) Peek() uint8 {
+	if c.strobe {
+		return c.buttons & 0b1
+	}
+	return c.latch & 0b1
+}
+
+func (c *Controller) Read() uint8 {
+	if c.strobe {
+		// while strobe is high the shift register keeps reloading, so only A is visible
+		return c.buttons & 0b1
 	}
-	return 0
+	v := c.latch & 0b1
+	// official controllers shift in 1s after the 8th read
+	c.latch = c.latch>>1 | 0b10000000
+	return v
 }
@@ -0,0 +1,27 @@
+package controller
+
+// https://wiki.nesdev.com/w/index.php/Standard_controller#Famicom_expansion_port
+
+// FamicomControllers are the two controllers (players 3 and 4) plugged
+// into the Famicom expansion port. They are read on D1 of $4016 and $4017.
+type FamicomControllers struct {
+	Controllers [2]*Controller
+}
+
+func NewFamicomControllers(player3, player4 *Controller) *FamicomControllers {
+	return &FamicomControllers{[2]*Controller{player3, player4}}
+}
+
+func (f *FamicomControllers) Read(port int) uint8 {
+	return f.Controllers[port].Read() << 1
+}
+
+func (f *FamicomControllers) Peek(port int) uint8 {
+	return f.Controllers[port].Peek() << 1
+}
+
+func (f *FamicomControllers) Write(data uint8) {
+	for _, c := range f.Controllers {
+		c.Write(data)
+	}
+}
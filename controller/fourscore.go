@@ -0,0 +1,68 @@
+package controller
+
+// https://wiki.nesdev.com/w/index.php/Four_Score
+
+// signatures are read after the two controllers of each port, LSB first
+var fourScoreSignatures = [2]uint32{0b00001000, 0b00000100}
+
+// FourScore connects four controllers to the two ports. Port 1 reports
+// players 1 and 3, port 2 reports players 2 and 4.
+type FourScore struct {
+	Controllers [4]*Controller
+	ports       [2]fourScorePort
+}
+
+type fourScorePort struct {
+	fourScore *FourScore
+	port      int
+	latch     uint32
+	reads     int
+	strobe    bool
+}
+
+func NewFourScore(controllers [4]*Controller) *FourScore {
+	f := &FourScore{Controllers: controllers}
+	for i := range f.ports {
+		f.ports[i] = fourScorePort{fourScore: f, port: i}
+	}
+	return f
+}
+
+// Port returns the device to plug into port 1 (0) or port 2 (1).
+func (f *FourScore) Port(port int) Device {
+	return &f.ports[port]
+}
+
+func (p *fourScorePort) Write(data uint8) {
+	strobe := data&0b1 == 1
+	if p.strobe && !strobe {
+		first := p.fourScore.Controllers[p.port].Buttons()
+		second := p.fourScore.Controllers[p.port+2].Buttons()
+		p.latch = uint32(first) | uint32(second)<<8 | fourScoreSignatures[p.port]<<16
+		p.reads = 0
+	}
+	p.strobe = strobe
+}
+
+func (p *fourScorePort) Peek() uint8 {
+	if p.strobe {
+		return p.fourScore.Controllers[p.port].Buttons() & 0b1
+	}
+	if p.reads >= 24 {
+		return 1
+	}
+	return uint8(p.latch & 0b1)
+}
+
+func (p *fourScorePort) Read() uint8 {
+	if p.strobe {
+		return p.fourScore.Controllers[p.port].Buttons() & 0b1
+	}
+	if p.reads >= 24 {
+		return 1
+	}
+	v := uint8(p.latch & 0b1)
+	p.latch >>= 1
+	p.reads++
+	return v
+}
@@ -0,0 +1,71 @@
+package controller
+
+// https://wiki.nesdev.com/w/index.php/Input_devices
+
+// ExpansionDevice is a peripheral plugged into the Famicom expansion port.
+// It shares the data lines with the controller ports, so Read returns the
+// bits it puts on $4016 (port 0) or $4017 (port 1).
+type ExpansionDevice interface {
+	Read(port int) uint8
+	Peek(port int) uint8
+	Write(data uint8)
+}
+
+type Unplugged struct{}
+
+func (Unplugged) Read() uint8      { return 0 }
+func (Unplugged) Peek() uint8      { return 0 }
+func (Unplugged) Write(data uint8) {}
+
+type UnpluggedExpansion struct{}
+
+func (UnpluggedExpansion) Read(port int) uint8 { return 0 }
+func (UnpluggedExpansion) Peek(port int) uint8 { return 0 }
+func (UnpluggedExpansion) Write(data uint8)    {}
+
+// Ports wires the devices to $4016 and $4017.
+type Ports struct {
+	Port1     Device
+	Port2     Device
+	Expansion ExpansionDevice
+}
+
+func NewPorts(port1, port2 Device, expansion ExpansionDevice) *Ports {
+	if port1 == nil {
+		port1 = Unplugged{}
+	}
+	if port2 == nil {
+		port2 = Unplugged{}
+	}
+	if expansion == nil {
+		expansion = UnpluggedExpansion{}
+	}
+	return &Ports{port1, port2, expansion}
+}
+
+func (p *Ports) Read(addr uint16) uint8 {
+	switch addr {
+	case 0x4016:
+		return p.Port1.Read() | p.Expansion.Read(0)
+	case 0x4017:
+		return p.Port2.Read() | p.Expansion.Read(1)
+	}
+	return 0
+}
+
+// Peek returns what Read would without side effects on the devices.
+func (p *Ports) Peek(addr uint16) uint8 {
+	switch addr {
+	case 0x4016:
+		return p.Port1.Peek() | p.Expansion.Peek(0)
+	case 0x4017:
+		return p.Port2.Peek() | p.Expansion.Peek(1)
+	}
+	return 0
+}
+
+func (p *Ports) Write(data uint8) {
+	p.Port1.Write(data)
+	p.Port2.Write(data)
+	p.Expansion.Write(data)
+}
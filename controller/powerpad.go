@@ -0,0 +1,69 @@
+package controller
+
+// https://wiki.nesdev.com/w/index.php/Power_Pad
+
+// order in which the buttons (numbered 1-12 on side B) are shifted out
+var (
+	powerPadD3 = [...]uint8{2, 1, 5, 9, 6, 10, 11, 7}
+	powerPadD4 = [...]uint8{4, 3, 12, 8}
+)
+
+// PowerPad is the 12 button floor mat on port 2. Buttons are shifted out
+// on D3 and D4 at the same time.
+type PowerPad struct {
+	buttons uint16
+	d3, d4  uint8
+	strobe  bool
+}
+
+// SetButtons sets the pressed buttons, bit n-1 being button n.
+func (p *PowerPad) SetButtons(buttons uint16) {
+	p.buttons = buttons
+}
+
+func (p *PowerPad) Buttons() uint16 {
+	return p.buttons
+}
+
+func (p *PowerPad) pressed(n uint8) uint8 {
+	return uint8(p.buttons>>(n-1)) & 0b1
+}
+
+func (p *PowerPad) latch() {
+	// D4 only has 4 buttons and reads 1 afterwards
+	p.d3, p.d4 = 0, 0xF0
+	for i, n := range powerPadD3 {
+		p.d3 |= p.pressed(n) << i
+	}
+	for i, n := range powerPadD4 {
+		p.d4 |= p.pressed(n) << i
+	}
+}
+
+func (p *PowerPad) Write(data uint8) {
+	strobe := data&0b1 == 1
+	if p.strobe && !strobe {
+		p.latch()
+	}
+	p.strobe = strobe
+}
+
+func (p *PowerPad) Peek() uint8 {
+	if p.strobe {
+		// a read while strobe is high would latch first
+		return p.pressed(powerPadD3[0])<<3 | p.pressed(powerPadD4[0])<<4
+	}
+	return (p.d3&0b1)<<3 | (p.d4&0b1)<<4
+}
+
+func (p *PowerPad) Read() uint8 {
+	if p.strobe {
+		p.latch()
+	}
+	v := (p.d3&0b1)<<3 | (p.d4&0b1)<<4
+	if !p.strobe {
+		p.d3 = p.d3>>1 | 0b10000000
+		p.d4 = p.d4>>1 | 0b10000000
+	}
+	return v
+}
@@ -0,0 +1,99 @@
+package controller
+
+// https://wiki.nesdev.com/w/index.php/Arkanoid_controller
+
+const (
+	vausMin = 0x62
+	vausMax = 0xF2
+)
+
+// Vaus is the Arkanoid paddle. The potentiometer value is latched on the
+// strobe and shifted out MSB first, inverted.
+type Vaus struct {
+	position uint8
+	fire     bool
+	latch    uint8
+	strobe   bool
+}
+
+func NewVaus() *Vaus {
+	return &Vaus{position: vausMin}
+}
+
+// SetPosition turns the knob, 0.0 being the leftmost and 1.0 the rightmost position.
+func (v *Vaus) SetPosition(x float64) {
+	if x < 0 {
+		x = 0
+	}
+	if x > 1 {
+		x = 1
+	}
+	v.position = vausMin + uint8(x*(vausMax-vausMin))
+}
+
+func (v *Vaus) SetFire(pressed bool) {
+	v.fire = pressed
+}
+
+func (v *Vaus) Position() uint8 {
+	return v.position
+}
+
+func (v *Vaus) Fire() bool {
+	return v.fire
+}
+
+func (v *Vaus) Write(data uint8) {
+	strobe := data&0b1 == 1
+	if v.strobe && !strobe {
+		v.latch = ^v.position
+	}
+	v.strobe = strobe
+}
+
+func (v *Vaus) shift() uint8 {
+	b := v.latch >> 7
+	v.latch <<= 1
+	return b
+}
+
+// Read returns the bits of the NES version on port 2: D3 is the button
+// and D4 the serial data.
+func (v *Vaus) Read() uint8 {
+	return v.button() | v.shift()<<4
+}
+
+func (v *Vaus) Peek() uint8 {
+	return v.button() | v.latch>>7<<4
+}
+
+func (v *Vaus) button() uint8 {
+	if v.fire {
+		return 0b00001000
+	}
+	return 0
+}
+
+// FamicomVaus is the Famicom version on the expansion port: D1 of $4016
+// is the button and D1 of $4017 the serial data.
+type FamicomVaus struct {
+	*Vaus
+}
+
+func NewFamicomVaus() *FamicomVaus {
+	return &FamicomVaus{NewVaus()}
+}
+
+func (v *FamicomVaus) Read(port int) uint8 {
+	if port == 0 {
+		return v.button() >> 2
+	}
+	return v.shift() << 1
+}
+
+func (v *FamicomVaus) Peek(port int) uint8 {
+	if port == 0 {
+		return v.button() >> 2
+	}
+	return v.latch >> 7 << 1
+}
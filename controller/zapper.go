@@ -0,0 +1,91 @@
+package controller
+
+import "image/color"
+
+// https://wiki.nesdev.com/w/index.php/Zapper
+
+const (
+	// the photodiode stays lit for a while after the beam has passed
+	zapperLightLines  = 20
+	zapperRadius      = 2
+	zapperBrightness  = 0xC0
+	zapperScreenWidth = 256
+)
+
+// Screen is the picture the Zapper is pointed at.
+type Screen interface {
+	Scanline() int
+	Pixel(x, y int) color.RGBA
+}
+
+type Zapper struct {
+	screen  Screen
+	x, y    int
+	trigger bool
+}
+
+func NewZapper(screen Screen) *Zapper {
+	return &Zapper{screen: screen, x: -1, y: -1}
+}
+
+// Aim points the Zapper at (x, y). Negative coordinates point it away from the screen.
+func (z *Zapper) Aim(x, y int) {
+	z.x, z.y = x, y
+}
+
+func (z *Zapper) SetTrigger(pulled bool) {
+	z.trigger = pulled
+}
+
+func (z *Zapper) Position() (int, int) {
+	return z.x, z.y
+}
+
+func (z *Zapper) Trigger() bool {
+	return z.trigger
+}
+
+func brightness(c color.RGBA) int {
+	return (int(c.R)*299 + int(c.G)*587 + int(c.B)*114) / 1000
+}
+
+func (z *Zapper) detectLight() bool {
+	if z.x < 0 || z.y < 0 || z.x >= zapperScreenWidth {
+		return false
+	}
+	line := z.screen.Scanline()
+	if line <= z.y || line > z.y+zapperLightLines {
+		return false
+	}
+	for dy := -zapperRadius; dy <= zapperRadius; dy++ {
+		y := z.y + dy
+		if y < 0 || y >= line {
+			// not drawn yet in this frame
+			continue
+		}
+		for dx := -zapperRadius; dx <= zapperRadius; dx++ {
+			if brightness(z.screen.Pixel(z.x+dx, y)) >= zapperBrightness {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Read has no side effects, so Peek is the same.
+func (z *Zapper) Read() uint8 {
+	return z.Peek()
+}
+
+func (z *Zapper) Peek() uint8 {
+	var v uint8
+	if !z.detectLight() {
+		v |= 0b00001000
+	}
+	if z.trigger {
+		v |= 0b00010000
+	}
+	return v
+}
+
+func (z *Zapper) Write(data uint8) {}
@@ -2,6 +2,7 @@ package cpu
 
 import (
 	"fmt"
+	"io"
 )
 
 type StatusRegister struct {
@@ -18,6 +19,9 @@ type Registers struct {
 type CPU struct {
 	registers *Registers
 	bus       *CPUBus
+	trace     io.Writer
+	nmi       bool
+	irq       IRQSource
 }
 
 func nthBit(v uint8, n uint8) uint8 {
@@ -90,332 +94,87 @@ func (n *CPU) fetchWord() uint16 {
 	return n.readWord(addr)
 }
 
+// the stack is page 1, SP keeps the page in its high byte
 func (c *CPU) push(data uint8) {
 	c.writeByte(c.registers.SP, data)
-	c.registers.SP--
+	c.registers.SP = 0x0100 | (c.registers.SP-1)&0xFF
 }
 
 func (c *CPU) pop() uint8 {
-	c.registers.SP++
+	c.registers.SP = 0x0100 | (c.registers.SP+1)&0xFF
 	return c.readByte(c.registers.SP)
 }
 
-func (c *CPU) getByteByAddressing(opeland uint16, addressing string) uint8 {
-	switch addressing {
-	case "Immediate":
-		return uint8(opeland)
-	default:
-		return c.readByte(opeland)
+func (c *CPU) operandByte(operand uint16, mode Addressing) uint8 {
+	if mode == Immediate {
+		return uint8(operand)
 	}
+	return c.readByte(operand)
 }
 
-func (c *CPU) fetchOpeland(addressing string) (uint16, error) {
-	var opeland uint16
-	switch addressing {
-	case "Accumulator":
-		// no opeland
-	case "Implied":
-		// no opeland
-	case "Immediate":
-		opeland = uint16(c.fetchByte())
-	case "Absolute":
-		opeland = c.fetchWord()
-	case "Absolute, X":
-		opeland = c.fetchWord() + uint16(c.registers.X)
-	case "Absolute, Y":
-		opeland = c.fetchWord() + uint16(c.registers.Y)
-	case "Zeropage":
-		opeland = uint16(c.fetchByte())
-	case "Zeropage, X":
-		opeland = uint16(c.fetchByte() + c.registers.X)
-	case "Zeropage, Y":
-		opeland = uint16(c.fetchByte() + c.registers.Y)
-	case "Relative":
-		baseAddr := uint16(c.fetchByte())
-		if baseAddr < 0x80 {
-			opeland = baseAddr
-		} else {
-			opeland = baseAddr - 0x0100
-		}
-		opeland += c.registers.PC
-	case "(Indirect, X)":
-		baseAddr := uint16(c.fetchByte()) + uint16(c.registers.X)
-		opeland = uint16(c.readByte(baseAddr)) + uint16(c.readByte(baseAddr+1))<<8
-	case "(Indirect), Y":
-		baseAddr := uint16(c.fetchByte())
-		opeland = uint16(c.readByte(baseAddr)) + uint16(c.readByte(baseAddr+1))<<8 + uint16(c.registers.Y)
-	case "(Indirect)":
+// index adds an index register to a base address. The 6502 adds it to the
+// low byte and reads from there before it fixes the high byte, so a read
+// that crosses a page and every write take an extra cycle.
+func (c *CPU) index(base uint16, index uint8, write bool) uint16 {
+	addr := base + uint16(index)
+	if write || addr&0xFF00 != base&0xFF00 {
+		c.readByte(base&0xFF00 | addr&0x00FF)
+	}
+	return addr
+}
+
+// fetchOperand reads the operand of an instruction with the dummy reads
+// the 6502 makes on the way. write is set for instructions that write to
+// the operand.
+func (c *CPU) fetchOperand(mode Addressing, write bool) uint16 {
+	var operand uint16
+	switch mode {
+	case Implied, Accumulator:
+		// no operand
+	case Immediate, Zeropage:
+		operand = uint16(c.fetchByte())
+	case ZeropageX:
+		baseAddr := c.fetchByte()
+		c.readByte(uint16(baseAddr))
+		operand = uint16(baseAddr + c.registers.X)
+	case ZeropageY:
+		baseAddr := c.fetchByte()
+		c.readByte(uint16(baseAddr))
+		operand = uint16(baseAddr + c.registers.Y)
+	case Relative:
+		offset := uint16(c.fetchByte())
+		if offset >= 0x80 {
+			offset -= 0x0100
+		}
+		operand = c.registers.PC + offset
+	case Absolute:
+		operand = c.fetchWord()
+	case AbsoluteX:
+		operand = c.index(c.fetchWord(), c.registers.X, write)
+	case AbsoluteY:
+		operand = c.index(c.fetchWord(), c.registers.Y, write)
+	case IndirectX:
+		baseAddr := c.fetchByte()
+		c.readByte(uint16(baseAddr))
+		baseAddr += c.registers.X
+		operand = uint16(c.readByte(uint16(baseAddr))) + uint16(c.readByte(uint16(baseAddr+1)))<<8
+	case IndirectY:
+		baseAddr := c.fetchByte()
+		operand = uint16(c.readByte(uint16(baseAddr))) + uint16(c.readByte(uint16(baseAddr+1)))<<8
+		operand = c.index(operand, c.registers.Y, write)
+	case Indirect:
 		baseAddr := c.fetchWord()
-		opeland = uint16(c.readByte(baseAddr)) + uint16(c.readByte((baseAddr&0xFF00)|(((baseAddr&0xFF)+1)&0xFF)))<<8
-	default:
-		return 0, fmt.Errorf("unknown addressing %s", addressing)
+		operand = uint16(c.readByte(baseAddr)) + uint16(c.readByte((baseAddr&0xFF00)|(((baseAddr&0xFF)+1)&0xFF)))<<8
 	}
-	return opeland, nil
+	return operand
 }
 
-func (c *CPU) exec(opcode string, opeland uint16, addressing string) error {
-	switch opcode {
-	case "ADC":
-		m := c.getByteByAddressing(opeland, addressing)
-		if c.registers.P.C {
-			m++
-		}
-		c.registers.P.V = c.registers.A < 0x80 && c.registers.A+m > 0x7F
-		c.registers.P.C = c.registers.A+m <= c.registers.A
-		c.registers.A += m
-		c.registers.P.N = isNegative(c.registers.A)
-		c.registers.P.Z = c.registers.A == 0
-	case "SBC":
-		m := c.getByteByAddressing(opeland, addressing)
-		if c.registers.P.C {
-			m++
-		}
-		c.registers.P.V = c.registers.A > 0x7F && c.registers.A-m < 0x80
-		c.registers.P.C = c.registers.A-m >= c.registers.A
-		c.registers.A -= m
-		c.registers.P.N = isNegative(c.registers.A)
-		c.registers.P.Z = c.registers.A == 0
-	case "AND":
-		c.registers.A &= c.getByteByAddressing(opeland, addressing)
-		c.registers.P.N = isNegative(c.registers.A)
-		c.registers.P.Z = c.registers.A == 0
-	case "ORA":
-		c.registers.A |= c.getByteByAddressing(opeland, addressing)
-		c.registers.P.N = isNegative(c.registers.A)
-		c.registers.P.Z = c.registers.A == 0
-	case "EOR":
-		c.registers.A ^= c.getByteByAddressing(opeland, addressing)
-		c.registers.P.N = isNegative(c.registers.A)
-		c.registers.P.Z = c.registers.A == 0
-	case "ASL":
-		if addressing == "Accumulator" {
-			c.registers.P.C = nthBit(c.registers.A, 7) == 1
-			c.registers.A <<= 1
-			c.registers.P.N = isNegative(c.registers.A)
-			c.registers.P.Z = c.registers.A == 0
-		} else {
-			data := c.readByte(opeland)
-			c.registers.P.C = nthBit(data, 7) == 1
-			data <<= 1
-			c.writeByte(opeland, data)
-			c.registers.P.N = isNegative(data)
-			c.registers.P.Z = data == 0
-		}
-	case "LSR":
-		if addressing == "Accumulator" {
-			c.registers.P.C = nthBit(c.registers.A, 0) == 1
-			c.registers.A >>= 1
-			c.registers.P.N = isNegative(c.registers.A)
-			c.registers.P.Z = c.registers.A == 0
-		} else {
-			data := c.readByte(opeland)
-			c.registers.P.C = nthBit(data, 0) == 1
-			data >>= 1
-			c.writeByte(opeland, data)
-			c.registers.P.N = isNegative(data)
-			c.registers.P.Z = data == 0
-		}
-	case "ROL":
-		if addressing == "Accumulator" {
-			b := nthBit(c.registers.A, 7)
-			c.registers.P.C = b == 1
-			c.registers.A = c.registers.A<<1 + b
-			c.registers.P.N = isNegative(c.registers.A)
-			c.registers.P.Z = c.registers.A == 0
-		} else {
-			data := c.readByte(opeland)
-			b := nthBit(data, 7)
-			c.registers.P.C = b == 1
-			data = data<<1 + b
-			c.writeByte(opeland, data)
-			c.registers.P.N = isNegative(data)
-			c.registers.P.Z = data == 0
-		}
-	case "ROR":
-		if addressing == "Accumulator" {
-			b := nthBit(c.registers.A, 0)
-			c.registers.P.C = b == 1
-			c.registers.A = c.registers.A>>1 + b<<7
-			c.registers.P.N = isNegative(c.registers.A)
-			c.registers.P.Z = c.registers.A == 0
-		} else {
-			data := c.readByte(opeland)
-			b := nthBit(data, 0)
-			c.registers.P.C = b == 1
-			data = data>>1 + b<<7
-			c.writeByte(opeland, data)
-			c.registers.P.N = isNegative(data)
-			c.registers.P.Z = data == 0
-		}
-	case "BCC":
-		if !c.registers.P.C {
-			c.registers.PC = opeland
-		}
-	case "BCS":
-		if c.registers.P.C {
-			c.registers.PC = opeland
-		}
-	case "BNE":
-		if !c.registers.P.Z {
-			c.registers.PC = opeland
-		}
-	case "BEQ":
-		if c.registers.P.Z {
-			c.registers.PC = opeland
-		}
-	case "BVC":
-		if !c.registers.P.V {
-			c.registers.PC = opeland
-		}
-	case "BVS":
-		if c.registers.P.V {
-			c.registers.PC = opeland
-		}
-	case "BPL":
-		if !c.registers.P.N {
-			c.registers.PC = opeland
-		}
-	case "BMI":
-		if c.registers.P.N {
-			c.registers.PC = opeland
-		}
-	case "BIT":
-		data := c.readByte(opeland)
-		c.registers.P.Z = (c.registers.A & data) == 0
-		c.registers.P.N = nthBit(data, 7) == 1
-		c.registers.P.V = nthBit(data, 6) == 1
-	case "JMP":
-		c.registers.PC = opeland
-	case "JSR":
-		pc := c.registers.PC - 1
-		c.push(uint8(pc >> 8))
-		c.push(uint8(pc))
-	case "RTS":
-		c.registers.PC = uint16(c.pop()) + uint16(c.pop())<<8 + 1
-	case "BRK": // TODO: 未検証
-		if !c.registers.P.I {
-			c.registers.P.B = true
-			c.registers.PC++
-			c.push(uint8(c.registers.PC >> 8))
-			c.push(uint8(c.registers.PC))
-			c.push(c.registers.P.Uint8())
-			c.registers.P.I = true
-			c.registers.PC = c.readWord(0xFFFE)
-		}
-	case "RTI":
-		c.registers.P.SetByUint8(c.pop())
-		c.registers.PC = uint16(c.pop()) + uint16(c.pop())<<8
-	case "CMP":
-		data := c.registers.A - c.getByteByAddressing(opeland, addressing)
-		c.registers.P.N = isNegative(data)
-		c.registers.P.Z = data == 0
-		c.registers.P.C = data >= c.registers.A
-	case "CPX":
-		data := c.registers.X - c.getByteByAddressing(opeland, addressing)
-		c.registers.P.N = isNegative(data)
-		c.registers.P.Z = data == 0
-		c.registers.P.C = data >= c.registers.X
-	case "CPY":
-		data := c.registers.Y - c.getByteByAddressing(opeland, addressing)
-		c.registers.P.N = isNegative(data)
-		c.registers.P.Z = data == 0
-		c.registers.P.C = data >= c.registers.Y
-	case "INC":
-		m := c.readByte(opeland) + 1
-		c.registers.P.N = isNegative(m)
-		c.registers.P.Z = m == 0
-		c.writeByte(opeland, m)
-	case "DEC":
-		m := c.readByte(opeland) - 1
-		c.registers.P.N = isNegative(m)
-		c.registers.P.Z = m == 0
-		c.writeByte(opeland, m)
-	case "INX":
-		c.registers.X++
-		c.registers.P.N = isNegative(c.registers.X)
-		c.registers.P.Z = c.registers.X == 0
-	case "DEX":
-		c.registers.X--
-		c.registers.P.N = isNegative(c.registers.X)
-		c.registers.P.Z = c.registers.X == 0
-	case "INY":
-		c.registers.Y++
-		c.registers.P.N = isNegative(c.registers.Y)
-		c.registers.P.Z = c.registers.Y == 0
-	case "DEY":
-		c.registers.Y--
-		c.registers.P.N = isNegative(c.registers.Y)
-		c.registers.P.Z = c.registers.Y == 0
-	case "CLC":
-		c.registers.P.C = false
-	case "SEC":
-		c.registers.P.C = true
-	case "CLI":
-		c.registers.P.I = false
-	case "SEI":
-		c.registers.P.I = true
-	case "CLD":
-		c.registers.P.D = false
-	case "SED":
-		c.registers.P.D = true
-	case "CLV":
-		c.registers.P.V = false
-	case "LDA":
-		c.registers.A = c.getByteByAddressing(opeland, addressing)
-		c.registers.P.N = isNegative(c.registers.A)
-		c.registers.P.Z = c.registers.A == 0
-	case "LDX":
-		c.registers.X = c.getByteByAddressing(opeland, addressing)
-		c.registers.P.N = isNegative(c.registers.X)
-		c.registers.P.Z = c.registers.X == 0
-	case "LDY":
-		c.registers.Y = c.getByteByAddressing(opeland, addressing)
-		c.registers.P.N = isNegative(c.registers.Y)
-		c.registers.P.Z = c.registers.Y == 0
-	case "STA":
-		c.writeByte(opeland, c.registers.A)
-	case "STX":
-		c.writeByte(opeland, c.registers.X)
-	case "STY":
-		c.writeByte(opeland, c.registers.Y)
-	case "TXA":
-		c.registers.A = c.registers.X
-		c.registers.P.N = isNegative(c.registers.A)
-		c.registers.P.Z = c.registers.A == 0
-	case "TAX":
-		c.registers.X = c.registers.A
-		c.registers.P.N = isNegative(c.registers.X)
-		c.registers.P.Z = c.registers.X == 0
-	case "TAY":
-		c.registers.Y = c.registers.A
-		c.registers.P.N = isNegative(c.registers.Y)
-		c.registers.P.Z = c.registers.Y == 0
-	case "TYA":
-		c.registers.A = c.registers.Y
-		c.registers.P.N = isNegative(c.registers.A)
-		c.registers.P.Z = c.registers.A == 0
-	case "TSX":
-		c.registers.X = uint8(c.registers.SP)
-		c.registers.P.N = isNegative(c.registers.X)
-		c.registers.P.Z = c.registers.X == 0
-	case "TXS":
-		c.registers.SP = uint16(c.registers.X)
-	case "PHA":
-		c.push(c.registers.A)
-	case "PLA":
-		c.registers.A = c.pop()
-		c.registers.P.N = isNegative(c.registers.A)
-		c.registers.P.Z = c.registers.A == 0
-	case "PHP":
-		c.push(c.registers.P.Uint8())
-	case "PLP":
-		c.registers.P.SetByUint8(c.pop())
-	case "NOP":
-		// no operation
-	default:
-		return fmt.Errorf("unknown opcode: %s", opcode)
-	}
-	return nil
+func (c *CPU) Registers() *Registers {
+	return c.registers
+}
+
+func (c *CPU) Bus() *CPUBus {
+	return c.bus
 }
 
 func (c *CPU) Reset() {
@@ -439,18 +198,30 @@ func (c *CPU) Reset() {
 	c.registers.PC = c.readWord(0xFFFC)
 }
 
+// Run executes an instruction, or enters a pending interrupt, and returns
+// the number of cycles it took, OAM DMA included. Memory accesses, dummy
+// ones too, tick the bus clock as they happen and the internal cycles
+// after the last one are ticked at the end.
 func (c *CPU) Run() (uint, error) {
+	c.bus.cycles = 0
+	if c.interrupt() {
+		c.bus.idle(interruptCycles)
+		return c.bus.cycles, nil
+	}
+
+	if c.trace != nil {
+		if err := c.writeTrace(); err != nil {
+			return 0, err
+		}
+	}
+
 	b := c.fetchByte()
 	i := instructionSets[b]
-	// fmt.Printf("%x %x: %v\n", c.registers.PC-1, b, i)
-	opeland, err := c.fetchOpeland(i.Addressing)
-	if err != nil {
-		return 0, err
-	}
-	err = c.exec(i.Opcode, opeland, i.Addressing)
-	if err != nil {
-		return 0, err
+	if i == nil {
+		return 0, fmt.Errorf("unknown instruction 0x%02X at 0x%04X", b, c.registers.PC-1)
 	}
+	operations[i.Opcode](c, c.fetchOperand(i.Addressing, i.Opcode.writes()), i.Addressing)
+	c.bus.idle(i.Cycle)
 
-	return i.Cycle, nil
+	return c.bus.cycles, nil
 }
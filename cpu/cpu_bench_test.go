@@ -0,0 +1,47 @@
+package cpu
+
+import (
+	"testing"
+	"time"
+)
+
+// NTSC CPU clock in Hz, used to compare the speed with real time.
+const benchClock = 1789773
+
+// benchProgram loops over loads, stores, arithmetic, shifts, indirect
+// addressing, branches and subroutine calls.
+var benchProgram = []uint8{
+	0xA2, 0x00, // 8000: LDX #$00
+	0xBD, 0x00, 0x02, // 8002: LDA $0200,X
+	0x69, 0x03, // 8005: ADC #$03
+	0x9D, 0x00, 0x02, // 8007: STA $0200,X
+	0x0A,       // 800A: ASL A
+	0x51, 0x10, // 800B: EOR ($10),Y
+	0x85, 0x00, // 800D: STA $00
+	0xE8,       // 800F: INX
+	0xD0, 0xF0, // 8010: BNE $8002
+	0x20, 0x18, 0x80, // 8012: JSR $8018
+	0x4C, 0x00, 0x80, // 8015: JMP $8000
+	0xE6, 0x01, // 8018: INC $01
+	0x60, // 801A: RTS
+}
+
+func runBench(b *testing.B, c *CPU) {
+	var cycles uint
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		n, err := c.Run()
+		if err != nil {
+			b.Fatal(err)
+		}
+		cycles += n
+	}
+	elapsed := time.Since(start).Seconds()
+	b.ReportMetric(float64(b.N)/elapsed, "inst/s")
+	b.ReportMetric(float64(cycles)/elapsed/benchClock, "x-realtime")
+}
+
+func BenchmarkRun(b *testing.B) {
+	runBench(b, newTestCPU(b, benchProgram, 0x8000))
+}
@@ -3,6 +3,8 @@ package cpu
 import (
 	"fmt"
 
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/cheat"
 	"github.com/dqn/gones/controller"
 	"github.com/dqn/gones/ppu"
 	"github.com/dqn/gones/ram"
@@ -22,17 +24,131 @@ import (
 // 0xC000～0xFFFF	0x4000	PRG-ROM
 
 type CPUBus struct {
-	ram        *ram.RAM
-	programROM []uint8
-	ppu        *ppu.PPU
-	controller *controller.Controller
+	ram       *ram.RAM
+	cartridge Cartridge
+	ppu       *ppu.PPU
+	apu       *apu.APU
+	ports     *controller.Ports
+	hook      AccessHook
+	cheats    *cheat.List
+	clock     Clock
+	// cycles counts the cycles ticked during the current instruction
+	cycles uint
 }
 
-func NewBus(ram *ram.RAM, programROM []uint8, ppu *ppu.PPU, controller *controller.Controller) *CPUBus {
-	return &CPUBus{ram, programROM, ppu, controller}
+// Clock is ticked once per CPU cycle, before each memory access.
+type Clock interface {
+	Tick()
+}
+
+// Cartridge is mapped from $4020. *cartridge.Cartridge implements it; the
+// NSF player maps a tune instead.
+type Cartridge interface {
+	ReadProgram(addr uint16) uint8
+	// PeekProgram returns what ReadProgram would without side effects.
+	PeekProgram(addr uint16) uint8
+	WriteProgram(addr uint16, data uint8)
+	// PokeProgram writes RAM mapped at addr and leaves registers alone.
+	PokeProgram(addr uint16, data uint8)
+}
+
+// AccessHook is called after every access through the bus.
+type AccessHook func(addr uint16, data uint8, write bool)
+
+func NewBus(ram *ram.RAM, cartridge Cartridge, ppu *ppu.PPU, ports *controller.Ports) *CPUBus {
+	return &CPUBus{ram: ram, cartridge: cartridge, ppu: ppu, ports: ports}
+}
+
+func (b *CPUBus) SetHook(hook AccessHook) {
+	b.hook = hook
+}
+
+func (b *CPUBus) RAM() *ram.RAM {
+	return b.ram
+}
+
+func (b *CPUBus) SetClock(clock Clock) {
+	b.clock = clock
+}
+
+func (b *CPUBus) tick() {
+	b.cycles++
+	if b.clock != nil {
+		b.clock.Tick()
+	}
+}
+
+// idle ticks the cycles of an instruction that were not memory accesses.
+func (b *CPUBus) idle(cycles uint) {
+	for b.cycles < cycles {
+		b.tick()
+	}
+}
+
+// SetAPU maps the APU registers. Without an APU they are ignored.
+func (b *CPUBus) SetAPU(apu *apu.APU) {
+	b.apu = apu
+}
+
+// SetCheats applies the cheats to every read.
+func (b *CPUBus) SetCheats(cheats *cheat.List) {
+	b.cheats = cheats
 }
 
 func (b *CPUBus) Read(addr uint16) uint8 {
+	b.tick()
+	data := b.cheats.Patch(addr, b.read(addr))
+	if b.hook != nil {
+		b.hook(addr, data, false)
+	}
+	return data
+}
+
+func (b *CPUBus) Write(addr uint16, data uint8) {
+	b.tick()
+	b.write(addr, data)
+	if b.hook != nil {
+		b.hook(addr, data, true)
+	}
+}
+
+// Peek returns the value a Read would see without side effects: PPU
+// registers are not cleared or advanced, controllers are not shifted and
+// the hook is not called. Unmapped addresses read as 0.
+func (b *CPUBus) Peek(addr uint16) uint8 {
+	return b.cheats.Patch(addr, b.peek(addr))
+}
+
+func (b *CPUBus) peek(addr uint16) uint8 {
+	switch {
+	case addr < 0x2000:
+		return b.ram[addr%0x0800]
+	case addr < 0x4000:
+		return b.ppu.PeekRegister(0x2000 + addr%8)
+	case addr == 0x4015:
+		if b.apu != nil {
+			return b.apu.PeekStatus()
+		}
+	case addr == 0x4016 || addr == 0x4017:
+		return b.ports.Peek(addr)
+	case addr >= 0x4020:
+		return b.cartridge.PeekProgram(addr)
+	}
+	return 0
+}
+
+// Poke writes memory without side effects. PPU, I/O and cartridge
+// registers are left untouched.
+func (b *CPUBus) Poke(addr uint16, data uint8) {
+	switch {
+	case addr < 0x2000:
+		b.ram[addr%0x0800] = data
+	case addr >= 0x4020:
+		b.cartridge.PokeProgram(addr, data)
+	}
+}
+
+func (b *CPUBus) read(addr uint16) uint8 {
 	switch {
 	case addr >= 0x0000 && addr < 0x0800:
 		return b.ram[addr]
@@ -42,22 +158,22 @@ func (b *CPUBus) Read(addr uint16) uint8 {
 		return b.ppu.ReadRegister(addr)
 	case addr >= 0x2008 && addr < 0x4000:
 		return b.ppu.ReadRegister(addr - 0x0008)
-	case addr == 0x4016:
-		return b.controller.ReadButton()
-	case addr >= 0xC000 && addr <= 0xFFFF:
-		if len(b.programROM) <= 0x4000 {
-			return b.programROM[addr-0xC000]
+	case addr == 0x4015:
+		if b.apu != nil {
+			return b.apu.ReadStatus()
 		}
-		return b.programROM[addr-0x8000]
-	case addr >= 0x8000 && addr <= 0xFFFF:
-		return b.programROM[addr-0x8000]
+		return 0
+	case addr == 0x4016 || addr == 0x4017:
+		return b.ports.Read(addr)
+	case addr >= 0x4020:
+		return b.cartridge.ReadProgram(addr)
 	default:
 		fmt.Printf("!!! cpu bus / Read 0x%x\n", addr)
 		panic(1)
 	}
 }
 
-func (b *CPUBus) Write(addr uint16, data uint8) {
+func (b *CPUBus) write(addr uint16, data uint8) {
 	switch {
 	case addr >= 0x0000 && addr < 0x0800:
 		b.ram[addr] = data
@@ -68,12 +184,23 @@ func (b *CPUBus) Write(addr uint16, data uint8) {
 	case addr >= 0x2008 && addr < 0x4000:
 		b.ppu.WriteRegister(addr-0x0008, data)
 	case addr == 0x4014:
+		// the CPU is halted for a cycle, then each byte of the page is
+		// read and written to OAMDATA on the next cycle
+		b.tick()
 		baseAddr := uint16(data) << 8
-		b.ppu.DMA(b.ram[baseAddr : baseAddr+0x0100])
+		for i := uint16(0); i < 0x0100; i++ {
+			v := b.Read(baseAddr | i)
+			b.tick()
+			b.ppu.WriteRegister(0x2004, v)
+		}
+	case addr >= 0x4000 && addr < 0x4014, addr == 0x4015, addr == 0x4017:
+		if b.apu != nil {
+			b.apu.WriteRegister(addr, data)
+		}
 	case addr == 0x4016:
-		b.controller.Clear()
-	case addr >= 0x8000 && addr <= 0xFFFF:
-		b.programROM[addr-0x8000] = data
+		b.ports.Write(data)
+	case addr >= 0x4020:
+		b.cartridge.WriteProgram(addr, data)
 	default:
 		fmt.Printf("!!! cpu bus / Write 0x%x\n", addr)
 		panic(1)
@@ -0,0 +1,280 @@
+package cpu
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dqn/gones/cartridge"
+	"github.com/dqn/gones/controller"
+	"github.com/dqn/gones/ppu"
+	"github.com/dqn/gones/ram"
+)
+
+// brkVector is where the tests point IRQ/BRK.
+const brkVector = 0x9000
+
+// newTestCPU returns a CPU about to run program from $8000, with IRQ and
+// BRK going to irqVector.
+func newTestCPU(tb testing.TB, program []uint8, irqVector uint16) *CPU {
+	tb.Helper()
+	rom := make([]uint8, 0x10+0x8000+0x2000)
+	copy(rom, "NES\x1a\x02\x01")
+	prg := rom[0x10 : 0x10+0x8000]
+	copy(prg, program)
+	copy(prg[0x7FFA:], []uint8{0x00, 0x80, 0x00, 0x80, uint8(irqVector), uint8(irqVector >> 8)})
+
+	cart, err := cartridge.Parse(rom)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	p := ppu.New(ppu.NewBus(cart))
+	return New(NewBus(&ram.RAM{}, cart, p, controller.NewPorts(nil, nil, nil)))
+}
+
+// run executes n instructions.
+func run(t *testing.T, c *CPU, n int) *Registers {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := c.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c.Registers()
+}
+
+func TestJSR(t *testing.T) {
+	c := newTestCPU(t, []uint8{
+		0x20, 0x10, 0x80, // JSR $8010
+	}, brkVector)
+	r := run(t, c, 1)
+	if r.PC != 0x8010 {
+		t.Errorf("PC = %04X, want 8010", r.PC)
+	}
+	if hi, lo := c.readByte(0x01FD), c.readByte(0x01FC); hi != 0x80 || lo != 0x02 {
+		t.Errorf("pushed %02X%02X, want 8002", hi, lo)
+	}
+}
+
+func TestADCSBC(t *testing.T) {
+	tests := []struct {
+		name         string
+		op           uint8
+		a, m         uint8
+		carry        bool
+		want         uint8
+		wantC, wantV bool
+	}{
+		{"ADC", 0x69, 0x50, 0x10, false, 0x60, false, false},
+		{"ADC overflow", 0x69, 0x50, 0x50, false, 0xA0, false, true},
+		{"ADC carry out", 0x69, 0xFF, 0x01, false, 0x00, true, false},
+		{"ADC carry in", 0x69, 0x7F, 0x00, true, 0x80, false, true},
+		{"ADC negative overflow", 0x69, 0x80, 0xFF, false, 0x7F, true, true},
+		{"SBC", 0xE9, 0x50, 0x10, true, 0x40, true, false},
+		{"SBC borrow", 0xE9, 0x50, 0xF0, true, 0x60, false, false},
+		{"SBC overflow", 0xE9, 0x50, 0xB0, true, 0xA0, false, true},
+		{"SBC borrow in", 0xE9, 0x50, 0x50, false, 0xFF, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCarry := uint8(0x18) // CLC
+			if tt.carry {
+				setCarry = 0x38 // SEC
+			}
+			c := newTestCPU(t, []uint8{
+				0xA9, tt.a, // LDA #a
+				setCarry,
+				tt.op, tt.m, // ADC/SBC #m
+			}, brkVector)
+			r := run(t, c, 3)
+			if r.A != tt.want || r.P.C != tt.wantC || r.P.V != tt.wantV {
+				t.Errorf("A = %02X C = %v V = %v, want %02X %v %v", r.A, r.P.C, r.P.V, tt.want, tt.wantC, tt.wantV)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, m                uint8
+		wantC, wantZ, wantN bool
+	}{
+		{0x10, 0x10, true, true, false},
+		{0x20, 0x10, true, false, false},
+		{0x10, 0x20, false, false, true},
+		{0xFF, 0x00, true, false, true},
+	}
+	for _, tt := range tests {
+		c := newTestCPU(t, []uint8{
+			0xA9, tt.a, // LDA #a
+			0xC9, tt.m, // CMP #m
+		}, brkVector)
+		r := run(t, c, 2)
+		if r.P.C != tt.wantC || r.P.Z != tt.wantZ || r.P.N != tt.wantN {
+			t.Errorf("CMP %02X with %02X: C = %v Z = %v N = %v, want %v %v %v", tt.m, tt.a, r.P.C, r.P.Z, r.P.N, tt.wantC, tt.wantZ, tt.wantN)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	c := newTestCPU(t, []uint8{
+		0xA9, 0x81, // LDA #$81
+		0x18, // CLC
+		0x2A, // ROL A
+		0x2A, // ROL A
+		0x6A, // ROR A
+	}, brkVector)
+	r := run(t, c, 3)
+	if r.A != 0x02 || !r.P.C {
+		t.Errorf("ROL: A = %02X C = %v, want 02 true", r.A, r.P.C)
+	}
+	r = run(t, c, 1)
+	if r.A != 0x05 || r.P.C {
+		t.Errorf("ROL with carry: A = %02X C = %v, want 05 false", r.A, r.P.C)
+	}
+	r = run(t, c, 1)
+	if r.A != 0x02 || !r.P.C {
+		t.Errorf("ROR: A = %02X C = %v, want 02 true", r.A, r.P.C)
+	}
+}
+
+func TestStack(t *testing.T) {
+	c := newTestCPU(t, []uint8{
+		0xA2, 0x00, // LDX #$00
+		0x9A,       // TXS
+		0xA9, 0x42, // LDA #$42
+		0x48, // PHA
+		0x68, // PLA
+	}, brkVector)
+	r := run(t, c, 2)
+	if r.SP != 0x0100 {
+		t.Errorf("TXS: SP = %04X, want 0100", r.SP)
+	}
+	r = run(t, c, 2)
+	if r.SP != 0x01FF || c.readByte(0x0100) != 0x42 {
+		t.Errorf("PHA: SP = %04X, $0100 = %02X, want 01FF 42", r.SP, c.readByte(0x0100))
+	}
+	r = run(t, c, 1)
+	if r.SP != 0x0100 || r.A != 0x42 {
+		t.Errorf("PLA: SP = %04X A = %02X, want 0100 42", r.SP, r.A)
+	}
+}
+
+func TestIndirectZeroPageWrap(t *testing.T) {
+	setup := []uint8{
+		0xA9, 0x12, // LDA #$12
+		0x85, 0xFF, // STA $FF
+		0xA9, 0x03, // LDA #$03
+		0x85, 0x00, // STA $00
+		0xA9, 0x77, // LDA #$77
+		0x8D, 0x12, 0x03, // STA $0312
+		0x8D, 0x13, 0x03, // STA $0313
+		0xA9, 0x00, // LDA #$00
+	}
+	// the pointer is read from $FF and $00, not $0100
+	tests := []struct {
+		name string
+		code []uint8
+	}{
+		{"($FE,X)", []uint8{0xA2, 0x01, 0xA1, 0xFE}}, // LDX #$01, LDA ($FE,X)
+		{"($FF),Y", []uint8{0xA0, 0x01, 0xB1, 0xFF}}, // LDY #$01, LDA ($FF),Y
+	}
+	for _, tt := range tests {
+		c := newTestCPU(t, append(append([]uint8(nil), setup...), tt.code...), brkVector)
+		if r := run(t, c, 10); r.A != 0x77 {
+			t.Errorf("LDA %s = %02X, want 77", tt.name, r.A)
+		}
+	}
+}
+
+func TestBRKWithInterruptsDisabled(t *testing.T) {
+	c := newTestCPU(t, []uint8{
+		0x78, // SEI
+		0x00, // BRK
+	}, brkVector)
+	r := run(t, c, 2)
+	if r.PC != brkVector {
+		t.Errorf("PC = %04X, want %04X", r.PC, brkVector)
+	}
+	if p := c.readByte(0x01FB); p&0x10 == 0 {
+		t.Errorf("pushed P = %02X without B", p)
+	}
+}
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup []uint8
+		code  []uint8
+		want  uint
+	}{
+		{"LDA abs,X", []uint8{0xA2, 0x01}, []uint8{0xBD, 0x00, 0x02}, 4},
+		{"LDA abs,X across a page", []uint8{0xA2, 0x01}, []uint8{0xBD, 0xFF, 0x02}, 5},
+		{"LDA (zp),Y across a page", []uint8{0xA9, 0xFF, 0x85, 0x10, 0xA0, 0x01}, []uint8{0xB1, 0x10}, 6},
+		{"STA abs,X", []uint8{0xA2, 0x01}, []uint8{0x9D, 0x00, 0x02}, 5},
+		{"INC abs", nil, []uint8{0xEE, 0x00, 0x02}, 6},
+		{"ASL abs,X", []uint8{0xA2, 0x01}, []uint8{0x1E, 0x00, 0x02}, 7},
+		{"BNE not taken", []uint8{0xA2, 0x00}, []uint8{0xD0, 0x10}, 2},
+		{"BNE", []uint8{0xA2, 0x01}, []uint8{0xD0, 0x10}, 3},
+		{"BNE across a page", []uint8{0xA2, 0x01}, []uint8{0xD0, 0x80}, 4},
+		// the DMA halts the CPU for 513 cycles
+		{"STA $4014", []uint8{0xA9, 0x02}, []uint8{0x8D, 0x14, 0x40}, 4 + 513},
+	}
+	for _, tt := range tests {
+		c := newTestCPU(t, append(append([]uint8(nil), tt.setup...), tt.code...), brkVector)
+		run(t, c, len(tt.setup)/2)
+		n, err := c.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.want {
+			t.Errorf("%s took %d cycles, want %d", tt.name, n, tt.want)
+		}
+	}
+}
+
+type tickCounter uint
+
+func (t *tickCounter) Tick() { *t++ }
+
+func TestWriteCycles(t *testing.T) {
+	tests := []struct {
+		name string
+		code []uint8
+		want []uint
+	}{
+		{"STA abs", []uint8{0x8D, 0x00, 0x02}, []uint{4}},
+		{"STA abs,X", []uint8{0x9D, 0x00, 0x02}, []uint{5}},
+		{"STA (zp),Y", []uint8{0x91, 0x10}, []uint{6}},
+		{"INC abs", []uint8{0xEE, 0x00, 0x02}, []uint{5, 6}},
+		{"ASL abs,X", []uint8{0x1E, 0x00, 0x02}, []uint{6, 7}},
+	}
+	for _, tt := range tests {
+		c := newTestCPU(t, tt.code, brkVector)
+		var ticks tickCounter
+		var got []uint
+		c.bus.SetClock(&ticks)
+		c.bus.SetHook(func(addr uint16, _ uint8, write bool) {
+			if write {
+				got = append(got, uint(ticks))
+			}
+		})
+		run(t, c, 1)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s wrote on cycles %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOAMDMA(t *testing.T) {
+	c := newTestCPU(t, []uint8{
+		0xA9, 0x80, // LDA #$80
+		0x8D, 0x14, 0x40, // STA $4014
+	}, brkVector)
+	run(t, c, 2)
+	// the page is read through the bus, ROM included
+	for i, want := range []uint8{0xA9, 0x80, 0x8D} {
+		if got := c.bus.ppu.PeekOAM(uint8(i)); got != want {
+			t.Errorf("OAM[%d] = %02X, want %02X", i, got, want)
+		}
+	}
+}
@@ -1,162 +1,293 @@
 package cpu
 
+// Addressing is an addressing mode of an instruction.
+type Addressing uint8
+
+const (
+	Implied Addressing = iota
+	Accumulator
+	Immediate
+	Zeropage
+	ZeropageX
+	ZeropageY
+	Relative
+	Absolute
+	AbsoluteX
+	AbsoluteY
+	Indirect
+	IndirectX
+	IndirectY
+)
+
+var addressingNames = [...]string{
+	Implied:     "Implied",
+	Accumulator: "Accumulator",
+	Immediate:   "Immediate",
+	Zeropage:    "Zeropage",
+	ZeropageX:   "Zeropage, X",
+	ZeropageY:   "Zeropage, Y",
+	Relative:    "Relative",
+	Absolute:    "Absolute",
+	AbsoluteX:   "Absolute, X",
+	AbsoluteY:   "Absolute, Y",
+	Indirect:    "(Indirect)",
+	IndirectX:   "(Indirect, X)",
+	IndirectY:   "(Indirect), Y",
+}
+
+func (a Addressing) String() string {
+	return addressingNames[a]
+}
+
+// Opcode is the operation of an instruction.
+type Opcode uint8
+
+const (
+	ADC Opcode = iota
+	AND
+	ASL
+	BCC
+	BCS
+	BEQ
+	BIT
+	BMI
+	BNE
+	BPL
+	BRK
+	BVC
+	BVS
+	CLC
+	CLD
+	CLI
+	CLV
+	CMP
+	CPX
+	CPY
+	DEC
+	DEX
+	DEY
+	EOR
+	INC
+	INX
+	INY
+	JMP
+	JSR
+	LDA
+	LDX
+	LDY
+	LSR
+	NOP
+	ORA
+	PHA
+	PHP
+	PLA
+	PLP
+	ROL
+	ROR
+	RTI
+	RTS
+	SBC
+	SEC
+	SED
+	SEI
+	STA
+	STX
+	STY
+	TAX
+	TAY
+	TSX
+	TXA
+	TXS
+	TYA
+)
+
+var opcodeNames = [...]string{
+	"ADC", "AND", "ASL", "BCC", "BCS", "BEQ", "BIT", "BMI",
+	"BNE", "BPL", "BRK", "BVC", "BVS", "CLC", "CLD", "CLI",
+	"CLV", "CMP", "CPX", "CPY", "DEC", "DEX", "DEY", "EOR",
+	"INC", "INX", "INY", "JMP", "JSR", "LDA", "LDX", "LDY",
+	"LSR", "NOP", "ORA", "PHA", "PHP", "PLA", "PLP", "ROL",
+	"ROR", "RTI", "RTS", "SBC", "SEC", "SED", "SEI", "STA",
+	"STX", "STY", "TAX", "TAY", "TSX", "TXA", "TXS", "TYA",
+}
+
+func (o Opcode) String() string {
+	return opcodeNames[o]
+}
+
+// writes reports whether the operation writes to its operand.
+func (o Opcode) writes() bool {
+	switch o {
+	case ASL, DEC, INC, LSR, ROL, ROR, STA, STX, STY:
+		return true
+	}
+	return false
+}
+
 type InstructionSet struct {
-	Opcode     string
-	Addressing string
+	Opcode     Opcode
+	Addressing Addressing
 	Bytes      uint8
 	Cycle      uint
 }
 
-var instructionSets = map[byte]*InstructionSet{
-	0xA9: {"LDA", "Immediate", 2, 2},
-	0xA5: {"LDA", "Zeropage", 2, 3},
-	0xB5: {"LDA", "Zeropage, X", 2, 4},
-	0xAD: {"LDA", "Absolute", 3, 4},
-	0xBD: {"LDA", "Absolute, X", 3, 4},
-	0xB9: {"LDA", "Absolute, Y", 3, 4},
-	0xA1: {"LDA", "(Indirect, X)", 2, 6},
-	0xB1: {"LDA", "(Indirect), Y", 2, 5},
-	0xA2: {"LDX", "Immediate", 2, 2},
-	0xA6: {"LDX", "Zeropage", 2, 3},
-	0xB6: {"LDX", "Zeropage, Y", 2, 4},
-	0xAE: {"LDX", "Absolute", 3, 4},
-	0xBE: {"LDX", "Absolute, Y", 3, 4},
-	0xA0: {"LDY", "Immediate", 2, 2},
-	0xA4: {"LDY", "Zeropage", 2, 3},
-	0xB4: {"LDY", "Zeropage, X", 2, 4},
-	0xAC: {"LDY", "Absolute", 3, 4},
-	0xBC: {"LDY", "Absolute, X", 3, 4},
-	0x85: {"STA", "Zeropage", 2, 3},
-	0x95: {"STA", "Zeropage, X", 2, 4},
-	0x8D: {"STA", "Absolute", 3, 4},
-	0x9D: {"STA", "Absolute, X", 3, 5},
-	0x99: {"STA", "Absolute, Y", 3, 5},
-	0x81: {"STA", "(Indirect, X)", 2, 6},
-	0x91: {"STA", "(Indirect), Y", 2, 6},
-	0x86: {"STX", "Zeropage", 2, 3},
-	0x96: {"STX", "Zeropage, Y", 2, 4},
-	0x8E: {"STX", "Absolute", 3, 4},
-	0x84: {"STY", "Zeropage", 2, 3},
-	0x94: {"STY", "Zeropage, X", 2, 4},
-	0x8C: {"STY", "Absolute", 3, 4},
-	0xAA: {"TAX", "Implied", 1, 2},
-	0xA8: {"TAY", "Implied", 1, 2},
-	0xBA: {"TSX", "Implied", 1, 2},
-	0x8A: {"TXA", "Implied", 1, 2},
-	0x9A: {"TXS", "Implied", 1, 2},
-	0x98: {"TYA", "Implied", 1, 2},
-	0x69: {"ADC", "Immediate", 2, 2},
-	0x65: {"ADC", "Zeropage", 2, 3},
-	0x75: {"ADC", "Zeropage, X", 2, 4},
-	0x6D: {"ADC", "Absolute", 3, 4},
-	0x7D: {"ADC", "Absolute, X", 3, 4},
-	0x79: {"ADC", "Absolute, Y", 3, 4},
-	0x61: {"ADC", "(Indirect, X)", 2, 6},
-	0x71: {"ADC", "(Indirect), Y", 2, 5},
-	0x29: {"AND", "Immediate", 2, 2},
-	0x25: {"AND", "Zeropage", 2, 3},
-	0x35: {"AND", "Zeropage, X", 2, 4},
-	0x2D: {"AND", "Absolute", 3, 4},
-	0x3D: {"AND", "Absolute, X", 3, 4},
-	0x39: {"AND", "Absolute, Y", 3, 4},
-	0x21: {"AND", "(Indirect, X)", 2, 6},
-	0x31: {"AND", "(Indirect), Y", 2, 5},
-	0x0A: {"ASL", "Accumulator", 1, 2},
-	0x06: {"ASL", "Zeropage", 2, 5},
-	0x16: {"ASL", "Zeropage, X", 2, 6},
-	0x0E: {"ASL", "Absolute", 3, 6},
-	0x1E: {"ASL", "Absolute, X", 3, 7},
-	0x24: {"BIT", "Zeropage", 2, 3},
-	0x2C: {"BIT", "Absolute", 3, 4},
-	0xC9: {"CMP", "Immediate", 2, 2},
-	0xC5: {"CMP", "Zeropage", 2, 3},
-	0xD5: {"CMP", "Zeropage, X", 2, 4},
-	0xCD: {"CMP", "Absolute", 3, 4},
-	0xDD: {"CMP", "Absolute, X", 3, 4},
-	0xD9: {"CMP", "Absolute, Y", 3, 4},
-	0xC1: {"CMP", "(Indirect, X)", 2, 6},
-	0xD1: {"CMP", "(Indirect), Y", 2, 5},
-	0xE0: {"CPX", "Immediate", 2, 2},
-	0xE4: {"CPX", "Zeropage", 2, 3},
-	0xEC: {"CPX", "Absolute", 3, 4},
-	0xC0: {"CPY", "Immediate", 2, 2},
-	0xC4: {"CPY", "Zeropage", 2, 3},
-	0xCC: {"CPY", "Absolute", 3, 4},
-	0xC6: {"DEC", "Zeropage", 2, 5},
-	0xD6: {"DEC", "Zeropage, X", 2, 6},
-	0xCE: {"DEC", "Absolute", 3, 6},
-	0xDE: {"DEC", "Absolute, X", 3, 7},
-	0xCA: {"DEX", "Implied", 1, 2},
-	0x88: {"DEY", "Implied", 1, 2},
-	0x49: {"EOR", "Immediate", 2, 2},
-	0x45: {"EOR", "Zeropage", 2, 3},
-	0x55: {"EOR", "Zeropage, X", 2, 4},
-	0x4D: {"EOR", "Absolute", 3, 4},
-	0x5D: {"EOR", "Absolute, X", 3, 4},
-	0x59: {"EOR", "Absolute, Y", 3, 4},
-	0x41: {"EOR", "(Indirect, X)", 2, 6},
-	0x51: {"EOR", "(Indirect), Y", 2, 5},
-	0xE6: {"INC", "Zeropage", 2, 5},
-	0xF6: {"INC", "Zeropage, X", 2, 6},
-	0xEE: {"INC", "Absolute", 3, 6},
-	0xFE: {"INC", "Absolute, X", 3, 7},
-	0xE8: {"INX", "Implied", 1, 2},
-	0xC8: {"INY", "Implied", 1, 2},
-	0x4A: {"LSR", "Accumulator", 1, 2},
-	0x46: {"LSR", "Zeropage", 2, 5},
-	0x56: {"LSR", "Zeropage, X", 2, 6},
-	0x4E: {"LSR", "Absolute", 3, 6},
-	0x5E: {"LSR", "Absolute, X", 3, 7},
-	0x09: {"ORA", "Immediate", 2, 2},
-	0x05: {"ORA", "Zeropage", 2, 3},
-	0x15: {"ORA", "Zeropage, X", 2, 4},
-	0x0D: {"ORA", "Absolute", 3, 4},
-	0x1D: {"ORA", "Absolute, X", 3, 4},
-	0x19: {"ORA", "Absolute, Y", 3, 4},
-	0x01: {"ORA", "(Indirect, X)", 2, 6},
-	0x11: {"ORA", "(Indirect), Y", 2, 5},
-	0x2A: {"ROL", "Accumulator", 1, 2},
-	0x26: {"ROL", "Zeropage", 2, 5},
-	0x36: {"ROL", "Zeropage, X", 2, 6},
-	0x2E: {"ROL", "Absolute", 3, 6},
-	0x3E: {"ROL", "Absolute, X", 3, 7},
-	0x6A: {"ROR", "Accumulator", 1, 2},
-	0x66: {"ROR", "Zeropage", 2, 5},
-	0x76: {"ROR", "Zeropage, X", 2, 6},
-	0x6E: {"ROR", "Absolute", 3, 6},
-	0x7E: {"ROR", "Absolute, X", 3, 7},
-	0xE9: {"SBC", "Immediate", 2, 2},
-	0xE5: {"SBC", "Zeropage", 2, 3},
-	0xF5: {"SBC", "Zeropage, X", 2, 4},
-	0xED: {"SBC", "Absolute", 3, 4},
-	0xFD: {"SBC", "Absolute, X", 3, 4},
-	0xF9: {"SBC", "Absolute, Y", 3, 4},
-	0xE1: {"SBC", "(Indirect, X)", 2, 6},
-	0xF1: {"SBC", "(Indirect), Y", 2, 5},
-	0x48: {"PHA", "Implied", 1, 3},
-	0x08: {"PHP", "Implied", 1, 3},
-	0x68: {"PLA", "Implied", 1, 4},
-	0x28: {"PLP", "Implied", 1, 4},
-	0x4C: {"JMP", "Absolute", 3, 3},
-	0x6C: {"JMP", "(Indirect)", 3, 5},
-	0x20: {"JSR", "Absolute", 3, 6},
-	0x60: {"RTS", "Implied", 1, 6},
-	0x40: {"RTI", "Implied", 1, 6},
-	0x90: {"BCC", "Relative", 2, 2},
-	0xB0: {"BCS", "Relative", 2, 2},
-	0xF0: {"BEQ", "Relative", 2, 2},
-	0x30: {"BMI", "Relative", 2, 2},
-	0xD0: {"BNE", "Relative", 2, 2},
-	0x10: {"BPL", "Relative", 2, 2},
-	0x50: {"BVC", "Relative", 2, 2},
-	0x70: {"BVS", "Relative", 2, 2},
-	0x18: {"CLC", "Implied", 1, 2},
-	0xD8: {"CLD", "Implied", 1, 2},
-	0x58: {"CLI", "Implied", 1, 2},
-	0xB8: {"CLV", "Implied", 1, 2},
-	0x38: {"SEC", "Implied", 1, 2},
-	0xF8: {"SED", "Implied", 1, 2},
-	0x78: {"SEI", "Implied", 1, 2},
-	0x00: {"BRK", "Implied", 1, 7},
-	0xEA: {"NOP", "Implied", 1, 2},
+// LookupInstruction returns the instruction set of an opcode.
+func LookupInstruction(opcode uint8) (*InstructionSet, bool) {
+	i := instructionSets[opcode]
+	return i, i != nil
+}
+
+// instructionSets is indexed by the opcode byte. Unofficial opcodes are nil.
+var instructionSets = [256]*InstructionSet{
+	0xA9: {LDA, Immediate, 2, 2},
+	0xA5: {LDA, Zeropage, 2, 3},
+	0xB5: {LDA, ZeropageX, 2, 4},
+	0xAD: {LDA, Absolute, 3, 4},
+	0xBD: {LDA, AbsoluteX, 3, 4},
+	0xB9: {LDA, AbsoluteY, 3, 4},
+	0xA1: {LDA, IndirectX, 2, 6},
+	0xB1: {LDA, IndirectY, 2, 5},
+	0xA2: {LDX, Immediate, 2, 2},
+	0xA6: {LDX, Zeropage, 2, 3},
+	0xB6: {LDX, ZeropageY, 2, 4},
+	0xAE: {LDX, Absolute, 3, 4},
+	0xBE: {LDX, AbsoluteY, 3, 4},
+	0xA0: {LDY, Immediate, 2, 2},
+	0xA4: {LDY, Zeropage, 2, 3},
+	0xB4: {LDY, ZeropageX, 2, 4},
+	0xAC: {LDY, Absolute, 3, 4},
+	0xBC: {LDY, AbsoluteX, 3, 4},
+	0x85: {STA, Zeropage, 2, 3},
+	0x95: {STA, ZeropageX, 2, 4},
+	0x8D: {STA, Absolute, 3, 4},
+	0x9D: {STA, AbsoluteX, 3, 5},
+	0x99: {STA, AbsoluteY, 3, 5},
+	0x81: {STA, IndirectX, 2, 6},
+	0x91: {STA, IndirectY, 2, 6},
+	0x86: {STX, Zeropage, 2, 3},
+	0x96: {STX, ZeropageY, 2, 4},
+	0x8E: {STX, Absolute, 3, 4},
+	0x84: {STY, Zeropage, 2, 3},
+	0x94: {STY, ZeropageX, 2, 4},
+	0x8C: {STY, Absolute, 3, 4},
+	0xAA: {TAX, Implied, 1, 2},
+	0xA8: {TAY, Implied, 1, 2},
+	0xBA: {TSX, Implied, 1, 2},
+	0x8A: {TXA, Implied, 1, 2},
+	0x9A: {TXS, Implied, 1, 2},
+	0x98: {TYA, Implied, 1, 2},
+	0x69: {ADC, Immediate, 2, 2},
+	0x65: {ADC, Zeropage, 2, 3},
+	0x75: {ADC, ZeropageX, 2, 4},
+	0x6D: {ADC, Absolute, 3, 4},
+	0x7D: {ADC, AbsoluteX, 3, 4},
+	0x79: {ADC, AbsoluteY, 3, 4},
+	0x61: {ADC, IndirectX, 2, 6},
+	0x71: {ADC, IndirectY, 2, 5},
+	0x29: {AND, Immediate, 2, 2},
+	0x25: {AND, Zeropage, 2, 3},
+	0x35: {AND, ZeropageX, 2, 4},
+	0x2D: {AND, Absolute, 3, 4},
+	0x3D: {AND, AbsoluteX, 3, 4},
+	0x39: {AND, AbsoluteY, 3, 4},
+	0x21: {AND, IndirectX, 2, 6},
+	0x31: {AND, IndirectY, 2, 5},
+	0x0A: {ASL, Accumulator, 1, 2},
+	0x06: {ASL, Zeropage, 2, 5},
+	0x16: {ASL, ZeropageX, 2, 6},
+	0x0E: {ASL, Absolute, 3, 6},
+	0x1E: {ASL, AbsoluteX, 3, 7},
+	0x24: {BIT, Zeropage, 2, 3},
+	0x2C: {BIT, Absolute, 3, 4},
+	0xC9: {CMP, Immediate, 2, 2},
+	0xC5: {CMP, Zeropage, 2, 3},
+	0xD5: {CMP, ZeropageX, 2, 4},
+	0xCD: {CMP, Absolute, 3, 4},
+	0xDD: {CMP, AbsoluteX, 3, 4},
+	0xD9: {CMP, AbsoluteY, 3, 4},
+	0xC1: {CMP, IndirectX, 2, 6},
+	0xD1: {CMP, IndirectY, 2, 5},
+	0xE0: {CPX, Immediate, 2, 2},
+	0xE4: {CPX, Zeropage, 2, 3},
+	0xEC: {CPX, Absolute, 3, 4},
+	0xC0: {CPY, Immediate, 2, 2},
+	0xC4: {CPY, Zeropage, 2, 3},
+	0xCC: {CPY, Absolute, 3, 4},
+	0xC6: {DEC, Zeropage, 2, 5},
+	0xD6: {DEC, ZeropageX, 2, 6},
+	0xCE: {DEC, Absolute, 3, 6},
+	0xDE: {DEC, AbsoluteX, 3, 7},
+	0xCA: {DEX, Implied, 1, 2},
+	0x88: {DEY, Implied, 1, 2},
+	0x49: {EOR, Immediate, 2, 2},
+	0x45: {EOR, Zeropage, 2, 3},
+	0x55: {EOR, ZeropageX, 2, 4},
+	0x4D: {EOR, Absolute, 3, 4},
+	0x5D: {EOR, AbsoluteX, 3, 4},
+	0x59: {EOR, AbsoluteY, 3, 4},
+	0x41: {EOR, IndirectX, 2, 6},
+	0x51: {EOR, IndirectY, 2, 5},
+	0xE6: {INC, Zeropage, 2, 5},
+	0xF6: {INC, ZeropageX, 2, 6},
+	0xEE: {INC, Absolute, 3, 6},
+	0xFE: {INC, AbsoluteX, 3, 7},
+	0xE8: {INX, Implied, 1, 2},
+	0xC8: {INY, Implied, 1, 2},
+	0x4A: {LSR, Accumulator, 1, 2},
+	0x46: {LSR, Zeropage, 2, 5},
+	0x56: {LSR, ZeropageX, 2, 6},
+	0x4E: {LSR, Absolute, 3, 6},
+	0x5E: {LSR, AbsoluteX, 3, 7},
+	0x09: {ORA, Immediate, 2, 2},
+	0x05: {ORA, Zeropage, 2, 3},
+	0x15: {ORA, ZeropageX, 2, 4},
+	0x0D: {ORA, Absolute, 3, 4},
+	0x1D: {ORA, AbsoluteX, 3, 4},
+	0x19: {ORA, AbsoluteY, 3, 4},
+	0x01: {ORA, IndirectX, 2, 6},
+	0x11: {ORA, IndirectY, 2, 5},
+	0x2A: {ROL, Accumulator, 1, 2},
+	0x26: {ROL, Zeropage, 2, 5},
+	0x36: {ROL, ZeropageX, 2, 6},
+	0x2E: {ROL, Absolute, 3, 6},
+	0x3E: {ROL, AbsoluteX, 3, 7},
+	0x6A: {ROR, Accumulator, 1, 2},
+	0x66: {ROR, Zeropage, 2, 5},
+	0x76: {ROR, ZeropageX, 2, 6},
+	0x6E: {ROR, Absolute, 3, 6},
+	0x7E: {ROR, AbsoluteX, 3, 7},
+	0xE9: {SBC, Immediate, 2, 2},
+	0xE5: {SBC, Zeropage, 2, 3},
+	0xF5: {SBC, ZeropageX, 2, 4},
+	0xED: {SBC, Absolute, 3, 4},
+	0xFD: {SBC, AbsoluteX, 3, 4},
+	0xF9: {SBC, AbsoluteY, 3, 4},
+	0xE1: {SBC, IndirectX, 2, 6},
+	0xF1: {SBC, IndirectY, 2, 5},
+	0x48: {PHA, Implied, 1, 3},
+	0x08: {PHP, Implied, 1, 3},
+	0x68: {PLA, Implied, 1, 4},
+	0x28: {PLP, Implied, 1, 4},
+	0x4C: {JMP, Absolute, 3, 3},
+	0x6C: {JMP, Indirect, 3, 5},
+	0x20: {JSR, Absolute, 3, 6},
+	0x60: {RTS, Implied, 1, 6},
+	0x40: {RTI, Implied, 1, 6},
+	0x90: {BCC, Relative, 2, 2},
+	0xB0: {BCS, Relative, 2, 2},
+	0xF0: {BEQ, Relative, 2, 2},
+	0x30: {BMI, Relative, 2, 2},
+	0xD0: {BNE, Relative, 2, 2},
+	0x10: {BPL, Relative, 2, 2},
+	0x50: {BVC, Relative, 2, 2},
+	0x70: {BVS, Relative, 2, 2},
+	0x18: {CLC, Implied, 1, 2},
+	0xD8: {CLD, Implied, 1, 2},
+	0x58: {CLI, Implied, 1, 2},
+	0xB8: {CLV, Implied, 1, 2},
+	0x38: {SEC, Implied, 1, 2},
+	0xF8: {SED, Implied, 1, 2},
+	0x78: {SEI, Implied, 1, 2},
+	0x00: {BRK, Implied, 1, 7},
+	0xEA: {NOP, Implied, 1, 2},
 }
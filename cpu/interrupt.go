@@ -0,0 +1,55 @@
+package cpu
+
+// https://wiki.nesdev.com/w/index.php/CPU_interrupts
+
+// IRQSource is a device driving the shared IRQ line.
+type IRQSource uint8
+
+const (
+	IRQFrameCounter IRQSource = 1 << iota
+	IRQDMC
+	IRQMapper
+	IRQDisk
+)
+
+const interruptCycles = 7
+
+// NMI requests a non-maskable interrupt before the next instruction.
+func (c *CPU) NMI() {
+	c.nmi = true
+}
+
+// SetIRQ asserts or releases the IRQ line for a source. The interrupt is
+// taken before each instruction while any source asserts it and the I
+// flag is clear.
+func (c *CPU) SetIRQ(source IRQSource, asserted bool) {
+	if asserted {
+		c.irq |= source
+	} else {
+		c.irq &^= source
+	}
+}
+
+// interrupt runs a pending interrupt and reports whether there was one.
+func (c *CPU) interrupt() bool {
+	var vector uint16
+	switch {
+	case c.nmi:
+		c.nmi = false
+		vector = 0xFFFA
+	case c.irq != 0 && !c.registers.P.I:
+		vector = 0xFFFE
+	default:
+		return false
+	}
+	// the opcode is read and dropped twice
+	c.readByte(c.registers.PC)
+	c.readByte(c.registers.PC)
+	c.push(uint8(c.registers.PC >> 8))
+	c.push(uint8(c.registers.PC))
+	// the B flag is only pushed set by BRK and PHP
+	c.push(c.registers.P.Uint8() &^ 0b00010000)
+	c.registers.P.I = true
+	c.registers.PC = c.readWord(vector)
+	return true
+}
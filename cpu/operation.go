@@ -0,0 +1,291 @@
+package cpu
+
+type operation func(c *CPU, operand uint16, mode Addressing)
+
+// operations is indexed by Opcode.
+var operations = [...]operation{
+	ADC: (*CPU).adc,
+	AND: (*CPU).and,
+	ASL: (*CPU).asl,
+	BCC: (*CPU).bcc,
+	BCS: (*CPU).bcs,
+	BEQ: (*CPU).beq,
+	BIT: (*CPU).bit,
+	BMI: (*CPU).bmi,
+	BNE: (*CPU).bne,
+	BPL: (*CPU).bpl,
+	BRK: (*CPU).brk,
+	BVC: (*CPU).bvc,
+	BVS: (*CPU).bvs,
+	CLC: (*CPU).clc,
+	CLD: (*CPU).cld,
+	CLI: (*CPU).cli,
+	CLV: (*CPU).clv,
+	CMP: (*CPU).cmp,
+	CPX: (*CPU).cpx,
+	CPY: (*CPU).cpy,
+	DEC: (*CPU).dec,
+	DEX: (*CPU).dex,
+	DEY: (*CPU).dey,
+	EOR: (*CPU).eor,
+	INC: (*CPU).inc,
+	INX: (*CPU).inx,
+	INY: (*CPU).iny,
+	JMP: (*CPU).jmp,
+	JSR: (*CPU).jsr,
+	LDA: (*CPU).lda,
+	LDX: (*CPU).ldx,
+	LDY: (*CPU).ldy,
+	LSR: (*CPU).lsr,
+	NOP: (*CPU).nop,
+	ORA: (*CPU).ora,
+	PHA: (*CPU).pha,
+	PHP: (*CPU).php,
+	PLA: (*CPU).pla,
+	PLP: (*CPU).plp,
+	ROL: (*CPU).rol,
+	ROR: (*CPU).ror,
+	RTI: (*CPU).rti,
+	RTS: (*CPU).rts,
+	SBC: (*CPU).sbc,
+	SEC: (*CPU).sec,
+	SED: (*CPU).sed,
+	SEI: (*CPU).sei,
+	STA: (*CPU).sta,
+	STX: (*CPU).stx,
+	STY: (*CPU).sty,
+	TAX: (*CPU).tax,
+	TAY: (*CPU).tay,
+	TSX: (*CPU).tsx,
+	TXA: (*CPU).txa,
+	TXS: (*CPU).txs,
+	TYA: (*CPU).tya,
+}
+
+func (c *CPU) setNZ(v uint8) {
+	c.registers.P.N = isNegative(v)
+	c.registers.P.Z = v == 0
+}
+
+// branch jumps to operand if cond holds. A taken branch reads the next
+// opcode, and reads it again from the old page when it crosses one.
+func (c *CPU) branch(cond bool, operand uint16) {
+	if !cond {
+		return
+	}
+	pc := c.registers.PC
+	c.readByte(pc)
+	if operand&0xFF00 != pc&0xFF00 {
+		c.readByte(pc&0xFF00 | operand&0x00FF)
+	}
+	c.registers.PC = operand
+}
+
+func (c *CPU) compare(r uint8, operand uint16, mode Addressing) {
+	m := c.operandByte(operand, mode)
+	c.setNZ(r - m)
+	c.registers.P.C = r >= m
+}
+
+// modify applies f to the accumulator or to memory at operand. Memory is
+// written back unchanged while f is applied, then written with the result.
+func (c *CPU) modify(operand uint16, mode Addressing, f func(uint8) uint8) {
+	if mode == Accumulator {
+		c.registers.A = f(c.registers.A)
+		c.setNZ(c.registers.A)
+		return
+	}
+	data := c.readByte(operand)
+	c.writeByte(operand, data)
+	data = f(data)
+	c.writeByte(operand, data)
+	c.setNZ(data)
+}
+
+// add adds m and the carry to A. SBC adds the complement of its operand.
+func (c *CPU) add(m uint8) {
+	a := c.registers.A
+	sum := uint16(a) + uint16(m) + uint16(boolToUint8(c.registers.P.C))
+	r := uint8(sum)
+	c.registers.P.C = sum > 0xFF
+	c.registers.P.V = (a^r)&(m^r)&0x80 != 0
+	c.registers.A = r
+	c.setNZ(r)
+}
+
+func (c *CPU) adc(operand uint16, mode Addressing) {
+	c.add(c.operandByte(operand, mode))
+}
+
+func (c *CPU) sbc(operand uint16, mode Addressing) {
+	c.add(^c.operandByte(operand, mode))
+}
+
+func (c *CPU) and(operand uint16, mode Addressing) {
+	c.registers.A &= c.operandByte(operand, mode)
+	c.setNZ(c.registers.A)
+}
+
+func (c *CPU) ora(operand uint16, mode Addressing) {
+	c.registers.A |= c.operandByte(operand, mode)
+	c.setNZ(c.registers.A)
+}
+
+func (c *CPU) eor(operand uint16, mode Addressing) {
+	c.registers.A ^= c.operandByte(operand, mode)
+	c.setNZ(c.registers.A)
+}
+
+func (c *CPU) asl(operand uint16, mode Addressing) {
+	c.modify(operand, mode, func(v uint8) uint8 {
+		c.registers.P.C = nthBit(v, 7) == 1
+		return v << 1
+	})
+}
+
+func (c *CPU) lsr(operand uint16, mode Addressing) {
+	c.modify(operand, mode, func(v uint8) uint8 {
+		c.registers.P.C = nthBit(v, 0) == 1
+		return v >> 1
+	})
+}
+
+func (c *CPU) rol(operand uint16, mode Addressing) {
+	c.modify(operand, mode, func(v uint8) uint8 {
+		carry := boolToUint8(c.registers.P.C)
+		c.registers.P.C = nthBit(v, 7) == 1
+		return v<<1 | carry
+	})
+}
+
+func (c *CPU) ror(operand uint16, mode Addressing) {
+	c.modify(operand, mode, func(v uint8) uint8 {
+		carry := boolToUint8(c.registers.P.C)
+		c.registers.P.C = nthBit(v, 0) == 1
+		return v>>1 | carry<<7
+	})
+}
+
+func (c *CPU) bcc(operand uint16, _ Addressing) { c.branch(!c.registers.P.C, operand) }
+func (c *CPU) bcs(operand uint16, _ Addressing) { c.branch(c.registers.P.C, operand) }
+func (c *CPU) bne(operand uint16, _ Addressing) { c.branch(!c.registers.P.Z, operand) }
+func (c *CPU) beq(operand uint16, _ Addressing) { c.branch(c.registers.P.Z, operand) }
+func (c *CPU) bvc(operand uint16, _ Addressing) { c.branch(!c.registers.P.V, operand) }
+func (c *CPU) bvs(operand uint16, _ Addressing) { c.branch(c.registers.P.V, operand) }
+func (c *CPU) bpl(operand uint16, _ Addressing) { c.branch(!c.registers.P.N, operand) }
+func (c *CPU) bmi(operand uint16, _ Addressing) { c.branch(c.registers.P.N, operand) }
+
+func (c *CPU) bit(operand uint16, _ Addressing) {
+	data := c.readByte(operand)
+	c.registers.P.Z = (c.registers.A & data) == 0
+	c.registers.P.N = nthBit(data, 7) == 1
+	c.registers.P.V = nthBit(data, 6) == 1
+}
+
+func (c *CPU) jmp(operand uint16, _ Addressing) {
+	c.registers.PC = operand
+}
+
+func (c *CPU) jsr(operand uint16, _ Addressing) {
+	pc := c.registers.PC - 1
+	c.push(uint8(pc >> 8))
+	c.push(uint8(pc))
+	c.registers.PC = operand
+}
+
+func (c *CPU) rts(_ uint16, _ Addressing) {
+	c.registers.PC = uint16(c.pop()) + uint16(c.pop())<<8 + 1
+}
+
+func (c *CPU) brk(_ uint16, _ Addressing) {
+	c.registers.P.B = true
+	// the byte after BRK is read and skipped
+	c.fetchByte()
+	c.push(uint8(c.registers.PC >> 8))
+	c.push(uint8(c.registers.PC))
+	c.push(c.registers.P.Uint8())
+	c.registers.P.I = true
+	c.registers.PC = c.readWord(0xFFFE)
+}
+
+func (c *CPU) rti(_ uint16, _ Addressing) {
+	c.registers.P.SetByUint8(c.pop())
+	c.registers.PC = uint16(c.pop()) + uint16(c.pop())<<8
+}
+
+func (c *CPU) cmp(operand uint16, mode Addressing) { c.compare(c.registers.A, operand, mode) }
+func (c *CPU) cpx(operand uint16, mode Addressing) { c.compare(c.registers.X, operand, mode) }
+func (c *CPU) cpy(operand uint16, mode Addressing) { c.compare(c.registers.Y, operand, mode) }
+
+func (c *CPU) inc(operand uint16, mode Addressing) {
+	c.modify(operand, mode, func(v uint8) uint8 { return v + 1 })
+}
+
+func (c *CPU) dec(operand uint16, mode Addressing) {
+	c.modify(operand, mode, func(v uint8) uint8 { return v - 1 })
+}
+
+func (c *CPU) inx(_ uint16, _ Addressing) { c.registers.X++; c.setNZ(c.registers.X) }
+func (c *CPU) dex(_ uint16, _ Addressing) { c.registers.X--; c.setNZ(c.registers.X) }
+func (c *CPU) iny(_ uint16, _ Addressing) { c.registers.Y++; c.setNZ(c.registers.Y) }
+func (c *CPU) dey(_ uint16, _ Addressing) { c.registers.Y--; c.setNZ(c.registers.Y) }
+
+func (c *CPU) clc(_ uint16, _ Addressing) { c.registers.P.C = false }
+func (c *CPU) sec(_ uint16, _ Addressing) { c.registers.P.C = true }
+func (c *CPU) cli(_ uint16, _ Addressing) { c.registers.P.I = false }
+func (c *CPU) sei(_ uint16, _ Addressing) { c.registers.P.I = true }
+func (c *CPU) cld(_ uint16, _ Addressing) { c.registers.P.D = false }
+func (c *CPU) sed(_ uint16, _ Addressing) { c.registers.P.D = true }
+func (c *CPU) clv(_ uint16, _ Addressing) { c.registers.P.V = false }
+
+func (c *CPU) lda(operand uint16, mode Addressing) {
+	c.registers.A = c.operandByte(operand, mode)
+	c.setNZ(c.registers.A)
+}
+
+func (c *CPU) ldx(operand uint16, mode Addressing) {
+	c.registers.X = c.operandByte(operand, mode)
+	c.setNZ(c.registers.X)
+}
+
+func (c *CPU) ldy(operand uint16, mode Addressing) {
+	c.registers.Y = c.operandByte(operand, mode)
+	c.setNZ(c.registers.Y)
+}
+
+func (c *CPU) sta(operand uint16, _ Addressing) { c.writeByte(operand, c.registers.A) }
+func (c *CPU) stx(operand uint16, _ Addressing) { c.writeByte(operand, c.registers.X) }
+func (c *CPU) sty(operand uint16, _ Addressing) { c.writeByte(operand, c.registers.Y) }
+
+func (c *CPU) tax(_ uint16, _ Addressing) { c.registers.X = c.registers.A; c.setNZ(c.registers.X) }
+func (c *CPU) tay(_ uint16, _ Addressing) { c.registers.Y = c.registers.A; c.setNZ(c.registers.Y) }
+func (c *CPU) txa(_ uint16, _ Addressing) { c.registers.A = c.registers.X; c.setNZ(c.registers.A) }
+func (c *CPU) tya(_ uint16, _ Addressing) { c.registers.A = c.registers.Y; c.setNZ(c.registers.A) }
+
+func (c *CPU) tsx(_ uint16, _ Addressing) {
+	c.registers.X = uint8(c.registers.SP)
+	c.setNZ(c.registers.X)
+}
+
+func (c *CPU) txs(_ uint16, _ Addressing) {
+	c.registers.SP = 0x0100 | uint16(c.registers.X)
+}
+
+func (c *CPU) pha(_ uint16, _ Addressing) {
+	c.push(c.registers.A)
+}
+
+func (c *CPU) pla(_ uint16, _ Addressing) {
+	c.registers.A = c.pop()
+	c.setNZ(c.registers.A)
+}
+
+func (c *CPU) php(_ uint16, _ Addressing) {
+	c.push(c.registers.P.Uint8())
+}
+
+func (c *CPU) plp(_ uint16, _ Addressing) {
+	c.registers.P.SetByUint8(c.pop())
+}
+
+func (c *CPU) nop(_ uint16, _ Addressing) {}
@@ -0,0 +1,25 @@
+package cpu
+
+import "github.com/dqn/gones/ram"
+
+// State is a copy of the registers and RAM for savestates.
+type State struct {
+	A, X, Y, P uint8
+	SP, PC     uint16
+	NMI        bool
+	IRQ        IRQSource
+	RAM        ram.RAM
+}
+
+func (c *CPU) State() *State {
+	r := c.registers
+	return &State{r.A, r.X, r.Y, r.P.Uint8(), r.SP, r.PC, c.nmi, c.irq, *c.bus.ram}
+}
+
+func (c *CPU) SetState(s *State) {
+	r := c.registers
+	r.A, r.X, r.Y, r.SP, r.PC = s.A, s.X, s.Y, s.SP, s.PC
+	r.P.SetByUint8(s.P)
+	c.nmi, c.irq = s.NMI, s.IRQ
+	*c.bus.ram = s.RAM
+}
@@ -0,0 +1,41 @@
+package cpu
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SetTrace writes a line per executed instruction to w. A nil w disables tracing.
+//
+//	C000  4C F5 C5  JMP   A:00 X:00 Y:00 P:24 SP:FD
+func (c *CPU) SetTrace(w io.Writer) {
+	c.trace = w
+}
+
+func (c *CPU) writeTrace() error {
+	_, err := fmt.Fprintln(c.trace, c.TraceLine())
+	return err
+}
+
+// TraceLine describes the instruction at PC and the registers in the trace
+// format. Memory is peeked, so tracing does not disturb the emulation.
+func (c *CPU) TraceLine() string {
+	pc := c.registers.PC
+	b := c.bus.Peek(pc)
+	i := instructionSets[b]
+	if i == nil {
+		return fmt.Sprintf("%04X  %02X        ???   %s", pc, b, c.traceRegisters())
+	}
+
+	bytes := make([]string, 0, 3)
+	for n := uint16(0); n < uint16(i.Bytes); n++ {
+		bytes = append(bytes, fmt.Sprintf("%02X", c.bus.Peek(pc+n)))
+	}
+	return fmt.Sprintf("%04X  %-8s  %-4s  %s", pc, strings.Join(bytes, " "), i.Opcode, c.traceRegisters())
+}
+
+func (c *CPU) traceRegisters() string {
+	r := c.registers
+	return fmt.Sprintf("A:%02X X:%02X Y:%02X P:%02X SP:%02X", r.A, r.X, r.Y, r.P.Uint8(), uint8(r.SP))
+}
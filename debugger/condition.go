@@ -0,0 +1,125 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dqn/gones/cpu"
+)
+
+// Condition is a register comparison such as "A == $10 && X >= 3".
+type Condition struct {
+	text  string
+	terms []term
+}
+
+type term struct {
+	register string
+	op       string
+	value    uint16
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func registerValue(r *cpu.Registers, name string) uint16 {
+	switch name {
+	case "A":
+		return uint16(r.A)
+	case "X":
+		return uint16(r.X)
+	case "Y":
+		return uint16(r.Y)
+	case "P":
+		return uint16(r.P.Uint8())
+	case "SP":
+		return uint16(uint8(r.SP))
+	case "PC":
+		return r.PC
+	}
+	return 0
+}
+
+func isRegister(name string) bool {
+	switch name {
+	case "A", "X", "Y", "P", "SP", "PC":
+		return true
+	}
+	return false
+}
+
+// ParseNumber accepts $FF, 0xFF and decimal numbers.
+func ParseNumber(s string) (uint16, error) {
+	s = strings.TrimSpace(s)
+	var v uint64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "$"):
+		v, err = strconv.ParseUint(s[1:], 16, 16)
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		v, err = strconv.ParseUint(s[2:], 16, 16)
+	default:
+		v, err = strconv.ParseUint(s, 10, 16)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %q", s)
+	}
+	return uint16(v), nil
+}
+
+func ParseCondition(s string) (*Condition, error) {
+	c := &Condition{text: strings.TrimSpace(s)}
+	for _, t := range strings.Split(s, "&&") {
+		t = strings.TrimSpace(t)
+		op := ""
+		i := -1
+		for _, o := range operators {
+			if i = strings.Index(t, o); i >= 0 {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("invalid condition: %q", t)
+		}
+		register := strings.ToUpper(strings.TrimSpace(t[:i]))
+		if !isRegister(register) {
+			return nil, fmt.Errorf("unknown register: %q", register)
+		}
+		value, err := ParseNumber(t[i+len(op):])
+		if err != nil {
+			return nil, err
+		}
+		c.terms = append(c.terms, term{register, op, value})
+	}
+	return c, nil
+}
+
+func (c *Condition) Match(r *cpu.Registers) bool {
+	for _, t := range c.terms {
+		v := registerValue(r, t.register)
+		var ok bool
+		switch t.op {
+		case "==":
+			ok = v == t.value
+		case "!=":
+			ok = v != t.value
+		case "<=":
+			ok = v <= t.value
+		case ">=":
+			ok = v >= t.value
+		case "<":
+			ok = v < t.value
+		case ">":
+			ok = v > t.value
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Condition) String() string {
+	return c.text
+}
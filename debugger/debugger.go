@@ -0,0 +1,289 @@
+package debugger
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/dqn/gones/nes"
+	"github.com/dqn/gones/ramsearch"
+)
+
+type Access uint8
+
+const (
+	AccessRead Access = 1 << iota
+	AccessWrite
+	AccessExecute
+)
+
+func (a Access) String() string {
+	s := ""
+	if a&AccessRead != 0 {
+		s += "r"
+	}
+	if a&AccessWrite != 0 {
+		s += "w"
+	}
+	if a&AccessExecute != 0 {
+		s += "x"
+	}
+	return s
+}
+
+type Space uint8
+
+const (
+	SpaceCPU Space = iota
+	SpacePPU
+)
+
+func (s Space) String() string {
+	if s == SpacePPU {
+		return "ppu"
+	}
+	return "cpu"
+}
+
+// Breakpoint stops the emulation when an address in [Start, End] is
+// accessed. A PC breakpoint is an execute watchpoint on the CPU bus.
+type Breakpoint struct {
+	ID        int
+	Access    Access
+	Space     Space
+	Start     uint16
+	End       uint16
+	Condition *Condition
+	Enabled   bool
+}
+
+func (b *Breakpoint) String() string {
+	addr := fmt.Sprintf("$%04X", b.Start)
+	if b.End != b.Start {
+		addr += fmt.Sprintf("-$%04X", b.End)
+	}
+	s := fmt.Sprintf("#%d %-3s %s %s", b.ID, b.Access, b.Space, addr)
+	if b.Condition != nil {
+		s += " if " + b.Condition.String()
+	}
+	if !b.Enabled {
+		s += " (disabled)"
+	}
+	return s
+}
+
+// Stop describes why the emulation stopped.
+type Stop struct {
+	Reason     string
+	Breakpoint *Breakpoint
+}
+
+type Debugger struct {
+	nes         *nes.NES
+	breakpoints []*Breakpoint
+	nextID      int
+	hit         *Stop
+	search      *ramsearch.Search
+	interrupted int32
+}
+
+const (
+	opcodeJSR = 0x20
+	opcodeRTS = 0x60
+	opcodeRTI = 0x40
+)
+
+func New(n *nes.NES) *Debugger {
+	d := &Debugger{nes: n, nextID: 1}
+	n.CPU().Bus().SetHook(func(addr uint16, data uint8, write bool) {
+		d.access(SpaceCPU, addr, data, write)
+	})
+	n.PPU().Bus().SetHook(func(addr uint16, data uint8, write bool) {
+		d.access(SpacePPU, addr, data, write)
+	})
+	return d
+}
+
+func (d *Debugger) NES() *nes.NES {
+	return d.nes
+}
+
+func (d *Debugger) access(space Space, addr uint16, data uint8, write bool) {
+	if d.hit != nil {
+		return
+	}
+	access := AccessRead
+	if write {
+		access = AccessWrite
+	}
+	if b := d.match(space, access, addr); b != nil {
+		verb := "read"
+		if write {
+			verb = "write"
+		}
+		d.hit = &Stop{fmt.Sprintf("%s %s $%04X = $%02X", space, verb, addr, data), b}
+	}
+}
+
+func (d *Debugger) match(space Space, access Access, addr uint16) *Breakpoint {
+	for _, b := range d.breakpoints {
+		if !b.Enabled || b.Space != space || b.Access&access == 0 || addr < b.Start || addr > b.End {
+			continue
+		}
+		if b.Condition != nil && !b.Condition.Match(d.nes.CPU().Registers()) {
+			continue
+		}
+		return b
+	}
+	return nil
+}
+
+func (d *Debugger) add(b *Breakpoint) *Breakpoint {
+	b.ID = d.nextID
+	b.Enabled = true
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, b)
+	return b
+}
+
+// AddBreakpoint stops before the instruction at addr is executed.
+func (d *Debugger) AddBreakpoint(addr uint16, cond *Condition) *Breakpoint {
+	return d.add(&Breakpoint{Access: AccessExecute, Space: SpaceCPU, Start: addr, End: addr, Condition: cond})
+}
+
+func (d *Debugger) AddWatchpoint(space Space, access Access, start, end uint16, cond *Condition) (*Breakpoint, error) {
+	if access == 0 {
+		return nil, fmt.Errorf("no access kind")
+	}
+	if space == SpacePPU && access&AccessExecute != 0 {
+		return nil, fmt.Errorf("cannot execute from the ppu bus")
+	}
+	if end < start {
+		return nil, fmt.Errorf("invalid range $%04X-$%04X", start, end)
+	}
+	return d.add(&Breakpoint{Access: access, Space: space, Start: start, End: end, Condition: cond}), nil
+}
+
+func (d *Debugger) find(id int) (int, error) {
+	for i, b := range d.breakpoints {
+		if b.ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no breakpoint #%d", id)
+}
+
+func (d *Debugger) Delete(id int) error {
+	i, err := d.find(id)
+	if err != nil {
+		return err
+	}
+	d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+	return nil
+}
+
+func (d *Debugger) SetEnabled(id int, enabled bool) error {
+	i, err := d.find(id)
+	if err != nil {
+		return err
+	}
+	d.breakpoints[i].Enabled = enabled
+	return nil
+}
+
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return d.breakpoints
+}
+
+// Interrupt stops a running Continue, RunToFrame, StepOver or StepOut.
+// It is safe to call from another goroutine.
+func (d *Debugger) Interrupt() {
+	atomic.StoreInt32(&d.interrupted, 1)
+}
+
+// ReadMemory peeks n bytes, so it neither triggers watchpoints nor
+// disturbs registers such as PPUSTATUS.
+func (d *Debugger) ReadMemory(space Space, addr uint16, n int) []uint8 {
+	buf := make([]uint8, n)
+	for i := range buf {
+		a := addr + uint16(i)
+		if space == SpacePPU {
+			buf[i] = d.nes.PPU().Bus().Peek(a)
+		} else {
+			buf[i] = d.nes.CPU().Bus().Peek(a)
+		}
+	}
+	return buf
+}
+
+// WriteMemory pokes memory. Registers are not written.
+func (d *Debugger) WriteMemory(space Space, addr uint16, data uint8) {
+	if space == SpacePPU {
+		d.nes.PPU().Bus().Poke(addr, data)
+	} else {
+		d.nes.CPU().Bus().Poke(addr, data)
+	}
+}
+
+// Where describes the next instruction and the registers.
+func (d *Debugger) Where() string {
+	return fmt.Sprintf("frame %d  %s", d.nes.Frame(), d.nes.CPU().TraceLine())
+}
+
+func (d *Debugger) opcode() uint8 {
+	return d.ReadMemory(SpaceCPU, d.nes.CPU().Registers().PC, 1)[0]
+}
+
+// run executes instructions until a breakpoint is hit, done returns true
+// for the opcode just executed or the debugger is interrupted.
+func (d *Debugger) run(done func(opcode uint8) bool) (*Stop, error) {
+	atomic.StoreInt32(&d.interrupted, 0)
+	for {
+		op := d.opcode()
+		d.hit = nil
+		if _, err := d.nes.Step(); err != nil {
+			return nil, err
+		}
+		if d.hit != nil {
+			return d.hit, nil
+		}
+		if done(op) {
+			return &Stop{Reason: "done"}, nil
+		}
+		if b := d.match(SpaceCPU, AccessExecute, d.nes.CPU().Registers().PC); b != nil {
+			return &Stop{"breakpoint", b}, nil
+		}
+		if atomic.LoadInt32(&d.interrupted) != 0 {
+			return &Stop{Reason: "interrupted"}, nil
+		}
+	}
+}
+
+func (d *Debugger) Step() (*Stop, error) {
+	return d.run(func(uint8) bool { return true })
+}
+
+// StepOver steps over subroutine calls.
+func (d *Debugger) StepOver() (*Stop, error) {
+	if d.opcode() != opcodeJSR {
+		return d.Step()
+	}
+	ret := d.nes.CPU().Registers().PC + 3
+	return d.run(func(uint8) bool { return d.nes.CPU().Registers().PC == ret })
+}
+
+// StepOut runs until the current subroutine or interrupt handler returns.
+func (d *Debugger) StepOut() (*Stop, error) {
+	sp := d.nes.CPU().Registers().SP
+	return d.run(func(op uint8) bool {
+		return (op == opcodeRTS || op == opcodeRTI) && d.nes.CPU().Registers().SP > sp
+	})
+}
+
+func (d *Debugger) Continue() (*Stop, error) {
+	return d.run(func(uint8) bool { return false })
+}
+
+// RunToFrame runs until the given number of frames has been completed.
+func (d *Debugger) RunToFrame(frame int) (*Stop, error) {
+	return d.run(func(uint8) bool { return d.nes.Frame() >= frame })
+}
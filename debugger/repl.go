@@ -0,0 +1,366 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/dqn/gones/cheat"
+)
+
+const help = `commands:
+  s, step [n]                 execute n instructions (default 1)
+  n, next                     step over subroutine calls
+  finish                      run until the current subroutine returns
+  c, continue                 run until a breakpoint is hit (Ctrl-C to interrupt)
+  frame [n]                   run to the next frame or until frame n
+  b, break <addr> [if <cond>] stop before executing addr
+  w, watch <r|w|rw|x> [ppu:]<addr>[-<end>] [if <cond>]
+                              stop on accesses to the cpu (or ppu) bus
+  l, list                     list breakpoints and watchpoints
+  d, delete <id>              delete a breakpoint
+  enable <id>, disable <id>   toggle a breakpoint
+  r, regs                     show the registers
+  set <reg> <value>           set A, X, Y, P, SP or PC
+  x, mem [ppu:]<addr> [len]   dump memory (peeked, without side effects)
+  poke [ppu:]<addr> <value>   write memory (registers are not written)
+  cheat                       list cheats
+  cheat add <code> [name]     add a Game Genie or Pro Action Replay code
+  cheat on <id>, off <id>     toggle a cheat
+  cheat save                  write the cheats to the cheats file
+  search new [8|16] [signed]  start a RAM search with every address as a candidate
+  search <op> [value]         keep candidates comparing (==, !=, <, >) to their
+                              previous value, or to the given value
+  search by <n>               keep candidates that changed by n
+  search                      list the candidates
+  search cheat <addr> [value] freeze a candidate at its current (or given) value
+  h, help                     show this help
+  q, quit                     exit
+
+numbers are decimal, $hex or 0xhex. conditions compare registers, e.g. "A == $10 && X > 2".
+`
+
+// REPL reads commands from r until quit or EOF.
+func (d *Debugger) REPL(r io.Reader, w io.Writer) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		for range sig {
+			d.Interrupt()
+		}
+	}()
+
+	fmt.Fprintln(w, d.Where())
+	s := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(w, "(gones) ")
+		if !s.Scan() {
+			fmt.Fprintln(w)
+			return s.Err()
+		}
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			return nil
+		}
+		if err := d.command(w, fields[0], fields[1:]); err != nil {
+			fmt.Fprintln(w, "error:", err)
+		}
+	}
+}
+
+func (d *Debugger) report(w io.Writer, stop *Stop, err error) error {
+	if err != nil {
+		return err
+	}
+	switch {
+	case stop.Breakpoint != nil:
+		fmt.Fprintf(w, "%s: %s\n", stop.Reason, stop.Breakpoint)
+	case stop.Reason != "done":
+		fmt.Fprintln(w, stop.Reason)
+	}
+	fmt.Fprintln(w, d.Where())
+	return nil
+}
+
+// splitCondition splits "args... if cond" into the arguments and the condition.
+func splitCondition(args []string) ([]string, *Condition, error) {
+	for i, a := range args {
+		if a == "if" {
+			c, err := ParseCondition(strings.Join(args[i+1:], " "))
+			return args[:i], c, err
+		}
+	}
+	return args, nil, nil
+}
+
+func parseAddress(s string) (Space, uint16, uint16, error) {
+	space := SpaceCPU
+	if strings.HasPrefix(s, "ppu:") {
+		space = SpacePPU
+		s = strings.TrimPrefix(s, "ppu:")
+	}
+	bounds := strings.SplitN(s, "-", 2)
+	start, err := ParseNumber(bounds[0])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	end := start
+	if len(bounds) == 2 {
+		if end, err = ParseNumber(bounds[1]); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return space, start, end, nil
+}
+
+func parseAccess(s string) (Access, error) {
+	var a Access
+	for _, c := range s {
+		switch c {
+		case 'r':
+			a |= AccessRead
+		case 'w':
+			a |= AccessWrite
+		case 'x':
+			a |= AccessExecute
+		default:
+			return 0, fmt.Errorf("invalid access: %q", s)
+		}
+	}
+	return a, nil
+}
+
+func parseID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("missing breakpoint id")
+	}
+	return strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+}
+
+func (d *Debugger) command(w io.Writer, name string, args []string) error {
+	switch name {
+	case "h", "help":
+		fmt.Fprint(w, help)
+	case "s", "step":
+		count := uint16(1)
+		if len(args) > 0 {
+			var err error
+			if count, err = ParseNumber(args[0]); err != nil {
+				return err
+			}
+		}
+		var stop *Stop
+		var err error
+		for i := uint16(0); i < count; i++ {
+			if stop, err = d.Step(); err != nil || stop.Reason != "done" {
+				break
+			}
+		}
+		return d.report(w, stop, err)
+	case "n", "next":
+		stop, err := d.StepOver()
+		return d.report(w, stop, err)
+	case "finish":
+		stop, err := d.StepOut()
+		return d.report(w, stop, err)
+	case "c", "continue":
+		stop, err := d.Continue()
+		return d.report(w, stop, err)
+	case "frame":
+		frame := d.nes.Frame() + 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return err
+			}
+			frame = n
+		}
+		stop, err := d.RunToFrame(frame)
+		return d.report(w, stop, err)
+	case "b", "break":
+		args, cond, err := splitCondition(args)
+		if err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			return fmt.Errorf("usage: break <addr> [if <cond>]")
+		}
+		addr, err := ParseNumber(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, d.AddBreakpoint(addr, cond))
+	case "w", "watch":
+		args, cond, err := splitCondition(args)
+		if err != nil {
+			return err
+		}
+		if len(args) != 2 {
+			return fmt.Errorf("usage: watch <r|w|rw|x> [ppu:]<addr>[-<end>] [if <cond>]")
+		}
+		access, err := parseAccess(args[0])
+		if err != nil {
+			return err
+		}
+		space, start, end, err := parseAddress(args[1])
+		if err != nil {
+			return err
+		}
+		b, err := d.AddWatchpoint(space, access, start, end, cond)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, b)
+	case "l", "list":
+		for _, b := range d.breakpoints {
+			fmt.Fprintln(w, b)
+		}
+	case "d", "delete":
+		id, err := parseID(args)
+		if err != nil {
+			return err
+		}
+		return d.Delete(id)
+	case "enable", "disable":
+		id, err := parseID(args)
+		if err != nil {
+			return err
+		}
+		return d.SetEnabled(id, name == "enable")
+	case "r", "regs":
+		fmt.Fprintln(w, d.Where())
+	case "set":
+		return d.setRegister(args)
+	case "x", "mem":
+		return d.dump(w, args)
+	case "poke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: poke [ppu:]<addr> <value>")
+		}
+		space, addr, _, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		v, err := ParseNumber(args[1])
+		if err != nil {
+			return err
+		}
+		d.WriteMemory(space, addr, uint8(v))
+	case "cheat":
+		return d.cheat(w, args)
+	case "search":
+		return d.ramSearch(w, args)
+	default:
+		return fmt.Errorf("unknown command: %s (try help)", name)
+	}
+	return nil
+}
+
+func (d *Debugger) cheat(w io.Writer, args []string) error {
+	l := d.nes.Cheats()
+	if len(args) == 0 {
+		for i, c := range l.Cheats {
+			state := "on "
+			if !c.Enabled {
+				state = "off"
+			}
+			fmt.Fprintf(w, "#%d %s %s\n", i+1, state, c)
+		}
+		return nil
+	}
+	switch args[0] {
+	case "add":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: cheat add <code> [name]")
+		}
+		c, err := cheat.Decode(args[1])
+		if err != nil {
+			return err
+		}
+		c.Name = strings.Join(args[2:], " ")
+		l.Add(c)
+	case "on", "off":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: cheat %s <id>", args[0])
+		}
+		i, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+		if err != nil {
+			return err
+		}
+		if i < 1 || i > len(l.Cheats) {
+			return fmt.Errorf("no cheat #%d", i)
+		}
+		l.Cheats[i-1].Enabled = args[0] == "on"
+		l.Update()
+	case "save":
+		return d.nes.SaveCheats()
+	default:
+		return fmt.Errorf("usage: cheat [add <code> [name] | on <id> | off <id> | save]")
+	}
+	return nil
+}
+
+func (d *Debugger) setRegister(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: set <reg> <value>")
+	}
+	v, err := ParseNumber(args[1])
+	if err != nil {
+		return err
+	}
+	r := d.nes.CPU().Registers()
+	switch strings.ToUpper(args[0]) {
+	case "A":
+		r.A = uint8(v)
+	case "X":
+		r.X = uint8(v)
+	case "Y":
+		r.Y = uint8(v)
+	case "P":
+		r.P.SetByUint8(uint8(v))
+	case "SP":
+		r.SP = 0x0100 | uint16(uint8(v))
+	case "PC":
+		r.PC = v
+	default:
+		return fmt.Errorf("unknown register: %s", args[0])
+	}
+	return nil
+}
+
+func (d *Debugger) dump(w io.Writer, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: mem [ppu:]<addr> [len]")
+	}
+	space, addr, _, err := parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	n := uint16(0x40)
+	if len(args) == 2 {
+		if n, err = ParseNumber(args[1]); err != nil {
+			return err
+		}
+	}
+	buf := d.ReadMemory(space, addr, int(n))
+	for i := 0; i < len(buf); i += 16 {
+		end := i + 16
+		if end > len(buf) {
+			end = len(buf)
+		}
+		fmt.Fprintf(w, "%s:%04X ", space, addr+uint16(i))
+		for _, b := range buf[i:end] {
+			fmt.Fprintf(w, " %02X", b)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package debugger
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dqn/gones/ramsearch"
+)
+
+// maxResults is how many search candidates are listed.
+const maxResults = 32
+
+// parseSigned parses a number like ParseNumber with an optional minus sign.
+func parseSigned(s string) (int, error) {
+	if strings.HasPrefix(s, "-") {
+		v, err := ParseNumber(s[1:])
+		return -int(v), err
+	}
+	v, err := ParseNumber(s)
+	return int(v), err
+}
+
+func (d *Debugger) ramSearch(w io.Writer, args []string) error {
+	r := d.nes.CPU().Bus().RAM()
+	if len(args) > 0 && args[0] == "new" {
+		bits, signed := 8, false
+		for _, a := range args[1:] {
+			switch a {
+			case "8":
+				bits = 8
+			case "16":
+				bits = 16
+			case "signed":
+				signed = true
+			default:
+				return fmt.Errorf("usage: search new [8|16] [signed]")
+			}
+		}
+		s, err := ramsearch.New(r, bits, signed)
+		if err != nil {
+			return err
+		}
+		d.search = s
+		fmt.Fprintf(w, "%d candidates\n", len(s.Results()))
+		return nil
+	}
+	if d.search == nil {
+		return fmt.Errorf("no search, start one with: search new [8|16] [signed]")
+	}
+	if len(args) == 0 {
+		d.listResults(w)
+		return nil
+	}
+
+	switch args[0] {
+	case "by":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: search by <n>")
+		}
+		n, err := parseSigned(args[1])
+		if err != nil {
+			return err
+		}
+		d.search.ChangedBy(r, n)
+	case "cheat":
+		return d.searchCheat(args[1:])
+	default:
+		op, err := ramsearch.ParseOp(args[0])
+		if err != nil {
+			return err
+		}
+		switch len(args) {
+		case 1:
+			d.search.Compare(r, op)
+		case 2:
+			n, err := parseSigned(args[1])
+			if err != nil {
+				return err
+			}
+			d.search.CompareValue(r, op, n)
+		default:
+			return fmt.Errorf("usage: search <op> [value]")
+		}
+	}
+	d.listResults(w)
+	return nil
+}
+
+func (d *Debugger) listResults(w io.Writer) {
+	results := d.search.Results()
+	fmt.Fprintf(w, "%d candidates\n", len(results))
+	for i, r := range results {
+		if i == maxResults {
+			fmt.Fprintln(w, "...")
+			break
+		}
+		fmt.Fprintf(w, "  $%04X  %d (was %d)\n", r.Address, r.Value, r.Previous)
+	}
+}
+
+// searchCheat freezes a candidate at the given value, its current value by default.
+func (d *Debugger) searchCheat(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: search cheat <addr> [value]")
+	}
+	addr, err := ParseNumber(args[0])
+	if err != nil {
+		return err
+	}
+	var found *ramsearch.Result
+	for _, r := range d.search.Results() {
+		if r.Address == addr {
+			found = &r
+			break
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("$%04X is not a candidate", addr)
+	}
+	value := found.Value
+	if len(args) == 2 {
+		if value, err = parseSigned(args[1]); err != nil {
+			return err
+		}
+	}
+	for _, c := range d.search.Cheats(addr, value, "") {
+		d.nes.Cheats().Add(c)
+	}
+	return nil
+}
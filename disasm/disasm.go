@@ -0,0 +1,260 @@
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dqn/gones/cpu"
+)
+
+// Bank is a piece of PRG-ROM as it appears in the CPU address space.
+type Bank struct {
+	Number  int
+	Address uint16
+	Data    []uint8
+	// Fixed banks are always mapped, so other banks can refer to their labels.
+	Fixed bool
+}
+
+func (b *Bank) contains(addr uint16) bool {
+	return addr >= b.Address && int(addr-b.Address) < len(b.Data)
+}
+
+// Banks splits PRG-ROM the way the mapper maps it at power on. Switchable
+// banks are all placed at $8000 and the last bank is fixed at the end of
+// the address space.
+func Banks(programROM []uint8, mapper uint8) []Bank {
+	var size int
+	switch mapper {
+	case 0, 3:
+		// not banked: NROM-128 is mirrored, its code runs from $C000 as well
+		return []Bank{{0, uint16(0x10000 - len(programROM)), programROM, true}}
+	case 7, 11, 34, 66:
+		size = 0x8000
+	case 4, 5, 9, 19, 21, 22, 23, 25, 69:
+		size = 0x2000
+	default:
+		size = 0x4000
+	}
+	if len(programROM) <= size {
+		return []Bank{{0, uint16(0x10000 - len(programROM)), programROM, true}}
+	}
+
+	n := len(programROM) / size
+	banks := make([]Bank, n)
+	for i := range banks {
+		banks[i] = Bank{Number: i, Address: 0x8000, Data: programROM[i*size : (i+1)*size]}
+	}
+	banks[n-1].Address = uint16(0x10000 - size)
+	banks[n-1].Fixed = true
+	return banks
+}
+
+type instruction struct {
+	addr  uint16
+	bytes []uint8
+	set   *cpu.InstructionSet
+}
+
+func (i *instruction) operand() uint16 {
+	switch len(i.bytes) {
+	case 2:
+		return uint16(i.bytes[1])
+	case 3:
+		return uint16(i.bytes[1]) | uint16(i.bytes[2])<<8
+	}
+	return 0
+}
+
+// target returns the address the instruction transfers control to.
+func (i *instruction) target() (uint16, bool) {
+	if i.set == nil {
+		return 0, false
+	}
+	switch {
+	case i.set.Addressing == cpu.Relative:
+		return i.addr + 2 + uint16(int8(i.bytes[1])), true
+	case i.set.Opcode == cpu.JMP && i.set.Addressing == cpu.Absolute, i.set.Opcode == cpu.JSR:
+		return i.operand(), true
+	}
+	return 0, false
+}
+
+func decode(b *Bank) []instruction {
+	var instructions []instruction
+	for offset := 0; offset < len(b.Data); {
+		addr := b.Address + uint16(offset)
+		set, ok := cpu.LookupInstruction(b.Data[offset])
+		if !ok || offset+int(set.Bytes) > len(b.Data) {
+			instructions = append(instructions, instruction{addr, b.Data[offset : offset+1], nil})
+			offset++
+			continue
+		}
+		instructions = append(instructions, instruction{addr, b.Data[offset : offset+int(set.Bytes)], set})
+		offset += int(set.Bytes)
+	}
+	return instructions
+}
+
+type label struct {
+	bank int
+	addr uint16
+}
+
+type disassembler struct {
+	banks        []Bank
+	instructions [][]instruction
+	labels       map[label]string
+}
+
+// resolve finds the bank a reference from bank `from` to addr lands in.
+func (d *disassembler) resolve(from int, addr uint16) (int, bool) {
+	if d.banks[from].contains(addr) {
+		return from, true
+	}
+	for i := range d.banks {
+		if d.banks[i].Fixed && d.banks[i].contains(addr) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (d *disassembler) name(bank int, addr uint16, prefix string) string {
+	if len(d.banks) > 1 && !d.banks[bank].Fixed {
+		return fmt.Sprintf("%s_%02d_%04X", prefix, bank, addr)
+	}
+	return fmt.Sprintf("%s_%04X", prefix, addr)
+}
+
+func (d *disassembler) collectLabels() {
+	for i := range d.banks {
+		if !d.banks[i].Fixed || !d.banks[i].contains(0xFFFF) {
+			continue
+		}
+		b := &d.banks[i]
+		for _, v := range vectors {
+			o := int(v.addr - b.Address)
+			target := uint16(b.Data[o]) | uint16(b.Data[o+1])<<8
+			if bank, ok := d.resolve(i, target); ok {
+				d.labels[label{bank, target}] = v.name
+			}
+		}
+	}
+
+	for i, instructions := range d.instructions {
+		for _, in := range instructions {
+			target, ok := in.target()
+			if !ok {
+				continue
+			}
+			bank, ok := d.resolve(i, target)
+			if !ok {
+				continue
+			}
+			l := label{bank, target}
+			if _, exists := d.labels[l]; exists {
+				continue
+			}
+			if in.set.Opcode == cpu.JSR {
+				d.labels[l] = d.name(bank, target, "sub")
+			} else {
+				d.labels[l] = d.name(bank, target, "L")
+			}
+		}
+	}
+}
+
+func (d *disassembler) symbol(bank int, addr uint16) (string, bool) {
+	if b, ok := d.resolve(bank, addr); ok {
+		if l, ok := d.labels[label{b, addr}]; ok {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+func (d *disassembler) format(bank int, in *instruction) string {
+	if in.set == nil {
+		return fmt.Sprintf(".byte $%02X", in.bytes[0])
+	}
+	op := in.set.Opcode.String()
+	v := in.operand()
+	abs := fmt.Sprintf("$%04X", v)
+	if name, ok := registers[v]; ok {
+		abs = name
+	}
+	if target, ok := in.target(); ok {
+		if name, ok := d.symbol(bank, target); ok {
+			abs = name
+		} else {
+			abs = fmt.Sprintf("$%04X", target)
+		}
+	}
+
+	switch in.set.Addressing {
+	case cpu.Implied:
+		return op
+	case cpu.Accumulator:
+		return op + " A"
+	case cpu.Immediate:
+		return fmt.Sprintf("%s #$%02X", op, v)
+	case cpu.Zeropage:
+		return fmt.Sprintf("%s $%02X", op, v)
+	case cpu.ZeropageX:
+		return fmt.Sprintf("%s $%02X,X", op, v)
+	case cpu.ZeropageY:
+		return fmt.Sprintf("%s $%02X,Y", op, v)
+	case cpu.Absolute, cpu.Relative:
+		return op + " " + abs
+	case cpu.AbsoluteX:
+		return op + " " + abs + ",X"
+	case cpu.AbsoluteY:
+		return op + " " + abs + ",Y"
+	case cpu.IndirectX:
+		return fmt.Sprintf("%s ($%02X,X)", op, v)
+	case cpu.IndirectY:
+		return fmt.Sprintf("%s ($%02X),Y", op, v)
+	case cpu.Indirect:
+		return fmt.Sprintf("%s ($%04X)", op, v)
+	}
+	return op
+}
+
+// Write disassembles the banks to w, one instruction per line.
+func Write(w io.Writer, banks []Bank) error {
+	d := &disassembler{banks: banks, labels: map[label]string{}}
+	for i := range banks {
+		d.instructions = append(d.instructions, decode(&banks[i]))
+	}
+	d.collectLabels()
+
+	for i, b := range banks {
+		fixed := ""
+		if b.Fixed {
+			fixed = " (fixed)"
+		}
+		if _, err := fmt.Fprintf(w, "; bank %d at $%04X%s\n", b.Number, b.Address, fixed); err != nil {
+			return err
+		}
+		for _, in := range d.instructions[i] {
+			if l, ok := d.labels[label{i, in.addr}]; ok {
+				if _, err := fmt.Fprintf(w, "%s:\n", l); err != nil {
+					return err
+				}
+			}
+			bytes := make([]string, len(in.bytes))
+			for j, b := range in.bytes {
+				bytes[j] = fmt.Sprintf("%02X", b)
+			}
+			if _, err := fmt.Fprintf(w, "  %04X  %-8s  %s\n", in.addr, strings.Join(bytes, " "), d.format(i, &in)); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,496 @@
+package fds
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/cartridge"
+)
+
+// https://wiki.nesdev.com/w/index.php/Family_Computer_Disk_System
+
+// アドレス	       用途
+// 0x4020～0x4021	IRQ タイマーのリロード値
+// 0x4022	      IRQ タイマーの制御
+// 0x4023	      ディスク、音源レジスタの有効化
+// 0x4024	      書き込みデータ
+// 0x4025	      ディスクドライブの制御
+// 0x4026	      拡張端子への出力
+// 0x4030	      ディスクの状態 (読み込み)
+// 0x4031	      読み込みデータ
+// 0x4032	      ドライブの状態 (読み込み)
+// 0x4033	      拡張端子からの入力 (読み込み)
+// 0x4040～0x4092	音源 (apu.FDS)
+// 0x6000～0xDFFF	RAM
+// 0xE000～0xFFFF	BIOS
+
+const (
+	programRAMSize   = 0x8000 // 32 KiB
+	characterRAMSize = 0x2000 //  8 KiB
+	biosSize         = 0x2000 //  8 KiB
+
+	// mapperNumber is the iNES mapper number reserved for the FDS.
+	mapperNumber = 20
+	// byteCycles is the time the drive takes to transfer a byte, at
+	// about 96.4 kbit/s.
+	byteCycles = 150
+	// rewindCycles is the time the head takes to return to the start.
+	rewindCycles = 50000
+	// insertCycles is how long a disk stays out when switching sides,
+	// about a second, for the game to notice.
+	insertCycles = 1789773
+)
+
+// $4025
+const (
+	controlMotor      = 0x01
+	controlReset      = 0x02
+	controlRead       = 0x04
+	controlHorizontal = 0x08
+	controlCRC        = 0x10
+	controlReady      = 0x40
+	controlIRQ        = 0x80
+)
+
+var ErrInvalidBIOS = errors.New("the FDS BIOS must be 8 KiB")
+
+// Registers are the registers of the RAM adapter and the state of the
+// drive.
+type Registers struct {
+	TimerReload  uint16
+	TimerCounter uint16
+	TimerRepeat  bool
+	TimerEnabled bool
+	TimerIRQ     bool
+
+	DiskEnabled  bool
+	SoundEnabled bool
+	Control      uint8
+	External     uint8
+	WriteData    uint8
+	ReadData     uint8
+	// Transferred is set when a byte has been read or written.
+	Transferred bool
+	DiskIRQ     bool
+
+	// Side is the inserted side, -1 if none. Inserting is the side
+	// inserted when InsertDelay runs out.
+	Side        int
+	Inserting   int
+	InsertDelay int
+	Motor       bool
+	Scanning    bool
+	EndOfHead   bool
+	GapEnded    bool
+	Position    int
+	Delay       int
+}
+
+// RAMAdapter is the board of the Disk System: the RAM adapter plugged into
+// the cartridge slot, with the BIOS, and the disk drive connected to it.
+type RAMAdapter struct {
+	Registers
+	cartridge *cartridge.Cartridge
+	audio     *apu.FDS
+	// sides are what the drive reads from each side.
+	sides    [][]uint8
+	modified bool
+
+	timerIRQ func(asserted bool)
+	diskIRQ  func(asserted bool)
+	// IRQ lines as last reported
+	timerLine bool
+	diskLine  bool
+}
+
+// New returns the cartridge of a RAM adapter with the disk inserted,
+// first side up.
+func New(image *Image, bios []uint8, cpuClock float64) (*cartridge.Cartridge, *RAMAdapter, error) {
+	if len(bios) != biosSize {
+		return nil, nil, ErrInvalidBIOS
+	}
+	c := &cartridge.Cartridge{
+		ProgramROM:   bios,
+		ProgramRAM:   make([]uint8, programRAMSize),
+		CharacterROM: make([]uint8, characterRAMSize),
+		Mapper:       mapperNumber,
+	}
+	a := &RAMAdapter{
+		cartridge: c,
+		audio:     apu.NewFDS(cpuClock),
+		sides:     make([][]uint8, len(image.Sides)),
+	}
+	for i, side := range image.Sides {
+		a.sides[i] = encodeSide(side)
+	}
+	a.EndOfHead = true
+	a.Inserting = -1
+	c.SetBoard(a)
+	return c, a, nil
+}
+
+// DefaultBIOSPath returns the location of the BIOS used when none is
+// given explicitly.
+func DefaultBIOSPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gones", "disksys.rom"), nil
+}
+
+func LoadBIOS(path string) ([]uint8, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) != biosSize {
+		return nil, fmt.Errorf("%s: %w", path, ErrInvalidBIOS)
+	}
+	return buf, nil
+}
+
+// SetIRQ sets the functions called when the timer and the disk transfer
+// IRQ lines change.
+func (a *RAMAdapter) SetIRQ(timer, disk func(asserted bool)) {
+	a.timerIRQ, a.diskIRQ = timer, disk
+}
+
+func (a *RAMAdapter) updateIRQ() {
+	if a.TimerIRQ != a.timerLine {
+		a.timerLine = a.TimerIRQ
+		if a.timerIRQ != nil {
+			a.timerIRQ(a.timerLine)
+		}
+	}
+	if a.DiskIRQ != a.diskLine {
+		a.diskLine = a.DiskIRQ
+		if a.diskIRQ != nil {
+			a.diskIRQ(a.diskLine)
+		}
+	}
+}
+
+// Audio returns the sound channel, to be mixed with the APU.
+func (a *RAMAdapter) Audio() apu.Expansion {
+	return a.audio
+}
+
+// Sides returns the number of disk sides.
+func (a *RAMAdapter) Sides() int {
+	return len(a.sides)
+}
+
+// Eject takes the disk out of the drive.
+func (a *RAMAdapter) Eject() {
+	a.Side, a.Inserting, a.InsertDelay = -1, -1, 0
+}
+
+// Insert ejects the disk and inserts the side a second later.
+func (a *RAMAdapter) Insert(side int) {
+	a.Eject()
+	a.Inserting, a.InsertDelay = side, insertCycles
+}
+
+// SwitchSide inserts the side after the one in the drive, or being
+// inserted, going back to the first after the last.
+func (a *RAMAdapter) SwitchSide() {
+	side := a.Side
+	if a.Inserting >= 0 {
+		side = a.Inserting
+	}
+	a.Insert((side + 1) % len(a.sides))
+}
+
+// Modified reports whether the disk has been written to.
+func (a *RAMAdapter) Modified() bool {
+	return a.modified
+}
+
+// Image returns the disk as an image, with what has been written to it.
+func (a *RAMAdapter) Image() *Image {
+	i := &Image{Sides: make([][]uint8, len(a.sides))}
+	for s, raw := range a.sides {
+		i.Sides[s] = decodeSide(raw)
+	}
+	return i
+}
+
+// LoadSave replaces the disk with the image saved at path, if any.
+func (a *RAMAdapter) LoadSave(path string) error {
+	image, err := Load(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(image.Sides) != len(a.sides) {
+		return fmt.Errorf("%s: %d disk sides instead of %d", path, len(image.Sides), len(a.sides))
+	}
+	for i, side := range image.Sides {
+		a.sides[i] = encodeSide(side)
+	}
+	return nil
+}
+
+// Save writes the disk to path if it has been modified. The original
+// image is never written.
+func (a *RAMAdapter) Save(path string) error {
+	if !a.modified {
+		return nil
+	}
+	return a.Image().Save(path)
+}
+
+func (a *RAMAdapter) ReadProgram(addr uint16) uint8 {
+	switch {
+	case addr >= 0x4030 && addr < 0x4034:
+		if !a.DiskEnabled {
+			return 0
+		}
+		data := a.PeekProgram(addr)
+		switch addr {
+		case 0x4030:
+			a.TimerIRQ, a.Transferred, a.DiskIRQ = false, false, false
+			a.updateIRQ()
+		case 0x4031:
+			a.Transferred, a.DiskIRQ = false, false
+			a.updateIRQ()
+		}
+		return data
+	case addr >= 0x4040 && addr < 0x4100:
+		if a.SoundEnabled {
+			data, _ := a.audio.ReadRegister(addr)
+			return data
+		}
+	case addr >= 0x6000:
+		return a.PeekProgram(addr)
+	}
+	return 0
+}
+
+func (a *RAMAdapter) PeekProgram(addr uint16) uint8 {
+	switch {
+	case addr == 0x4030:
+		var data uint8
+		if a.TimerIRQ {
+			data |= 0x01
+		}
+		if a.Transferred {
+			data |= 0x02
+		}
+		if a.Control&controlHorizontal != 0 {
+			data |= 0x08
+		}
+		if a.EndOfHead {
+			data |= 0x40
+		}
+		return data
+	case addr == 0x4031:
+		return a.ReadData
+	case addr == 0x4032:
+		// disk missing, not ready and write protected
+		data := uint8(0x40)
+		if a.Side < 0 {
+			data |= 0x05
+		}
+		if a.Side < 0 || !a.Scanning {
+			data |= 0x02
+		}
+		return data
+	case addr == 0x4033:
+		// the battery is good
+		return 0x80
+	case addr >= 0x4040 && addr < 0x4100:
+		data, _ := a.audio.ReadRegister(addr)
+		return data
+	case addr >= 0x6000 && addr < 0xE000:
+		return a.cartridge.ProgramRAM[addr-0x6000]
+	case addr >= 0xE000:
+		return a.cartridge.ProgramROM[addr-0xE000]
+	}
+	return 0
+}
+
+func (a *RAMAdapter) WriteProgram(addr uint16, data uint8) {
+	switch {
+	case addr == 0x4020:
+		a.TimerReload = a.TimerReload&0xFF00 | uint16(data)
+	case addr == 0x4021:
+		a.TimerReload = a.TimerReload&0x00FF | uint16(data)<<8
+	case addr == 0x4022:
+		a.TimerRepeat = data&0x01 != 0
+		a.TimerEnabled = data&0x02 != 0 && a.DiskEnabled
+		if a.TimerEnabled {
+			a.TimerCounter = a.TimerReload
+		} else {
+			a.TimerIRQ = false
+		}
+	case addr == 0x4023:
+		a.DiskEnabled = data&0x01 != 0
+		a.SoundEnabled = data&0x02 != 0
+		if !a.DiskEnabled {
+			a.TimerEnabled, a.TimerIRQ, a.DiskIRQ = false, false, false
+		}
+	case addr == 0x4024:
+		a.WriteData = data
+		a.Transferred, a.DiskIRQ = false, false
+	case addr == 0x4025:
+		a.Control = data
+		a.Motor = data&controlMotor != 0
+		a.DiskIRQ = false
+	case addr == 0x4026:
+		a.External = data
+	case addr >= 0x4040 && addr < 0x4100:
+		if a.SoundEnabled {
+			a.audio.WriteRegister(addr, data)
+		}
+	case addr >= 0x6000 && addr < 0xE000:
+		a.cartridge.ProgramRAM[addr-0x6000] = data
+	}
+	a.updateIRQ()
+}
+
+func (a *RAMAdapter) PokeProgram(addr uint16, data uint8) {
+	if addr >= 0x6000 && addr < 0xE000 {
+		a.cartridge.ProgramRAM[addr-0x6000] = data
+	}
+}
+
+func (a *RAMAdapter) ReadCharacter(addr uint16) uint8 {
+	return a.cartridge.CharacterROM[addr]
+}
+
+func (a *RAMAdapter) PeekCharacter(addr uint16) uint8 {
+	return a.cartridge.CharacterROM[addr]
+}
+
+func (a *RAMAdapter) WriteCharacter(addr uint16, data uint8) {
+	a.cartridge.CharacterROM[addr] = data
+}
+
+func (a *RAMAdapter) Mirroring() cartridge.Mirroring {
+	if a.Control&controlHorizontal != 0 {
+		return cartridge.MirroringHorizontal
+	}
+	return cartridge.MirroringVertical
+}
+
+// Step runs the timer and the drive for a CPU cycle.
+func (a *RAMAdapter) Step() {
+	if a.TimerEnabled {
+		if a.TimerCounter == 0 {
+			a.TimerIRQ = true
+			a.TimerCounter = a.TimerReload
+			a.TimerEnabled = a.TimerRepeat
+		} else {
+			a.TimerCounter--
+		}
+	}
+	a.stepDrive()
+	a.updateIRQ()
+}
+
+// stepDrive moves the disk under the head. With the motor on, the head
+// goes back to the start of the side and transfers a byte every
+// byteCycles until the end, where the motor stops.
+// https://wiki.nesdev.com/w/index.php/FDS_disk_format
+func (a *RAMAdapter) stepDrive() {
+	if a.InsertDelay > 0 {
+		if a.InsertDelay--; a.InsertDelay == 0 {
+			a.Side, a.Inserting = a.Inserting, -1
+		}
+	}
+	if a.Side < 0 || !a.Motor {
+		a.EndOfHead, a.Scanning = true, false
+		return
+	}
+	if a.Control&controlReset != 0 && !a.Scanning {
+		return
+	}
+	if a.EndOfHead {
+		a.EndOfHead, a.GapEnded = false, false
+		a.Position, a.Delay = 0, rewindCycles
+		return
+	}
+	if a.Delay > 0 {
+		a.Delay--
+		return
+	}
+
+	a.Scanning = true
+	side := a.sides[a.Side]
+	irq := a.Control&controlIRQ != 0
+	if a.Control&controlRead != 0 {
+		data := side[a.Position]
+		switch {
+		case a.Control&controlReady == 0:
+			a.GapEnded = false
+		case data != 0 && !a.GapEnded:
+			// the mark ending the gap is not transferred
+			a.GapEnded = true
+			irq = false
+		}
+		if a.GapEnded {
+			a.ReadData, a.Transferred = data, true
+			a.DiskIRQ = a.DiskIRQ || irq
+		}
+	} else {
+		// the CRC is not kept, the written block is checked by
+		// reading it back
+		var data uint8
+		if a.Control&controlCRC == 0 {
+			data, a.Transferred = a.WriteData, true
+			a.DiskIRQ = a.DiskIRQ || irq
+		}
+		if a.Control&controlReady == 0 {
+			data = 0
+		}
+		side[a.Position] = data
+		a.modified = true
+		a.GapEnded = false
+	}
+
+	if a.Position++; a.Position >= len(side) {
+		a.Motor = false
+	} else {
+		a.Delay = byteCycles
+	}
+}
+
+// State is a copy of the RAM adapter and the disk for savestates.
+type State struct {
+	Registers    Registers
+	Sides        [][]uint8
+	CharacterRAM []uint8
+}
+
+func (a *RAMAdapter) State() *State {
+	s := &State{
+		Registers:    a.Registers,
+		Sides:        make([][]uint8, len(a.sides)),
+		CharacterRAM: append([]uint8(nil), a.cartridge.CharacterROM...),
+	}
+	for i, side := range a.sides {
+		s.Sides[i] = append([]uint8(nil), side...)
+	}
+	return s
+}
+
+func (a *RAMAdapter) SetState(s *State) {
+	a.Registers = s.Registers
+	for i := range a.sides {
+		if i < len(s.Sides) {
+			a.sides[i] = append(a.sides[i][:0], s.Sides[i]...)
+		}
+	}
+	copy(a.cartridge.CharacterROM, s.CharacterRAM)
+	// the disk may differ from the one loaded
+	a.modified = true
+	a.updateIRQ()
+}
@@ -0,0 +1,179 @@
+package fds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// https://wiki.nesdev.com/w/index.php/FDS_file_format
+// https://wiki.nesdev.com/w/index.php/FDS_disk_format
+
+const (
+	headerSize = 0x0010 // 16 Byte
+	// SideSize is the size of a disk side in .fds images.
+	SideSize = 65500
+)
+
+var (
+	magic = []byte("FDS\x1A")
+	// diskInfo starts the first block of every side.
+	diskInfo = []byte("\x01*NINTENDO-HVC*")
+)
+
+var ErrInvalidImage = errors.New("not an FDS image")
+
+// Image is the disk sides of an .fds file. Each side holds its blocks back
+// to back, without the gaps and CRCs the drive reads between them.
+type Image struct {
+	Sides [][]uint8
+}
+
+// IsImage reports whether buf looks like an .fds file, with or without
+// the 16 byte header.
+func IsImage(buf []byte) bool {
+	return bytes.HasPrefix(buf, magic) || bytes.HasPrefix(buf, diskInfo)
+}
+
+func Parse(buf []byte) (*Image, error) {
+	sides := -1
+	if bytes.HasPrefix(buf, magic) {
+		if len(buf) < headerSize {
+			return nil, ErrInvalidImage
+		}
+		sides = int(buf[4])
+		buf = buf[headerSize:]
+	}
+	if sides < 0 || sides > len(buf)/SideSize {
+		sides = len(buf) / SideSize
+	}
+	if sides == 0 {
+		return nil, fmt.Errorf("%w: no disk side", ErrInvalidImage)
+	}
+
+	i := &Image{Sides: make([][]uint8, sides)}
+	for s := range i.Sides {
+		side := buf[s*SideSize : (s+1)*SideSize]
+		if !bytes.HasPrefix(side, diskInfo) {
+			return nil, fmt.Errorf("%w: side %d has no disk info block", ErrInvalidImage, s+1)
+		}
+		i.Sides[s] = append([]uint8(nil), side...)
+	}
+	return i, nil
+}
+
+func Load(path string) (*Image, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return i, nil
+}
+
+// Bytes returns the image as an .fds file with a header.
+func (i *Image) Bytes() []byte {
+	buf := make([]byte, headerSize, headerSize+len(i.Sides)*SideSize)
+	copy(buf, magic)
+	buf[4] = uint8(len(i.Sides))
+	for _, side := range i.Sides {
+		buf = append(buf, side...)
+	}
+	return buf
+}
+
+func (i *Image) Save(path string) error {
+	return ioutil.WriteFile(path, i.Bytes(), 0644)
+}
+
+// The drive reads a side as a stream of bytes: a long gap of zeros before
+// the first block, then each block after a $80 mark ending the gap and
+// followed by its CRC and another gap.
+const (
+	leadingGap = 28300 / 8
+	blockGap   = 976 / 8
+	crcSize    = 2
+	// rawSideSize leaves room for the gaps of a full side.
+	rawSideSize = leadingGap + SideSize
+)
+
+// blockSize returns the size of a block from its type, 0 if it is not a
+// block. File data blocks are the size given by the preceding file header.
+func blockSize(kind uint8, fileSize int) int {
+	switch kind {
+	case 1:
+		// disk info
+		return 56
+	case 2:
+		// file amount
+		return 2
+	case 3:
+		// file header
+		return 16
+	case 4:
+		// file data
+		return 1 + fileSize
+	}
+	return 0
+}
+
+// fileSize returns the data size of a file header block.
+func fileSize(header []uint8) int {
+	return int(header[13]) | int(header[14])<<8
+}
+
+// encodeSide returns what the drive reads from a side.
+func encodeSide(side []uint8) []uint8 {
+	raw := make([]uint8, leadingGap, rawSideSize)
+	size := 0
+	for pos := 0; pos < len(side); {
+		n := blockSize(side[pos], size)
+		if n == 0 || pos+n > len(side) {
+			break
+		}
+		block := side[pos : pos+n]
+		if block[0] == 3 {
+			size = fileSize(block)
+		}
+		raw = append(raw, 0x80)
+		raw = append(raw, block...)
+		raw = append(raw, make([]uint8, crcSize+blockGap)...)
+		pos += n
+	}
+	if len(raw) < rawSideSize {
+		raw = raw[:rawSideSize]
+	}
+	return raw
+}
+
+// decodeSide returns the blocks found in what the drive reads, as a side
+// of an image.
+func decodeSide(raw []uint8) []uint8 {
+	side := make([]uint8, 0, SideSize)
+	size := 0
+	pos := 0
+	for {
+		for pos < len(raw) && raw[pos] == 0 {
+			pos++
+		}
+		if pos+1 >= len(raw) || raw[pos] != 0x80 {
+			break
+		}
+		pos++
+		n := blockSize(raw[pos], size)
+		if n == 0 || pos+n > len(raw) || len(side)+n > SideSize {
+			break
+		}
+		block := raw[pos : pos+n]
+		if block[0] == 3 {
+			size = fileSize(block)
+		}
+		side = append(side, block...)
+		pos += n + crcSize
+	}
+	return side[:SideSize]
+}
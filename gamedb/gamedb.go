@@ -0,0 +1,79 @@
+package gamedb
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const nesHeaderSize = 0x0010
+
+// Entry describes the peripherals a game expects. Empty fields mean the default.
+type Entry struct {
+	Name      string `json:"name"`
+	Port1     string `json:"port1"`
+	Port2     string `json:"port2"`
+	Expansion string `json:"expansion"`
+}
+
+// DB maps the CRC32 of a ROM (without the 16 byte header, as 8 hex digits)
+// to its entry.
+//
+//	{
+//	  "1234ABCD": {"name": "...", "port2": "zapper"}
+//	}
+type DB map[string]Entry
+
+func Load(path string) (DB, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db := DB{}
+	if err := json.Unmarshal(buf, &db); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	normalized := make(DB, len(db))
+	for k, v := range db {
+		normalized[strings.ToUpper(k)] = v
+	}
+	return normalized, nil
+}
+
+// DefaultPath returns the location of the database used when none is given explicitly.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gones", "gamedb.json"), nil
+}
+
+// LoadDefault loads the database at DefaultPath. A missing file is an empty database.
+func LoadDefault() (DB, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return DB{}, nil
+	}
+	db, err := Load(path)
+	if os.IsNotExist(err) {
+		return DB{}, nil
+	}
+	return db, err
+}
+
+func Hash(rom []byte) string {
+	if len(rom) > nesHeaderSize {
+		rom = rom[nesHeaderSize:]
+	}
+	return fmt.Sprintf("%08X", crc32.ChecksumIEEE(rom))
+}
+
+func (db DB) Lookup(rom []byte) (Entry, bool) {
+	e, ok := db[Hash(rom)]
+	return e, ok
+}
@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	github.com/hajimehoshi/ebiten v1.12.10
+	github.com/yuin/gopher-lua v1.1.0
 	golang.org/x/image v0.0.0-20200927104501-e162460cd6b5 // indirect
 	golang.org/x/sys v0.0.0-20201009025420-dfb3f7c4e634 // indirect
 )
@@ -0,0 +1,249 @@
+package gym
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dqn/gones/nes"
+	"github.com/dqn/gones/ram"
+)
+
+const (
+	width  = 256
+	height = 240
+)
+
+// Config describes the environment. The zero value steps one frame at a
+// time, observes RGB frames and never ends an episode.
+type Config struct {
+	// FrameSkip repeats each action for the given number of frames.
+	FrameSkip int  `json:"frame_skip"`
+	Grayscale bool `json:"grayscale"`
+	// Downscale divides the observation size, averaging the pixels.
+	Downscale int         `json:"downscale"`
+	Reward    []RAMReward `json:"reward"`
+	Done      []RAMDone   `json:"done"`
+	// MaxFrames ends the episode after the given number of frames if positive.
+	MaxFrames int `json:"max_frames"`
+}
+
+// RAMReward rewards changes of a little endian value in RAM: the reward
+// of a step is Scale times the increase of the value.
+type RAMReward struct {
+	Address uint16  `json:"address"`
+	Bytes   int     `json:"bytes"`
+	Scale   float64 `json:"scale"`
+}
+
+// RAMDone ends the episode when a RAM byte compares to Value with Op
+// (==, !=, <, <=, >, >=).
+type RAMDone struct {
+	Address uint16 `json:"address"`
+	Op      string `json:"op"`
+	Value   uint8  `json:"value"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := json.Unmarshal(buf, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+func value(r *ram.RAM, addr uint16, bytes int) int {
+	v := 0
+	for i := bytes - 1; i >= 0; i-- {
+		v = v<<8 | int(r[(addr+uint16(i))%0x0800])
+	}
+	return v
+}
+
+// Reward returns the reward of going from prev to cur.
+func (r RAMReward) Reward(prev, cur *ram.RAM) float64 {
+	bytes := r.Bytes
+	if bytes <= 0 {
+		bytes = 1
+	}
+	return r.Scale * float64(value(cur, r.Address, bytes)-value(prev, r.Address, bytes))
+}
+
+func (d RAMDone) Done(r *ram.RAM) (bool, error) {
+	v := r[d.Address%0x0800]
+	switch d.Op {
+	case "==", "":
+		return v == d.Value, nil
+	case "!=":
+		return v != d.Value, nil
+	case "<":
+		return v < d.Value, nil
+	case "<=":
+		return v <= d.Value, nil
+	case ">":
+		return v > d.Value, nil
+	case ">=":
+		return v >= d.Value, nil
+	}
+	return false, fmt.Errorf("unknown done operator: %q", d.Op)
+}
+
+// RewardFunc computes the reward of a step from RAM before and after it.
+type RewardFunc func(prev, cur *ram.RAM) float64
+
+// DoneFunc reports whether the episode is over.
+type DoneFunc func(r *ram.RAM) bool
+
+// Observation is a frame as rows of pixels with Channels bytes each
+// (1 for grayscale, 3 for RGB).
+type Observation struct {
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Channels int     `json:"channels"`
+	Pixels   []uint8 `json:"pixels"`
+}
+
+type Result struct {
+	Observation *Observation `json:"observation"`
+	Reward      float64      `json:"reward"`
+	Done        bool         `json:"done"`
+	Frame       int          `json:"frame"`
+}
+
+// Env is a reinforcement learning environment around a headless emulator.
+// Actions are the buttons of player 1 in controller.Button bit order.
+type Env struct {
+	nes     *nes.NES
+	config  *Config
+	initial *nes.State
+	start   int
+	prev    ram.RAM
+	rewards []RewardFunc
+	dones   []DoneFunc
+}
+
+// New loads the ROM. options may set the region, colors and so on; its
+// frame limit, movie and trace are ignored.
+func New(path string, options nes.Options, config *Config) (*Env, error) {
+	options.FrameLimit, options.Movie, options.Trace = 0, nil, nil
+	n, err := nes.New(path, &options)
+	if err != nil {
+		return nil, err
+	}
+	initial, err := n.State()
+	if err != nil {
+		return nil, err
+	}
+	e := &Env{nes: n, config: config, initial: initial, start: n.Frame()}
+	// Step before Reset counts from the power-on state too
+	e.prev = *e.ram()
+	for _, r := range config.Reward {
+		e.rewards = append(e.rewards, r.Reward)
+	}
+	for _, d := range config.Done {
+		d := d
+		if _, err := d.Done(&ram.RAM{}); err != nil {
+			return nil, err
+		}
+		e.dones = append(e.dones, func(r *ram.RAM) bool {
+			done, _ := d.Done(r)
+			return done
+		})
+	}
+	return e, nil
+}
+
+// AddReward adds a reward computed in Go to the configured ones.
+func (e *Env) AddReward(f RewardFunc) {
+	e.rewards = append(e.rewards, f)
+}
+
+// AddDone adds a done condition computed in Go to the configured ones.
+func (e *Env) AddDone(f DoneFunc) {
+	e.dones = append(e.dones, f)
+}
+
+func (e *Env) NES() *nes.NES {
+	return e.nes
+}
+
+func (e *Env) ram() *ram.RAM {
+	return e.nes.CPU().Bus().RAM()
+}
+
+// Reset restores the power-on state and returns the first observation.
+func (e *Env) Reset() (*Observation, error) {
+	if err := e.nes.SetState(e.initial); err != nil {
+		return nil, err
+	}
+	e.start = e.nes.Frame()
+	e.prev = *e.ram()
+	return e.observe(), nil
+}
+
+// Step holds the action for FrameSkip frames.
+func (e *Env) Step(action uint8) (*Result, error) {
+	skip := e.config.FrameSkip
+	if skip <= 0 {
+		skip = 1
+	}
+	e.nes.Controller(0).SetButtons(action)
+	for i := 0; i < skip; i++ {
+		if err := e.nes.StepFrame(); err != nil {
+			return nil, err
+		}
+	}
+
+	cur := e.ram()
+	res := &Result{Frame: e.nes.Frame() - e.start}
+	for _, r := range e.rewards {
+		res.Reward += r(&e.prev, cur)
+	}
+	e.prev = *cur
+	for _, d := range e.dones {
+		if d(cur) {
+			res.Done = true
+		}
+	}
+	if max := e.config.MaxFrames; max > 0 && res.Frame >= max {
+		res.Done = true
+	}
+	res.Observation = e.observe()
+	return res, nil
+}
+
+func (e *Env) observe() *Observation {
+	scale := e.config.Downscale
+	if scale <= 0 {
+		scale = 1
+	}
+	o := &Observation{Width: width / scale, Height: height / scale, Channels: 3}
+	if e.config.Grayscale {
+		o.Channels = 1
+	}
+	o.Pixels = make([]uint8, 0, o.Width*o.Height*o.Channels)
+	pix := e.nes.PPU().Pixels()
+	for y := 0; y < o.Height; y++ {
+		for x := 0; x < o.Width; x++ {
+			var r, g, b int
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					i := ((y*scale+dy)*width + x*scale + dx) * 4
+					r, g, b = r+int(pix[i]), g+int(pix[i+1]), b+int(pix[i+2])
+				}
+			}
+			n := scale * scale
+			if e.config.Grayscale {
+				// ITU-R BT.601 luma
+				o.Pixels = append(o.Pixels, uint8((299*r+587*g+114*b)/(1000*n)))
+			} else {
+				o.Pixels = append(o.Pixels, uint8(r/n), uint8(g/n), uint8(b/n))
+			}
+		}
+	}
+	return o
+}
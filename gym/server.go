@@ -0,0 +1,72 @@
+package gym
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Handler serves an environment over HTTP with JSON bodies:
+//
+//	POST /reset                  -> Observation
+//	POST /step {"action": 129}   -> Result
+//
+// Pixels are base64 encoded.
+type Handler struct {
+	mu  sync.Mutex
+	env *Env
+	mux *http.ServeMux
+}
+
+func NewHandler(env *Env) *Handler {
+	h := &Handler{env: env, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/reset", h.reset)
+	h.mux.HandleFunc("/step", h.step)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *Handler) reset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	obs, err := h.env.Reset()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, obs)
+}
+
+func (h *Handler) step(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Action uint8 `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res, err := h.env.Step(req.Action)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, res)
+}
@@ -0,0 +1,85 @@
+package input
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+)
+
+const axisThreshold = 0.5
+
+// Binding is a physical input bound to a button.
+//
+// Bindings are written as strings in the config file:
+//
+//	"Z", "Enter", "Up"       keyboard key (ebiten key name)
+//	"button:3"               gamepad button
+//	"axis:1-", "axis:0+"     gamepad axis pushed to the negative/positive side
+type Binding interface {
+	Pressed(gamepad int, connected bool) bool
+}
+
+type keyBinding ebiten.Key
+
+func (b keyBinding) Pressed(int, bool) bool {
+	return ebiten.IsKeyPressed(ebiten.Key(b))
+}
+
+type gamepadButtonBinding ebiten.GamepadButton
+
+func (b gamepadButtonBinding) Pressed(gamepad int, connected bool) bool {
+	return connected && ebiten.IsGamepadButtonPressed(gamepad, ebiten.GamepadButton(b))
+}
+
+type gamepadAxisBinding struct {
+	axis     int
+	positive bool
+}
+
+func (b gamepadAxisBinding) Pressed(gamepad int, connected bool) bool {
+	if !connected || b.axis >= ebiten.GamepadAxisNum(gamepad) {
+		return false
+	}
+	v := ebiten.GamepadAxis(gamepad, b.axis)
+	if b.positive {
+		return v > axisThreshold
+	}
+	return v < -axisThreshold
+}
+
+var keyNames = func() map[string]ebiten.Key {
+	m := map[string]ebiten.Key{}
+	for k := ebiten.Key(0); k <= ebiten.KeyMax; k++ {
+		m[strings.ToLower(k.String())] = k
+	}
+	return m
+}()
+
+func ParseBinding(s string) (Binding, error) {
+	switch {
+	case strings.HasPrefix(s, "button:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "button:"))
+		if err != nil || n < 0 || n > int(ebiten.GamepadButtonMax) {
+			return nil, fmt.Errorf("invalid gamepad button: %q", s)
+		}
+		return gamepadButtonBinding(n), nil
+	case strings.HasPrefix(s, "axis:"):
+		v := strings.TrimPrefix(s, "axis:")
+		if len(v) < 2 || (v[len(v)-1] != '+' && v[len(v)-1] != '-') {
+			return nil, fmt.Errorf("invalid gamepad axis: %q", s)
+		}
+		n, err := strconv.Atoi(v[:len(v)-1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid gamepad axis: %q", s)
+		}
+		return gamepadAxisBinding{n, v[len(v)-1] == '+'}, nil
+	default:
+		k, ok := keyNames[strings.ToLower(s)]
+		if !ok {
+			return nil, fmt.Errorf("unknown key: %q", s)
+		}
+		return keyBinding(k), nil
+	}
+}
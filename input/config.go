@@ -0,0 +1,130 @@
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Config is the JSON key bindings file. Button names are
+// A, B, Select, Start, Up, Down, Left and Right.
+//
+//	{
+//	  "players": [
+//	    {
+//	      "gamepad": 0,
+//	      "buttons": {"A": ["Z", "button:1"], "Up": ["Up", "axis:1-"]},
+//	      "turbo": {"A": ["A"]},
+//	      "turbo_interval": 2,
+//	      "allow_opposite_directions": false
+//	    }
+//	  ],
+//	  "power_pad": ["U", "I", "O", "P", "J", "K", "L", "Semicolon", "M", "Comma", "Period", "Slash"]
+//	}
+type Config struct {
+	Players []PlayerConfig `json:"players"`
+	// PowerPad binds buttons 1 to 12 of the Power Pad. Gamepad bindings
+	// use the gamepad of player 2.
+	PowerPad []string `json:"power_pad"`
+}
+
+type PlayerConfig struct {
+	// Gamepad is the index of the connected gamepad used by the player, or -1 for none.
+	Gamepad int                 `json:"gamepad"`
+	Buttons map[string][]string `json:"buttons"`
+	Turbo   map[string][]string `json:"turbo"`
+	// TurboInterval is the number of frames a turbo button stays pressed
+	// and then released, i.e. 2 means 15 presses per second at 60 Hz.
+	TurboInterval           int  `json:"turbo_interval"`
+	AllowOppositeDirections bool `json:"allow_opposite_directions"`
+}
+
+const defaultTurboInterval = 2
+
+func gamepadPlayer(gamepad int) PlayerConfig {
+	return PlayerConfig{
+		Gamepad: gamepad,
+		Buttons: map[string][]string{
+			"A":      {"button:1"},
+			"B":      {"button:0"},
+			"Select": {"button:6"},
+			"Start":  {"button:7"},
+			"Up":     {"axis:1-"},
+			"Down":   {"axis:1+"},
+			"Left":   {"axis:0-"},
+			"Right":  {"axis:0+"},
+		},
+		Turbo: map[string][]string{
+			"A": {"button:3"},
+			"B": {"button:2"},
+		},
+		TurboInterval: defaultTurboInterval,
+	}
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Players: []PlayerConfig{
+			{
+				Gamepad: 0,
+				Buttons: map[string][]string{
+					"A":      {"Z", "button:1"},
+					"B":      {"C", "button:0"},
+					"Select": {"Space", "button:6"},
+					"Start":  {"Enter", "button:7"},
+					"Up":     {"Up", "axis:1-"},
+					"Down":   {"Down", "axis:1+"},
+					"Left":   {"Left", "axis:0-"},
+					"Right":  {"Right", "axis:0+"},
+				},
+				Turbo: map[string][]string{
+					"A": {"A", "button:3"},
+					"B": {"D", "button:2"},
+				},
+				TurboInterval: defaultTurboInterval,
+			},
+			gamepadPlayer(1),
+			gamepadPlayer(2),
+			gamepadPlayer(3),
+		},
+		PowerPad: []string{"U", "I", "O", "P", "J", "K", "L", "Semicolon", "M", "Comma", "Period", "Slash"},
+	}
+}
+
+func LoadConfig(path string) (*Config, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := json.Unmarshal(buf, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// DefaultConfigPath returns the location of the key bindings file
+// used when none is given explicitly.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gones", "input.json"), nil
+}
+
+// LoadDefaultConfig loads the file at DefaultConfigPath, falling back
+// to DefaultConfig when it does not exist.
+func LoadDefaultConfig() (*Config, error) {
+	path, err := DefaultConfigPath()
+	if err != nil {
+		return DefaultConfig(), nil
+	}
+	c, err := LoadConfig(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	return c, err
+}
@@ -0,0 +1,190 @@
+package input
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dqn/gones/controller"
+	"github.com/hajimehoshi/ebiten"
+)
+
+const screenWidth = 256
+
+var buttonNames = map[string]controller.Button{
+	"A":      controller.ButtonA,
+	"B":      controller.ButtonB,
+	"Select": controller.ButtonSelect,
+	"Start":  controller.ButtonStart,
+	"Up":     controller.ButtonUp,
+	"Down":   controller.ButtonDown,
+	"Left":   controller.ButtonLeft,
+	"Right":  controller.ButtonRight,
+}
+
+type player struct {
+	gamepad                 int
+	buttons                 [8][]Binding
+	turbo                   [8][]Binding
+	turboInterval           int
+	allowOppositeDirections bool
+}
+
+// Mapper translates keyboard and gamepad state into controller buttons.
+type Mapper struct {
+	players  []*player
+	powerPad [12]Binding
+	frame    int
+}
+
+func parseBindings(m map[string][]string, dst *[8][]Binding) error {
+	for name, bindings := range m {
+		b, ok := buttonNames[name]
+		if !ok {
+			return fmt.Errorf("unknown button: %q", name)
+		}
+		for _, s := range bindings {
+			binding, err := ParseBinding(s)
+			if err != nil {
+				return err
+			}
+			dst[b] = append(dst[b], binding)
+		}
+	}
+	return nil
+}
+
+func NewMapper(c *Config) (*Mapper, error) {
+	m := &Mapper{}
+	for i, pc := range c.Players {
+		p := &player{
+			gamepad:                 pc.Gamepad,
+			turboInterval:           pc.TurboInterval,
+			allowOppositeDirections: pc.AllowOppositeDirections,
+		}
+		if p.turboInterval <= 0 {
+			p.turboInterval = defaultTurboInterval
+		}
+		if err := parseBindings(pc.Buttons, &p.buttons); err != nil {
+			return nil, fmt.Errorf("player %d: %w", i+1, err)
+		}
+		if err := parseBindings(pc.Turbo, &p.turbo); err != nil {
+			return nil, fmt.Errorf("player %d: turbo: %w", i+1, err)
+		}
+		m.players = append(m.players, p)
+	}
+	if len(c.PowerPad) > len(m.powerPad) {
+		return nil, fmt.Errorf("power pad: too many buttons: %d", len(c.PowerPad))
+	}
+	for i, s := range c.PowerPad {
+		b, err := ParseBinding(s)
+		if err != nil {
+			return nil, fmt.Errorf("power pad: %w", err)
+		}
+		m.powerPad[i] = b
+	}
+	return m, nil
+}
+
+func anyPressed(bindings []Binding, gamepad int, connected bool) bool {
+	for _, b := range bindings {
+		if b.Pressed(gamepad, connected) {
+			return true
+		}
+	}
+	return false
+}
+
+// gamepadID returns the ID of the player's gamepad and whether it is
+// connected.
+func (p *player) gamepadID(gamepads []int) (int, bool) {
+	if p.gamepad < 0 || p.gamepad >= len(gamepads) {
+		return 0, false
+	}
+	return gamepads[p.gamepad], true
+}
+
+// connectedGamepads returns the IDs of the gamepads in the order players
+// refer to them.
+func connectedGamepads() []int {
+	gamepads := ebiten.GamepadIDs()
+	sort.Ints(gamepads)
+	return gamepads
+}
+
+func (p *player) read(gamepads []int, frame int) uint8 {
+	gamepad, connected := p.gamepadID(gamepads)
+	turboOn := (frame/p.turboInterval)%2 == 0
+
+	var buttons uint8
+	for b := range p.buttons {
+		pressed := anyPressed(p.buttons[b], gamepad, connected)
+		if !pressed && turboOn {
+			pressed = anyPressed(p.turbo[b], gamepad, connected)
+		}
+		if pressed {
+			buttons |= 1 << b
+		}
+	}
+
+	if !p.allowOppositeDirections {
+		const upDown = 1<<controller.ButtonUp | 1<<controller.ButtonDown
+		const leftRight = 1<<controller.ButtonLeft | 1<<controller.ButtonRight
+		if buttons&upDown == upDown {
+			buttons &^= upDown
+		}
+		if buttons&leftRight == leftRight {
+			buttons &^= leftRight
+		}
+	}
+	return buttons
+}
+
+// Update polls the input devices and sets the buttons of the
+// controllers, one per configured player. It should be called once per frame.
+func (m *Mapper) Update(controllers ...*controller.Controller) {
+	gamepads := connectedGamepads()
+	for i, c := range controllers {
+		if i >= len(m.players) {
+			c.SetButtons(0)
+			continue
+		}
+		c.SetButtons(m.players[i].read(gamepads, m.frame))
+	}
+	m.frame++
+}
+
+// UpdateZapper aims the Zapper at the mouse cursor. The left button pulls
+// the trigger; the right button pulls it while pointing away from the screen.
+func (m *Mapper) UpdateZapper(z *controller.Zapper) {
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
+		z.Aim(-1, -1)
+		z.SetTrigger(true)
+		return
+	}
+	z.Aim(ebiten.CursorPosition())
+	z.SetTrigger(ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft))
+}
+
+// UpdateVaus turns the Arkanoid paddle with the horizontal mouse position.
+// The left button fires.
+func (m *Mapper) UpdateVaus(v *controller.Vaus) {
+	x, _ := ebiten.CursorPosition()
+	v.SetPosition(float64(x) / float64(screenWidth-1))
+	v.SetFire(ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft))
+}
+
+// UpdatePowerPad sets the Power Pad buttons. Gamepad bindings use the
+// gamepad of player 2, whose port the mat is plugged into.
+func (m *Mapper) UpdatePowerPad(p *controller.PowerPad) {
+	gamepad, connected := 0, false
+	if len(m.players) > 1 {
+		gamepad, connected = m.players[1].gamepadID(connectedGamepads())
+	}
+	var buttons uint16
+	for i, b := range m.powerPad {
+		if b != nil && b.Pressed(gamepad, connected) {
+			buttons |= 1 << i
+		}
+	}
+	p.SetButtons(buttons)
+}
@@ -1,22 +1,373 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/dqn/gones/cartridge"
+	"github.com/dqn/gones/debugger"
+	"github.com/dqn/gones/disasm"
+	"github.com/dqn/gones/gamedb"
+	"github.com/dqn/gones/gym"
+	"github.com/dqn/gones/input"
+	"github.com/dqn/gones/movie"
 	"github.com/dqn/gones/nes"
+	"github.com/dqn/gones/nsf"
+	"github.com/dqn/gones/ppu"
+	"github.com/dqn/gones/region"
+	"github.com/dqn/gones/script"
 )
 
+var errUsage = errors.New("usage")
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: %s [options] <nes-file-path>\n", os.Args[0])
+	fmt.Fprintf(w, "       %s disasm [-o output] <nes-file-path>\n", os.Args[0])
+	fmt.Fprintf(w, "       %s gym [options] <nes-file-path>\n", os.Args[0])
+	fmt.Fprintf(w, "       %s nsf [options] <nsf-file-path>\n\noptions:\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func disassemble(args []string) error {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	output := fs.String("o", "", "write the disassembly to the file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s disasm [-o output] <nes-file-path>\n\noptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(fs.Output(), "missing nes file path")
+		fs.Usage()
+		return errUsage
+	}
+
+	buf, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	c, err := cartridge.ReadImage(buf)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; %s: mapper %d, %d KiB PRG-ROM\n\n", filepath.Base(fs.Arg(0)), c.Mapper, len(c.ProgramROM)/1024)
+	if err := disasm.Write(bw, disasm.Banks(c.ProgramROM, c.Mapper)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+const gymUsage = "usage: %s gym [-addr addr] [-config file] [-frame-skip n] [-grayscale] [-downscale n] <nes-file-path>\n\noptions:\n"
+
+func serveGym(args []string) error {
+	fs := flag.NewFlagSet("gym", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	configPath := fs.String("config", "", "environment config (JSON)")
+	frameSkip := fs.Int("frame-skip", 0, "frames per step (overrides the config)")
+	grayscale := fs.Bool("grayscale", false, "observe grayscale frames")
+	downscale := fs.Int("downscale", 0, "divide the observation size (overrides the config)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), gymUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(fs.Output(), "missing nes file path")
+		fs.Usage()
+		return errUsage
+	}
+
+	config := &gym.Config{}
+	if *configPath != "" {
+		var err error
+		if config, err = gym.LoadConfig(*configPath); err != nil {
+			return err
+		}
+	}
+	if *frameSkip > 0 {
+		config.FrameSkip = *frameSkip
+	}
+	if *downscale > 0 {
+		config.Downscale = *downscale
+	}
+	config.Grayscale = config.Grayscale || *grayscale
+
+	env, err := gym.New(fs.Arg(0), nes.Options{Input: input.DefaultConfig()}, config)
+	if err != nil {
+		return err
+	}
+	if _, err := env.Reset(); err != nil {
+		return err
+	}
+	log.Printf("serving %s on http://%s", filepath.Base(fs.Arg(0)), *addr)
+	return http.ListenAndServe(*addr, gym.NewHandler(env))
+}
+
+const nsfUsage = "usage: %s nsf [-track n] [-region region] [-audio-rate rate] [-scale scale] [-fullscreen] [-o output.wav] [-seconds s] <nsf-file-path>\n\noptions:\n"
+
+func playNSF(args []string) error {
+	fs := flag.NewFlagSet("nsf", flag.ContinueOnError)
+	track := fs.Int("track", 0, "song to play from 1 (0: the start song of the file)")
+	rgn := fs.String("region", "auto", "console region (auto, "+strings.Join(region.Regions, ", ")+"); auto reads the NSF header")
+	audioRate := fs.Int("audio-rate", 44100, "audio sample rate in Hz")
+	scale := fs.Float64("scale", 2, "window scale factor")
+	fullscreen := fs.Bool("fullscreen", false, "start in fullscreen mode")
+	output := fs.String("o", "", "render the song to a WAV file instead of playing it")
+	seconds := fs.Float64("seconds", 0, "length to render with -o (0: the length in the NSFE file, or 2 minutes)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), nsfUsage, os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(fs.Output(), "missing nsf file path")
+		fs.Usage()
+		return errUsage
+	}
+	if *track < 0 {
+		return fmt.Errorf("invalid track: %d", *track)
+	}
+	if *audioRate < 8000 || *audioRate > 192000 {
+		return fmt.Errorf("invalid audio rate: %d", *audioRate)
+	}
+	if *seconds < 0 {
+		return fmt.Errorf("invalid length: %g", *seconds)
+	}
+	if *scale <= 0 {
+		return fmt.Errorf("invalid scale: %g", *scale)
+	}
+
+	if *output == "" {
+		return nes.PlayNSF(fs.Arg(0), *track-1, &nes.Options{
+			Region:     *rgn,
+			SampleRate: *audioRate,
+			Scale:      *scale,
+			Fullscreen: *fullscreen,
+		})
+	}
+
+	n, err := nsf.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var r *region.Region
+	if *rgn != "auto" {
+		if r, err = region.Parse(*rgn); err != nil {
+			return err
+		}
+	}
+	song := n.StartSong
+	if *track > 0 {
+		song = *track - 1
+	}
+	length := time.Duration(*seconds * float64(time.Second))
+	return nsf.NewPlayer(n, r).Render(*output, song, *audioRate, length)
+}
+
 func run() error {
-	n, err := nes.New(os.Args[1])
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "disasm":
+			return disassemble(os.Args[2:])
+		case "gym":
+			return serveGym(os.Args[2:])
+		case "nsf":
+			return playNSF(os.Args[2:])
+		}
+	}
+
+	var (
+		scale      = flag.Float64("scale", 2, "window scale factor")
+		fullscreen = flag.Bool("fullscreen", false, "start in fullscreen mode")
+		palette    = flag.String("palette", "", "palette file (.pal, 64 RGB triplets)")
+		region     = flag.String("region", "auto", "console region (auto, "+strings.Join(region.Regions, ", ")+"); auto reads the ROM header")
+		audioRate  = flag.Int("audio-rate", 44100, "audio sample rate in Hz, 0 disables audio")
+		saveDir    = flag.String("save-dir", "", "directory for battery-backed saves and written disks (default: next to the ROM)")
+		fdsBIOS    = flag.String("fds-bios", "", "Famicom Disk System BIOS (default: gones/disksys.rom in the user config directory)")
+		cheatPath  = flag.String("cheats", "", "cheats file (default: <rom name>.cht in the save directory)")
+		recordPath = flag.String("record-audio", "", "record the audio to a WAV file from the start (F9 records to <rom name>-1.wav, -2.wav, ... in the save directory)")
+		recordCh   = flag.Bool("record-channels", false, "also record each APU channel to its own WAV file")
+		inputPath  = flag.String("input", "", "key bindings config (default: gones/input.json in the user config directory)")
+		headless   = flag.Bool("headless", false, "run without a window or live input")
+		debug      = flag.Bool("debug", false, "run headless under the interactive debugger")
+		fastFwd    = flag.Int("fast-forward", 0, "frames per tick while fast-forwarding (0: as fast as possible)")
+		slowMotion = flag.Int("slow-motion", 4, "ticks per frame in slow motion")
+		frames     = flag.Int("frames", 0, "stop after the given number of frames (0: no limit)")
+		dumpPPU    = flag.String("dump-ppu", "", "write PNG views of the pattern tables, nametables, OAM and palettes to the directory on exit")
+		tracePath  = flag.String("trace", "", "write a CPU instruction trace to the file (- for stdout)")
+		moviePath  = flag.String("movie", "", "play back an FCEUX movie (.fm2)")
+		scriptPath = flag.String("script", "", "run a Lua script")
+		port1      = flag.String("port1", "", "device on controller port 1 ("+strings.Join(nes.Port1Devices, ", ")+")")
+		port2      = flag.String("port2", "", "device on controller port 2 ("+strings.Join(nes.Port2Devices, ", ")+")")
+		expansion  = flag.String("expansion", "", "device on the Famicom expansion port ("+strings.Join(nes.ExpansionDevices, ", ")+")")
+		gameDBPath = flag.String("gamedb", "", "game database selecting the devices per game (default: gones/gamedb.json in the user config directory)")
+	)
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		if flag.NArg() == 0 {
+			fmt.Fprintln(flag.CommandLine.Output(), "missing nes file path")
+		} else {
+			fmt.Fprintf(flag.CommandLine.Output(), "unexpected arguments: %s\n", strings.Join(flag.Args()[1:], " "))
+		}
+		usage()
+		return errUsage
+	}
+	romPath := flag.Arg(0)
+	if info, err := os.Stat(romPath); err != nil {
+		return fmt.Errorf("cannot open ROM: %w", err)
+	} else if info.IsDir() {
+		return fmt.Errorf("cannot open ROM: %s is a directory", romPath)
+	}
+
+	if *scale <= 0 {
+		return fmt.Errorf("invalid scale: %g", *scale)
+	}
+	if *audioRate != 0 && (*audioRate < 8000 || *audioRate > 192000) {
+		return fmt.Errorf("invalid audio rate: %d", *audioRate)
+	}
+	if *frames < 0 {
+		return fmt.Errorf("invalid frame limit: %d", *frames)
+	}
+
+	options := &nes.Options{
+		Port1:          *port1,
+		Port2:          *port2,
+		Expansion:      *expansion,
+		Region:         *region,
+		SampleRate:     *audioRate,
+		Scale:          *scale,
+		Fullscreen:     *fullscreen,
+		SaveDir:        *saveDir,
+		FDSBIOS:        *fdsBIOS,
+		CheatFile:      *cheatPath,
+		RecordAudio:    *recordPath,
+		RecordChannels: *recordCh,
+		FastForward:    *fastFwd,
+		SlowMotion:     *slowMotion,
+		FrameLimit:     *frames,
+	}
+
+	var err error
+	if *gameDBPath != "" {
+		options.GameDB, err = gamedb.Load(*gameDBPath)
+	} else {
+		options.GameDB, err = gamedb.LoadDefault()
+	}
+	if err != nil {
+		return err
+	}
+
+	if *inputPath != "" {
+		if options.Input, err = input.LoadConfig(*inputPath); err != nil {
+			return err
+		}
+	}
+
+	if *palette != "" {
+		buf, err := ioutil.ReadFile(*palette)
+		if err != nil {
+			return err
+		}
+		if options.Colors, err = ppu.ParseColors(buf); err != nil {
+			return fmt.Errorf("%s: %w", *palette, err)
+		}
+	}
+
+	if *moviePath != "" {
+		if options.Movie, err = movie.Load(*moviePath); err != nil {
+			return err
+		}
+	}
+
+	switch *tracePath {
+	case "":
+	case "-":
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+		options.Trace = w
+	default:
+		f, err := os.Create(*tracePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		options.Trace = w
+	}
+
+	n, err := nes.New(romPath, options)
+	if err != nil {
+		return err
+	}
+	if *scriptPath != "" {
+		s := script.New(n)
+		defer s.Close()
+		if err := s.Load(*scriptPath); err != nil {
+			return err
+		}
+	}
+	switch {
+	case *debug:
+		err = debugger.New(n).REPL(os.Stdin, os.Stdout)
+	case *headless:
+		err = n.RunHeadless()
+	default:
+		err = n.Run()
+	}
 	if err != nil {
 		return err
 	}
-	return n.Run()
+	if *dumpPPU != "" {
+		return n.WritePPUViews(*dumpPPU)
+	}
+	return nil
 }
 
 func main() {
 	if err := run(); err != nil {
+		if err == errUsage {
+			os.Exit(2)
+		}
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,68 @@
+package mapper
+
+import "github.com/dqn/gones/cartridge"
+
+// Boards made of discrete logic latch a write anywhere in $8000-$FFFF.
+
+// AxROM switches 32 KiB of PRG-ROM and shows one nametable on all four.
+// https://wiki.nesdev.com/w/index.php/AxROM
+type AxROM struct {
+	Banks
+}
+
+func newAxROM(c *cartridge.Cartridge) cartridge.Board {
+	b := &AxROM{Banks: newBanks(c)}
+	b.Mirror = cartridge.MirroringSingleLower
+	return b
+}
+
+func (b *AxROM) WriteProgram(addr uint16, data uint8) {
+	if addr < 0x8000 {
+		b.Banks.WriteProgram(addr, data)
+		return
+	}
+	b.setPRG(0x8000, int(data&0x07), 0x8000)
+	b.Mirror = cartridge.MirroringSingleLower
+	if data&0x10 != 0 {
+		b.Mirror = cartridge.MirroringSingleUpper
+	}
+}
+
+// GxROM switches 32 KiB of PRG-ROM and 8 KiB of CHR-ROM.
+// https://wiki.nesdev.com/w/index.php/GxROM
+type GxROM struct {
+	Banks
+}
+
+func newGxROM(c *cartridge.Cartridge) cartridge.Board {
+	return &GxROM{Banks: newBanks(c)}
+}
+
+func (b *GxROM) WriteProgram(addr uint16, data uint8) {
+	if addr < 0x8000 {
+		b.Banks.WriteProgram(addr, data)
+		return
+	}
+	b.setPRG(0x8000, int(data>>4&0x03), 0x8000)
+	b.setCHR(0x0000, int(data&0x03), 0x2000)
+}
+
+// ColorDreams is GxROM with the bits the other way around and more CHR
+// banks.
+// https://wiki.nesdev.com/w/index.php/Color_Dreams
+type ColorDreams struct {
+	Banks
+}
+
+func newColorDreams(c *cartridge.Cartridge) cartridge.Board {
+	return &ColorDreams{Banks: newBanks(c)}
+}
+
+func (b *ColorDreams) WriteProgram(addr uint16, data uint8) {
+	if addr < 0x8000 {
+		b.Banks.WriteProgram(addr, data)
+		return
+	}
+	b.setPRG(0x8000, int(data&0x03), 0x8000)
+	b.setCHR(0x0000, int(data>>4), 0x2000)
+}
@@ -0,0 +1,112 @@
+package mapper
+
+import (
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/cartridge"
+)
+
+// https://wiki.nesdev.com/w/index.php/Sunsoft_FME-7
+
+// アドレス	       用途
+// 0x8000～0x9FFF	コマンドの選択
+// 0xA000～0xBFFF	コマンドのパラメータ
+// 0xC000～0xFFFF	音源 (Sunsoft 5B)
+
+// FME7 is the Sunsoft FME-7, or the 5B with its sound chip: eight 1 KiB
+// CHR banks, three 8 KiB PRG banks and one at $6000 for ROM or RAM, and an
+// IRQ counting down CPU cycles.
+type FME7 struct {
+	Banks
+	IRQ
+	Command uint8
+	// RAMBank is command 8: bank, RAM instead of ROM (bit 6) and RAM
+	// enabled (bit 7).
+	RAMBank        uint8
+	IRQEnabled     bool
+	CounterEnabled bool
+	Counter        uint16
+	// Sound is the sound chip, saved with the board.
+	Sound *apu.Sunsoft5B
+}
+
+func newFME7(c *cartridge.Cartridge) cartridge.Board {
+	b := &FME7{Banks: newBanks(c), Sound: apu.NewSunsoft5B()}
+	b.setPRG(0xE000, -1, prgWindow)
+	return b
+}
+
+func (b *FME7) Audio() apu.Expansion {
+	return b.Sound
+}
+
+func (b *FME7) ReadProgram(addr uint16) uint8 {
+	if addr < 0x6000 || addr >= 0x8000 {
+		return b.Banks.ReadProgram(addr)
+	}
+	switch b.RAMBank & 0xC0 {
+	case 0xC0:
+		return b.Banks.ReadProgram(addr)
+	case 0x40:
+		// RAM disabled, open bus
+		return 0
+	}
+	c := b.cartridge
+	offset := bankOffset(len(c.ProgramROM), int(b.RAMBank&0x3F), prgWindow)
+	return c.ProgramROM[(offset+int(addr%prgWindow))%len(c.ProgramROM)]
+}
+
+func (b *FME7) PeekProgram(addr uint16) uint8 {
+	return b.ReadProgram(addr)
+}
+
+func (b *FME7) WriteProgram(addr uint16, data uint8) {
+	switch {
+	case addr < 0x8000:
+		if b.RAMBank&0xC0 == 0xC0 {
+			b.Banks.WriteProgram(addr, data)
+		}
+	case addr < 0xA000:
+		b.Command = data & 0x0F
+	case addr < 0xC000:
+		b.writeParameter(data)
+	default:
+		b.Sound.WriteRegister(addr, data)
+	}
+}
+
+func (b *FME7) PokeProgram(addr uint16, data uint8) {
+	if addr >= 0x6000 && addr < 0x8000 && b.RAMBank&0xC0 == 0xC0 {
+		b.Banks.WriteProgram(addr, data)
+	}
+}
+
+func (b *FME7) writeParameter(data uint8) {
+	switch c := b.Command; {
+	case c < 0x08:
+		b.setCHR(uint16(c)*chrWindow, int(data), chrWindow)
+	case c == 0x08:
+		b.RAMBank = data
+	case c < 0x0C:
+		b.setPRG(0x8000+uint16(c-0x09)*prgWindow, int(data&0x3F), prgWindow)
+	case c == 0x0C:
+		b.Mirror = mirrorings[data&0x03]
+	case c == 0x0D:
+		b.IRQEnabled = data&0x01 != 0
+		b.CounterEnabled = data&0x80 != 0
+		b.set(false)
+	case c == 0x0E:
+		b.Counter = b.Counter&0xFF00 | uint16(data)
+	case c == 0x0F:
+		b.Counter = b.Counter&0x00FF | uint16(data)<<8
+	}
+}
+
+// Step counts down a CPU cycle. The IRQ fires when the counter wraps.
+func (b *FME7) Step() {
+	if !b.CounterEnabled {
+		return
+	}
+	if b.Counter--; b.Counter == 0xFFFF && b.IRQEnabled {
+		b.set(true)
+	}
+}
@@ -0,0 +1,155 @@
+// Package mapper implements the cartridge boards of the iNES mappers
+// beyond NROM and registers them with cartridge.RegisterBoard.
+//
+// Boards keep their registers in exported fields, which savestates copy.
+package mapper
+
+import (
+	"github.com/dqn/gones/cartridge"
+	"github.com/dqn/gones/region"
+)
+
+func init() {
+	cartridge.RegisterBoard(5, newMMC5)
+	cartridge.RegisterBoard(7, newAxROM)
+	cartridge.RegisterBoard(9, newMMC2)
+	cartridge.RegisterBoard(10, newMMC4)
+	cartridge.RegisterBoard(11, newColorDreams)
+	cartridge.RegisterBoard(19, newN163)
+	cartridge.RegisterBoard(21, newVRC(21))
+	cartridge.RegisterBoard(22, newVRC(22))
+	cartridge.RegisterBoard(23, newVRC(23))
+	cartridge.RegisterBoard(25, newVRC(25))
+	cartridge.RegisterBoard(66, newGxROM)
+	cartridge.RegisterBoard(69, newFME7)
+}
+
+const (
+	prgWindow = 0x2000 // 8 KiB
+	chrWindow = 0x0400 // 1 KiB
+)
+
+// The sound chips are on Famicom boards, clocked like an NTSC console.
+var cpuClock = region.NTSC.CPUClock()
+
+// mirrorings are the usual values of the mirroring registers.
+var mirrorings = [4]cartridge.Mirroring{
+	cartridge.MirroringVertical,
+	cartridge.MirroringHorizontal,
+	cartridge.MirroringSingleLower,
+	cartridge.MirroringSingleUpper,
+}
+
+// bankOffset returns the offset of bank n of size bytes in a memory of
+// length bytes. Negative banks count from the end and banks past the end
+// wrap around, like the address lines the board does not connect.
+func bankOffset(length, n, size int) int {
+	count := length / size
+	if count == 0 {
+		return 0
+	}
+	if n %= count; n < 0 {
+		n += count
+	}
+	return n * size
+}
+
+// Banks maps $8000-$FFFF to PRG-ROM in 8 KiB windows, the pattern tables
+// to CHR-ROM (or RAM) in 1 KiB windows and $6000-$7FFF to PRG-RAM. Boards
+// embed it and decode their registers in WriteProgram.
+type Banks struct {
+	// PRG and CHR are the offsets of the windows in the ROMs.
+	PRG       [4]int
+	CHR       [8]int
+	Mirror    cartridge.Mirroring
+	cartridge *cartridge.Cartridge
+}
+
+// newBanks maps the first 32 KiB of PRG-ROM and 8 KiB of CHR-ROM.
+func newBanks(c *cartridge.Cartridge) Banks {
+	b := Banks{Mirror: c.Mirroring, cartridge: c}
+	b.setPRG(0x8000, 0, 0x8000)
+	b.setCHR(0x0000, 0, 0x2000)
+	return b
+}
+
+// setPRG maps bank n of size bytes at addr.
+func (b *Banks) setPRG(addr uint16, n, size int) {
+	offset := bankOffset(len(b.cartridge.ProgramROM), n, size)
+	for i := 0; i < size/prgWindow; i++ {
+		b.PRG[int(addr-0x8000)/prgWindow+i] = offset + i*prgWindow
+	}
+}
+
+// setCHR maps bank n of size bytes at addr.
+func (b *Banks) setCHR(addr uint16, n, size int) {
+	offset := bankOffset(len(b.cartridge.CharacterROM), n, size)
+	for i := 0; i < size/chrWindow; i++ {
+		b.CHR[int(addr)/chrWindow+i] = offset + i*chrWindow
+	}
+}
+
+func (b *Banks) ReadProgram(addr uint16) uint8 {
+	c := b.cartridge
+	switch {
+	case addr >= 0x6000 && addr < 0x8000:
+		return c.ProgramRAM[addr-0x6000]
+	case addr >= 0x8000:
+		return c.ProgramROM[(b.PRG[(addr-0x8000)/prgWindow]+int(addr%prgWindow))%len(c.ProgramROM)]
+	}
+	return 0
+}
+
+func (b *Banks) PeekProgram(addr uint16) uint8 {
+	return b.ReadProgram(addr)
+}
+
+func (b *Banks) WriteProgram(addr uint16, data uint8) {
+	if addr >= 0x6000 && addr < 0x8000 {
+		b.cartridge.ProgramRAM[addr-0x6000] = data
+	}
+}
+
+func (b *Banks) PokeProgram(addr uint16, data uint8) {
+	b.WriteProgram(addr, data)
+}
+
+func (b *Banks) ReadCharacter(addr uint16) uint8 {
+	c := b.cartridge
+	return c.CharacterROM[(b.CHR[addr/chrWindow]+int(addr%chrWindow))%len(c.CharacterROM)]
+}
+
+func (b *Banks) PeekCharacter(addr uint16) uint8 {
+	return b.ReadCharacter(addr)
+}
+
+func (b *Banks) WriteCharacter(addr uint16, data uint8) {
+	c := b.cartridge
+	if c.HasCharacterRAM() {
+		c.CharacterROM[(b.CHR[addr/chrWindow]+int(addr%chrWindow))%len(c.CharacterROM)] = data
+	}
+}
+
+func (b *Banks) Mirroring() cartridge.Mirroring {
+	return b.Mirror
+}
+
+// IRQ drives the IRQ line of a board, calling the function set by SetIRQ
+// when the line changes.
+type IRQ struct {
+	Asserted bool
+	irq      func(asserted bool)
+}
+
+func (i *IRQ) SetIRQ(irq func(asserted bool)) {
+	i.irq = irq
+}
+
+func (i *IRQ) set(asserted bool) {
+	if asserted != i.Asserted {
+		i.Asserted = asserted
+		if i.irq != nil {
+			i.irq(asserted)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mapper
+
+import "github.com/dqn/gones/cartridge"
+
+// https://wiki.nesdev.com/w/index.php/MMC2
+// https://wiki.nesdev.com/w/index.php/MMC4
+
+// アドレス	       用途
+// 0xA000～0xAFFF	PRG バンク
+// 0xB000～0xCFFF	パターンテーブル 0 の CHR バンク ($FD, $FE)
+// 0xD000～0xEFFF	パターンテーブル 1 の CHR バンク ($FD, $FE)
+// 0xF000～0xFFFF	ミラーリング
+
+// MMC2 switches the banks of each pattern table by itself when the PPU
+// fetches tile $FD or $FE from it: a latch per table selects one of two
+// banks and flips after the fetch. The MMC4 is the same with 16 KiB PRG
+// banks and PRG-RAM.
+type MMC2 struct {
+	Banks
+	// CHRBanks are the 4 KiB banks of each table for latch $FD and $FE.
+	CHRBanks [2][2]uint8
+	// Latches are 0 for $FD and 1 for $FE.
+	Latches [2]uint8
+	mmc4    bool
+}
+
+func newMMC2(c *cartridge.Cartridge) cartridge.Board {
+	b := &MMC2{Banks: newBanks(c)}
+	b.setPRG(0xA000, -3, 0x2000)
+	b.setPRG(0xC000, -2, 0x2000)
+	b.setPRG(0xE000, -1, 0x2000)
+	return b
+}
+
+func newMMC4(c *cartridge.Cartridge) cartridge.Board {
+	b := &MMC2{Banks: newBanks(c), mmc4: true}
+	b.setPRG(0xC000, -1, 0x4000)
+	return b
+}
+
+func (b *MMC2) WriteProgram(addr uint16, data uint8) {
+	switch addr & 0xF000 {
+	case 0xA000:
+		if b.mmc4 {
+			b.setPRG(0x8000, int(data&0x0F), 0x4000)
+		} else {
+			b.setPRG(0x8000, int(data&0x0F), 0x2000)
+		}
+	case 0xB000, 0xC000, 0xD000, 0xE000:
+		i := (addr - 0xB000) >> 12
+		b.CHRBanks[i>>1][i&1] = data & 0x1F
+		b.updateCHR()
+	case 0xF000:
+		b.Mirror = mirrorings[data&0x01]
+	default:
+		b.Banks.WriteProgram(addr, data)
+	}
+}
+
+func (b *MMC2) updateCHR() {
+	b.setCHR(0x0000, int(b.CHRBanks[0][b.Latches[0]]), 0x1000)
+	b.setCHR(0x1000, int(b.CHRBanks[1][b.Latches[1]]), 0x1000)
+}
+
+func (b *MMC2) ReadCharacter(addr uint16) uint8 {
+	data := b.Banks.ReadCharacter(addr)
+	table := addr >> 12
+	// the MMC2 only watches the first row of the tiles in table 0
+	row := addr & 0x0FF8
+	if !b.mmc4 && table == 0 {
+		row = addr & 0x0FFF
+	}
+	switch row {
+	case 0x0FD8:
+		b.Latches[table] = 0
+	case 0x0FE8:
+		b.Latches[table] = 1
+	default:
+		return data
+	}
+	b.updateCHR()
+	return data
+}
+
+func (b *MMC2) PeekCharacter(addr uint16) uint8 {
+	return b.Banks.ReadCharacter(addr)
+}
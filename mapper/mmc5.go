@@ -0,0 +1,315 @@
+package mapper
+
+import (
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/cartridge"
+)
+
+// https://wiki.nesdev.com/w/index.php/MMC5
+
+// アドレス	       用途
+// 0x5000～0x5015	音源
+// 0x5100	      PRG バンクのモード
+// 0x5101	      CHR バンクのモード
+// 0x5102～0x5103	PRG-RAM の書き込み保護
+// 0x5104	      拡張 RAM のモード
+// 0x5105	      ネームテーブルの割り当て
+// 0x5106～0x5107	塗りつぶしのタイル、属性
+// 0x5113～0x5117	PRG バンク (0x6000, 0x8000, 0xA000, 0xC000, 0xE000)
+// 0x5120～0x512B	CHR バンク
+// 0x5130	      CHR バンクの上位ビット
+// 0x5203	      IRQ を発生させるライン
+// 0x5204	      IRQ の有効化、ステータス
+// 0x5205～0x5206	乗算
+// 0x5C00～0x5FFF	拡張 RAM
+
+// MMC5 is Nintendo's largest mapper: PRG-ROM and RAM in up to four banks
+// mixed freely, CHR banks of 1 to 8 KiB, 1 KiB of extra RAM usable as a
+// nametable or for per tile attributes, a fill nametable, a scanline IRQ,
+// a multiplier and a sound chip.
+//
+// The PPU draws 8x8 sprites only, so the CHR banks written last, set A or
+// B, are used for everything. The vertical split is not emulated.
+type MMC5 struct {
+	Banks
+	IRQ
+	PRGMode uint8
+	CHRMode uint8
+	// RAMProtect are $5102 and $5103, which must be 2 and 1 to write RAM.
+	RAMProtect [2]uint8
+	ExRAMMode  uint8
+	// Nametables selects the memory of each nametable, 2 bits each.
+	Nametables    uint8
+	FillTile      uint8
+	FillAttribute uint8
+	// PRGBanks are $5113-$5117.
+	PRGBanks [5]uint8
+	// CHRBanks are $5120-$5127 (set A) and $5128-$512B (set B).
+	CHRBanks [12]uint16
+	CHRUpper uint8
+	CHRSetB  bool
+
+	IRQCompare uint8
+	IRQEnabled bool
+	IRQPending bool
+	InFrame    bool
+
+	Multiplicand, Multiplier uint8
+
+	ExRAM [0x0400]uint8
+	// ExAttribute is the extended RAM byte of the tile being fetched, whose
+	// 4 KiB CHR bank the next ExFetches pattern reads use.
+	ExAttribute uint8
+	ExFetches   int
+
+	// Sound is the sound chip, saved with the board.
+	Sound *apu.MMC5
+	ciram []uint8
+}
+
+// $5105
+const (
+	mmc5CIRAMLower = iota
+	mmc5CIRAMUpper
+	mmc5ExRAM
+	mmc5Fill
+)
+
+func newMMC5(c *cartridge.Cartridge) cartridge.Board {
+	// the largest boards have 64 KiB of PRG-RAM
+	if len(c.ProgramRAM) < 0x10000 {
+		c.ProgramRAM = append(c.ProgramRAM, make([]uint8, 0x10000-len(c.ProgramRAM))...)
+	}
+	b := &MMC5{Banks: newBanks(c), Sound: apu.NewMMC5(cpuClock)}
+	b.PRGMode = 3
+	b.CHRMode = 3
+	b.PRGBanks[4] = 0xFF
+	return b
+}
+
+func (b *MMC5) Audio() apu.Expansion {
+	return b.Sound
+}
+
+func (b *MMC5) SetCIRAM(ciram []uint8) {
+	b.ciram = ciram
+}
+
+// prgBank returns the 8 KiB bank mapped at addr ($6000-$FFFF) and whether
+// it is in ROM.
+func (b *MMC5) prgBank(addr uint16) (int, bool) {
+	i := int(addr-0x6000) / prgWindow
+	if i == 0 {
+		return int(b.PRGBanks[0] & 0x07), false
+	}
+	// the register and the number of 8 KiB banks it maps
+	r, size := i, 1
+	switch b.PRGMode {
+	case 0:
+		r, size = 4, 4
+	case 1:
+		r, size = (i+1)&^1, 2
+	case 2:
+		if i < 3 {
+			r, size = 2, 2
+		}
+	}
+	bank := b.PRGBanks[r]
+	n := int(bank&0x7F)&^(size-1) + (i-1)%size
+	return n, r == 4 || bank&0x80 != 0
+}
+
+func (b *MMC5) ReadProgram(addr uint16) uint8 {
+	switch {
+	case addr == 0x5204:
+		data := b.PeekProgram(addr)
+		b.IRQPending = false
+		b.set(false)
+		return data
+	case addr == 0x5015:
+		data, _ := b.Sound.ReadRegister(addr)
+		return data
+	}
+	return b.PeekProgram(addr)
+}
+
+func (b *MMC5) PeekProgram(addr uint16) uint8 {
+	c := b.cartridge
+	switch {
+	case addr == 0x5204:
+		var data uint8
+		if b.IRQPending {
+			data |= 0x80
+		}
+		if b.InFrame {
+			data |= 0x40
+		}
+		return data
+	case addr == 0x5205:
+		return uint8(uint16(b.Multiplicand) * uint16(b.Multiplier))
+	case addr == 0x5206:
+		return uint8(uint16(b.Multiplicand) * uint16(b.Multiplier) >> 8)
+	case addr >= 0x5C00 && addr < 0x6000:
+		if b.ExRAMMode >= 2 {
+			return b.ExRAM[addr-0x5C00]
+		}
+	case addr >= 0x6000:
+		n, rom := b.prgBank(addr)
+		if rom {
+			return c.ProgramROM[bankOffset(len(c.ProgramROM), n, prgWindow)+int(addr%prgWindow)]
+		}
+		return c.ProgramRAM[bankOffset(len(c.ProgramRAM), n, prgWindow)+int(addr%prgWindow)]
+	}
+	return 0
+}
+
+func (b *MMC5) WriteProgram(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x5000 && addr <= 0x5015:
+		b.Sound.WriteRegister(addr, data)
+	case addr == 0x5100:
+		b.PRGMode = data & 0x03
+	case addr == 0x5101:
+		b.CHRMode = data & 0x03
+		b.updateCHR()
+	case addr == 0x5102 || addr == 0x5103:
+		b.RAMProtect[addr-0x5102] = data & 0x03
+	case addr == 0x5104:
+		b.ExRAMMode = data & 0x03
+	case addr == 0x5105:
+		b.Nametables = data
+	case addr == 0x5106:
+		b.FillTile = data
+	case addr == 0x5107:
+		b.FillAttribute = data & 0x03
+	case addr >= 0x5113 && addr <= 0x5117:
+		b.PRGBanks[addr-0x5113] = data
+	case addr >= 0x5120 && addr <= 0x512B:
+		b.CHRBanks[addr-0x5120] = uint16(b.CHRUpper)<<8 | uint16(data)
+		b.CHRSetB = addr >= 0x5128
+		b.updateCHR()
+	case addr == 0x5130:
+		b.CHRUpper = data & 0x03
+	case addr == 0x5203:
+		b.IRQCompare = data
+	case addr == 0x5204:
+		b.IRQEnabled = data&0x80 != 0
+		b.set(b.IRQEnabled && b.IRQPending)
+	case addr == 0x5205:
+		b.Multiplicand = data
+	case addr == 0x5206:
+		b.Multiplier = data
+	case addr >= 0x5C00 && addr < 0x6000:
+		if b.ExRAMMode != 3 {
+			b.ExRAM[addr-0x5C00] = data
+		}
+	case addr >= 0x6000:
+		if b.RAMProtect == [2]uint8{2, 1} {
+			b.PokeProgram(addr, data)
+		}
+	}
+}
+
+func (b *MMC5) PokeProgram(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x5C00 && addr < 0x6000:
+		b.ExRAM[addr-0x5C00] = data
+	case addr >= 0x6000:
+		if n, rom := b.prgBank(addr); !rom {
+			c := b.cartridge
+			c.ProgramRAM[bankOffset(len(c.ProgramRAM), n, prgWindow)+int(addr%prgWindow)] = data
+		}
+	}
+}
+
+func (b *MMC5) updateCHR() {
+	regs := b.CHRBanks[:8]
+	if b.CHRSetB {
+		regs = []uint16{
+			b.CHRBanks[8], b.CHRBanks[9], b.CHRBanks[10], b.CHRBanks[11],
+			b.CHRBanks[8], b.CHRBanks[9], b.CHRBanks[10], b.CHRBanks[11],
+		}
+	}
+	// mode 0 maps 8 KiB with the last register, mode 3 eight 1 KiB banks
+	n := 1 << b.CHRMode
+	size := 0x2000 / n
+	for i := 0; i < n; i++ {
+		b.setCHR(uint16(i*size), int(regs[(i+1)*(8/n)-1]), size)
+	}
+}
+
+func (b *MMC5) ReadCharacter(addr uint16) uint8 {
+	if b.ExFetches > 0 {
+		b.ExFetches--
+		c := b.cartridge.CharacterROM
+		bank := int(b.ExAttribute&0x3F) | int(b.CHRUpper)<<6
+		return c[bankOffset(len(c), bank, 0x1000)+int(addr&0x0FFF)]
+	}
+	return b.Banks.ReadCharacter(addr)
+}
+
+func (b *MMC5) ReadNametable(addr uint16) uint8 {
+	if b.ExRAMMode == 1 {
+		offset := addr & 0x03FF
+		if offset < 0x03C0 {
+			b.ExAttribute = b.ExRAM[offset]
+			b.ExFetches = 2
+		} else {
+			// the palette of the tile on all four quadrants
+			return b.ExAttribute >> 6 * 0x55
+		}
+	}
+	return b.PeekNametable(addr)
+}
+
+func (b *MMC5) PeekNametable(addr uint16) uint8 {
+	offset := addr & 0x03FF
+	switch b.Nametables >> (addr >> 10 & 0x03 * 2) & 0x03 {
+	case mmc5CIRAMLower:
+		return b.ciram[offset]
+	case mmc5CIRAMUpper:
+		return b.ciram[0x0400+offset]
+	case mmc5ExRAM:
+		if b.ExRAMMode < 2 {
+			return b.ExRAM[offset]
+		}
+	case mmc5Fill:
+		if offset < 0x03C0 {
+			return b.FillTile
+		}
+		return b.FillAttribute * 0x55
+	}
+	return 0
+}
+
+func (b *MMC5) WriteNametable(addr uint16, data uint8) {
+	offset := addr & 0x03FF
+	switch b.Nametables >> (addr >> 10 & 0x03 * 2) & 0x03 {
+	case mmc5CIRAMLower:
+		b.ciram[offset] = data
+	case mmc5CIRAMUpper:
+		b.ciram[0x0400+offset] = data
+	case mmc5ExRAM:
+		if b.ExRAMMode < 2 {
+			b.ExRAM[offset] = data
+		}
+	}
+}
+
+// Scanline counts the lines of a frame, raising the IRQ on the line set
+// at $5203.
+func (b *MMC5) Scanline(line int) {
+	if line >= 240 {
+		b.InFrame = false
+		return
+	}
+	if !b.InFrame {
+		b.InFrame = true
+		b.IRQPending = false
+		b.set(false)
+	}
+	if line != 0 && line == int(b.IRQCompare) {
+		b.IRQPending = true
+		b.set(b.IRQEnabled)
+	}
+}
@@ -0,0 +1,158 @@
+package mapper
+
+import (
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/cartridge"
+)
+
+// https://wiki.nesdev.com/w/index.php/INES_Mapper_019
+
+// アドレス	       用途
+// 0x4800～0x4FFF	音源のデータ
+// 0x5000～0x57FF	IRQ カウンタ (下位)
+// 0x5800～0x5FFF	IRQ カウンタ (上位)、IRQ の有効化
+// 0x8000～0xBFFF	CHR バンク 0～7
+// 0xC000～0xDFFF	ネームテーブルのバンク 0～3
+// 0xE000～0xE7FF	PRG バンク 0 (0x8000)
+// 0xE800～0xEFFF	PRG バンク 1 (0xA000)、CIRAM の無効化
+// 0xF000～0xF7FF	PRG バンク 2 (0xC000)
+// 0xF800～0xFFFF	音源のアドレス
+
+// N163 is the Namco 163: 1 KiB banks for the pattern tables and the
+// nametables taken from CHR-ROM or, for banks $E0-$FF, from the console's
+// VRAM, 8 KiB PRG banks, a 15-bit IRQ counter of CPU cycles and up to
+// eight wavetable sound channels.
+type N163 struct {
+	Banks
+	IRQ
+	// CHRBanks are the eight pattern table banks, then the four nametables.
+	CHRBanks [12]uint8
+	// ROMOnly disables VRAM banks in each pattern table.
+	ROMOnly    [2]bool
+	Counter    uint16
+	IRQEnabled bool
+	// Sound is the sound chip, saved with the board.
+	Sound *apu.N163
+	ciram []uint8
+}
+
+func newN163(c *cartridge.Cartridge) cartridge.Board {
+	b := &N163{Banks: newBanks(c), Sound: apu.NewN163()}
+	b.setPRG(0xE000, -1, prgWindow)
+	// nametables start vertically mirrored from VRAM
+	b.CHRBanks[8], b.CHRBanks[9], b.CHRBanks[10], b.CHRBanks[11] = 0xE0, 0xE1, 0xE0, 0xE1
+	return b
+}
+
+func (b *N163) Audio() apu.Expansion {
+	return b.Sound
+}
+
+func (b *N163) SetCIRAM(ciram []uint8) {
+	b.ciram = ciram
+}
+
+func (b *N163) ReadProgram(addr uint16) uint8 {
+	switch {
+	case addr >= 0x4800 && addr < 0x5000:
+		data, _ := b.Sound.ReadRegister(0x4800)
+		return data
+	case addr >= 0x5000 && addr < 0x6000:
+		return b.PeekProgram(addr)
+	}
+	return b.Banks.ReadProgram(addr)
+}
+
+func (b *N163) PeekProgram(addr uint16) uint8 {
+	switch {
+	case addr >= 0x4800 && addr < 0x5000:
+		// reading the sound RAM moves the address, show the RAM alone
+		return 0
+	case addr >= 0x5000 && addr < 0x5800:
+		return uint8(b.Counter)
+	case addr >= 0x5800 && addr < 0x6000:
+		data := uint8(b.Counter >> 8)
+		if b.IRQEnabled {
+			data |= 0x80
+		}
+		return data
+	}
+	return b.Banks.ReadProgram(addr)
+}
+
+func (b *N163) WriteProgram(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x4800 && addr < 0x5000:
+		b.Sound.WriteRegister(0x4800, data)
+	case addr >= 0x5000 && addr < 0x5800:
+		b.Counter = b.Counter&0x7F00 | uint16(data)
+		b.set(false)
+	case addr >= 0x5800 && addr < 0x6000:
+		b.Counter = b.Counter&0x00FF | uint16(data&0x7F)<<8
+		b.IRQEnabled = data&0x80 != 0
+		b.set(false)
+	case addr >= 0x8000 && addr < 0xE000:
+		b.CHRBanks[(addr-0x8000)/0x0800] = data
+	case addr >= 0xE000 && addr < 0xE800:
+		b.setPRG(0x8000, int(data&0x3F), prgWindow)
+	case addr >= 0xE800 && addr < 0xF000:
+		b.setPRG(0xA000, int(data&0x3F), prgWindow)
+		b.ROMOnly[0], b.ROMOnly[1] = data&0x40 != 0, data&0x80 != 0
+	case addr >= 0xF000 && addr < 0xF800:
+		b.setPRG(0xC000, int(data&0x3F), prgWindow)
+	case addr >= 0xF800:
+		b.Sound.WriteRegister(0xF800, data)
+	default:
+		b.Banks.WriteProgram(addr, data)
+	}
+}
+
+// bank returns the memory and the offset of a 1 KiB bank.
+func (b *N163) bank(bank uint8, romOnly bool) ([]uint8, int) {
+	if bank >= 0xE0 && !romOnly {
+		return b.ciram, int(bank&0x01) * chrWindow
+	}
+	c := b.cartridge.CharacterROM
+	return c, bankOffset(len(c), int(bank), chrWindow)
+}
+
+func (b *N163) ReadCharacter(addr uint16) uint8 {
+	mem, offset := b.bank(b.CHRBanks[addr/chrWindow], b.ROMOnly[addr>>12])
+	return mem[offset+int(addr%chrWindow)]
+}
+
+func (b *N163) PeekCharacter(addr uint16) uint8 {
+	return b.ReadCharacter(addr)
+}
+
+func (b *N163) WriteCharacter(addr uint16, data uint8) {
+	bank, romOnly := b.CHRBanks[addr/chrWindow], b.ROMOnly[addr>>12]
+	if bank >= 0xE0 && !romOnly || b.cartridge.HasCharacterRAM() {
+		mem, offset := b.bank(bank, romOnly)
+		mem[offset+int(addr%chrWindow)] = data
+	}
+}
+
+func (b *N163) ReadNametable(addr uint16) uint8 {
+	mem, offset := b.bank(b.CHRBanks[8+addr>>10&0x03], false)
+	return mem[offset+int(addr%chrWindow)]
+}
+
+func (b *N163) PeekNametable(addr uint16) uint8 {
+	return b.ReadNametable(addr)
+}
+
+func (b *N163) WriteNametable(addr uint16, data uint8) {
+	if bank := b.CHRBanks[8+addr>>10&0x03]; bank >= 0xE0 {
+		b.ciram[int(bank&0x01)*chrWindow+int(addr%chrWindow)] = data
+	}
+}
+
+// Step counts a CPU cycle up to $7FFF, where the IRQ fires.
+func (b *N163) Step() {
+	if b.IRQEnabled && b.Counter < 0x7FFF {
+		if b.Counter++; b.Counter == 0x7FFF {
+			b.set(true)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package mapper
+
+import "github.com/dqn/gones/cartridge"
+
+// https://wiki.nesdev.com/w/index.php/VRC2_and_VRC4
+
+// アドレス	       用途
+// 0x8000～0x8003	PRG バンク 0
+// 0x9000～0x9001	ミラーリング
+// 0x9002	      PRG バンクのモード (VRC4)
+// 0xA000～0xA003	PRG バンク 1
+// 0xB000～0xE003	CHR バンク 0～7 (下位 4 ビット, 上位ビット)
+// 0xF000～0xF001	IRQ カウンタのリロード値 (下位, 上位 4 ビット)
+// 0xF002	      IRQ の制御 (VRC4)
+// 0xF003	      IRQ の確認 (VRC4)
+
+// vrcLines are the CPU address lines wired to the two register select
+// inputs of each mapper. A mapper number covers boards wired in two ways,
+// so both lines of each input are decoded.
+var vrcLines = map[uint8][2]uint16{
+	21: {0x0002 | 0x0040, 0x0004 | 0x0080}, // VRC4a, VRC4c
+	22: {0x0002, 0x0001},                   // VRC2a
+	23: {0x0001 | 0x0004, 0x0002 | 0x0008}, // VRC2b, VRC4f, VRC4e
+	25: {0x0002 | 0x0008, 0x0001 | 0x0004}, // VRC2c, VRC4b, VRC4d
+}
+
+// VRC is a Konami VRC2 or VRC4: two switchable 8 KiB PRG banks, eight
+// 1 KiB CHR banks and, on the VRC4, an IRQ counter clocked by CPU cycles
+// or, through a prescaler, by scanlines.
+type VRC struct {
+	Banks
+	IRQ
+	PRGBanks [2]uint8
+	// PRGSwap maps the second to last bank at $8000 and PRGBanks[0] at $C000.
+	PRGSwap  bool
+	CHRBanks [8]uint16
+
+	IRQLatch   uint8
+	IRQCounter uint8
+	IRQControl uint8
+	// Prescaler counts the 341 PPU dots of a line in thirds of a CPU cycle.
+	Prescaler int
+
+	lines [2]uint16
+	// vrc2a has CHR banks in 2 KiB units, shifted out by the board.
+	vrc2a bool
+}
+
+// $F002
+const (
+	vrcIRQAfterAck = 0x01
+	vrcIRQEnable   = 0x02
+	vrcIRQCycles   = 0x04
+)
+
+func newVRC(mapper uint8) func(c *cartridge.Cartridge) cartridge.Board {
+	return func(c *cartridge.Cartridge) cartridge.Board {
+		b := &VRC{Banks: newBanks(c), lines: vrcLines[mapper], vrc2a: mapper == 22}
+		b.updatePRG()
+		return b
+	}
+}
+
+// register returns the register written at addr, $x000-$x003.
+func (b *VRC) register(addr uint16) uint16 {
+	r := addr & 0xF000
+	if addr&b.lines[0] != 0 {
+		r |= 1
+	}
+	if addr&b.lines[1] != 0 {
+		r |= 2
+	}
+	return r
+}
+
+func (b *VRC) WriteProgram(addr uint16, data uint8) {
+	if addr < 0x8000 {
+		b.Banks.WriteProgram(addr, data)
+		return
+	}
+	switch r := b.register(addr); {
+	case r&0xF000 == 0x8000:
+		b.PRGBanks[0] = data & 0x1F
+		b.updatePRG()
+	case r&0xF000 == 0xA000:
+		b.PRGBanks[1] = data & 0x1F
+		b.updatePRG()
+	case r == 0x9002 && !b.vrc2a:
+		b.PRGSwap = data&0x02 != 0
+		b.updatePRG()
+	case r&0xF000 == 0x9000 && (b.vrc2a || r < 0x9002):
+		if b.vrc2a {
+			data &= 0x01
+		}
+		b.Mirror = mirrorings[data&0x03]
+	case r >= 0xB000 && r < 0xF000:
+		i := (r-0xB000)>>12<<1 | r>>1&1
+		if r&1 == 0 {
+			b.CHRBanks[i] = b.CHRBanks[i]&0x1F0 | uint16(data&0x0F)
+		} else {
+			b.CHRBanks[i] = b.CHRBanks[i]&0x00F | uint16(data&0x1F)<<4
+		}
+		bank := int(b.CHRBanks[i])
+		if b.vrc2a {
+			bank >>= 1
+		}
+		b.setCHR(uint16(i)*chrWindow, bank, chrWindow)
+	case r == 0xF000:
+		b.IRQLatch = b.IRQLatch&0xF0 | data&0x0F
+	case r == 0xF001:
+		b.IRQLatch = b.IRQLatch&0x0F | data<<4
+	case r == 0xF002:
+		b.IRQControl = data & 0x07
+		if data&vrcIRQEnable != 0 {
+			b.IRQCounter = b.IRQLatch
+			b.Prescaler = 341
+		}
+		b.set(false)
+	case r == 0xF003:
+		if b.IRQControl&vrcIRQAfterAck != 0 {
+			b.IRQControl |= vrcIRQEnable
+		} else {
+			b.IRQControl &^= vrcIRQEnable
+		}
+		b.set(false)
+	}
+}
+
+func (b *VRC) updatePRG() {
+	first, third := int(b.PRGBanks[0]), -2
+	if b.PRGSwap {
+		first, third = third, first
+	}
+	b.setPRG(0x8000, first, prgWindow)
+	b.setPRG(0xA000, int(b.PRGBanks[1]), prgWindow)
+	b.setPRG(0xC000, third, prgWindow)
+	b.setPRG(0xE000, -1, prgWindow)
+}
+
+// Step runs the IRQ counter for a CPU cycle.
+func (b *VRC) Step() {
+	if b.IRQControl&vrcIRQEnable == 0 {
+		return
+	}
+	if b.IRQControl&vrcIRQCycles == 0 {
+		if b.Prescaler -= 3; b.Prescaler > 0 {
+			return
+		}
+		b.Prescaler += 341
+	}
+	if b.IRQCounter == 0xFF {
+		b.IRQCounter = b.IRQLatch
+		b.set(true)
+	} else {
+		b.IRQCounter++
+	}
+}
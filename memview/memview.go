@@ -0,0 +1,173 @@
+package memview
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChangeFrames is how many frames a changed byte stays highlighted.
+const ChangeFrames = 60
+
+// Region is a block of memory that can be browsed. Peek and Poke take an
+// offset from the start of the region; Base is the address shown for
+// offset 0.
+type Region struct {
+	Name string
+	Base int
+	Size int
+	Peek func(offset int) uint8
+	Poke func(offset int, data uint8)
+}
+
+// SliceRegion makes a region over buf. Edits write through to buf.
+func SliceRegion(name string, base int, buf []uint8) Region {
+	return Region{
+		Name: name,
+		Base: base,
+		Size: len(buf),
+		Peek: func(offset int) uint8 { return buf[offset] },
+		Poke: func(offset int, data uint8) { buf[offset] = data },
+	}
+}
+
+// Viewer browses a set of regions, tracking which bytes of the current
+// region changed recently and editing them a nibble at a time.
+type Viewer struct {
+	regions []Region
+	current int
+	// top is the offset of the first row on screen.
+	top     int
+	rows    int
+	columns int
+	cursor  int
+	// nibble is set after the high nibble of the cursor byte was typed.
+	nibble bool
+
+	snapshot []uint8
+	// age counts the frames since each byte last changed.
+	age []int
+}
+
+// New makes a viewer showing rows x columns bytes at a time.
+func New(rows, columns int, regions ...Region) *Viewer {
+	v := &Viewer{regions: regions, rows: rows, columns: columns}
+	v.reset()
+	return v
+}
+
+func (v *Viewer) reset() {
+	r := v.Region()
+	v.top, v.cursor, v.nibble = 0, 0, false
+	v.snapshot = make([]uint8, r.Size)
+	v.age = make([]int, r.Size)
+	for i := range v.snapshot {
+		v.snapshot[i] = r.Peek(i)
+		v.age[i] = ChangeFrames
+	}
+}
+
+func (v *Viewer) Region() *Region {
+	return &v.regions[v.current]
+}
+
+// NextRegion switches to the next region, or the previous one if d is negative.
+func (v *Viewer) NextRegion(d int) {
+	n := len(v.regions)
+	v.current = ((v.current+d)%n + n) % n
+	v.reset()
+}
+
+// Update compares the current region with the last frame. It should be
+// called once per frame.
+func (v *Viewer) Update() {
+	r := v.Region()
+	for i := range v.snapshot {
+		d := r.Peek(i)
+		if d != v.snapshot[i] {
+			v.snapshot[i] = d
+			v.age[i] = 0
+		} else if v.age[i] < ChangeFrames {
+			v.age[i]++
+		}
+	}
+}
+
+// Changed reports whether the byte at offset changed within ChangeFrames.
+func (v *Viewer) Changed(offset int) bool {
+	return offset >= 0 && offset < len(v.age) && v.age[offset] < ChangeFrames
+}
+
+// Cursor returns the offset of the selected byte.
+func (v *Viewer) Cursor() int {
+	return v.cursor
+}
+
+// Top returns the offset of the first visible row.
+func (v *Viewer) Top() int {
+	return v.top
+}
+
+// Move moves the cursor by d bytes, scrolling to keep it visible.
+func (v *Viewer) Move(d int) {
+	size := v.Region().Size
+	v.cursor += d
+	if v.cursor < 0 {
+		v.cursor = 0
+	}
+	if v.cursor >= size {
+		v.cursor = size - 1
+	}
+	v.nibble = false
+	if v.cursor < v.top {
+		v.top = v.cursor / v.columns * v.columns
+	}
+	if last := v.top + v.rows*v.columns; v.cursor >= last {
+		v.top = (v.cursor/v.columns - v.rows + 1) * v.columns
+	}
+}
+
+// Page moves the cursor by d screens.
+func (v *Viewer) Page(d int) {
+	v.Move(d * v.rows * v.columns)
+}
+
+// Goto moves the cursor to the given address.
+func (v *Viewer) Goto(addr int) {
+	v.Move(addr - v.Region().Base - v.cursor)
+}
+
+// Type enters a hex digit at the cursor. The byte is written once both
+// nibbles have been typed and the cursor moves on.
+func (v *Viewer) Type(digit uint8) {
+	r := v.Region()
+	if r.Poke == nil {
+		return
+	}
+	d := r.Peek(v.cursor)
+	if !v.nibble {
+		r.Poke(v.cursor, digit<<4|d&0x0F)
+		v.nibble = true
+		return
+	}
+	r.Poke(v.cursor, d&0xF0|digit&0x0F)
+	v.Move(1)
+}
+
+// Rows returns the visible rows as an address followed by the bytes.
+func (v *Viewer) Rows() []string {
+	var rows []string
+	r := v.Region()
+	for i := 0; i < v.rows; i++ {
+		offset := v.top + i*v.columns
+		if offset >= r.Size {
+			break
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%04X ", r.Base+offset)
+		for j := 0; j < v.columns && offset+j < r.Size; j++ {
+			fmt.Fprintf(&sb, " %02X", r.Peek(offset+j))
+		}
+		rows = append(rows, sb.String())
+	}
+	return rows
+}
@@ -0,0 +1,109 @@
+package movie
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// http://fceux.com/web/help/fm2.html
+
+const (
+	CommandSoftReset = 1 << iota
+	CommandHardReset
+)
+
+// buttons of an input log entry from left to right, as controller bits
+const buttonOrder = "RLDUTSBA"
+
+type Frame struct {
+	Commands uint8
+	// Ports holds the buttons of each controller in controller.Button bit order.
+	Ports [4]uint8
+}
+
+type Movie struct {
+	Header map[string]string
+	Frames []Frame
+}
+
+func Parse(r io.Reader) (*Movie, error) {
+	m := &Movie{Header: map[string]string{}}
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		text := strings.TrimRight(s.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		if !strings.HasPrefix(text, "|") {
+			kv := strings.SplitN(text, " ", 2)
+			if len(kv) == 2 {
+				m.Header[kv[0]] = kv[1]
+			} else {
+				m.Header[kv[0]] = ""
+			}
+			continue
+		}
+		f, err := parseFrame(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		m.Frames = append(m.Frames, f)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if m.Header["binary"] == "1" {
+		return nil, fmt.Errorf("binary input logs are not supported")
+	}
+	return m, nil
+}
+
+func parseFrame(text string) (Frame, error) {
+	var f Frame
+	fields := strings.Split(strings.Trim(text, "|"), "|")
+	if len(fields) == 0 {
+		return f, fmt.Errorf("invalid input log: %q", text)
+	}
+
+	var commands int
+	if _, err := fmt.Sscanf(fields[0], "%d", &commands); err != nil {
+		return f, fmt.Errorf("invalid commands: %q", fields[0])
+	}
+	f.Commands = uint8(commands)
+
+	for i, field := range fields[1:] {
+		if i >= len(f.Ports) {
+			break
+		}
+		if field == "" {
+			continue
+		}
+		if len(field) != len(buttonOrder) {
+			return f, fmt.Errorf("invalid buttons: %q", field)
+		}
+		for j := 0; j < len(buttonOrder); j++ {
+			if field[j] != '.' && field[j] != ' ' {
+				f.Ports[i] |= 1 << (len(buttonOrder) - 1 - j)
+			}
+		}
+	}
+	return f, nil
+}
+
+func Load(path string) (*Movie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,151 @@
+package nes
+
+import (
+	"sync"
+
+	"github.com/dqn/gones/apu"
+	"github.com/hajimehoshi/ebiten/audio"
+)
+
+const (
+	// audioBuffer is the length of the ring buffer in seconds. The
+	// resampling ratio is nudged to keep it half full.
+	audioBuffer = 0.1
+	// maxRateDelta is the largest relative change of the ratio, small
+	// enough not to be heard as a change of pitch.
+	maxRateDelta = 0.005
+	// bytes of a 16-bit stereo sample
+	bytesPerSample = 4
+)
+
+// audioOutput resamples the APU output and plays it. The frame loop is
+// synced to the video, so the clocks of the emulation and of the sound
+// card drift apart; dynamic rate control makes up for it.
+// https://github.com/libretro/docs/blob/master/archive/ratecontrol.pdf
+type audioOutput struct {
+	resampler *apu.Resampler
+	ratio     float64
+	ring      *ring
+	player    *audio.Player
+	samples   []float32
+	bytes     []byte
+}
+
+func newAudioOutput(sampleRate int, clockRate float64) (*audioOutput, error) {
+	ctx, err := audio.NewContext(sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	r := newRing(int(float64(sampleRate)*audioBuffer) * bytesPerSample)
+	player, err := audio.NewPlayer(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := player.Play(); err != nil {
+		return nil, err
+	}
+	ratio := float64(sampleRate) / clockRate
+	return &audioOutput{
+		resampler: apu.NewResampler(clockRate, float64(sampleRate)),
+		ratio:     ratio,
+		ring:      r,
+		player:    player,
+		samples:   make([]float32, sampleRate/10),
+	}, nil
+}
+
+// flush moves the resampled audio to the ring buffer. Samples that do not
+// fit are dropped, which happens while fast-forwarding; in slow motion the
+// buffer runs dry and plays silence.
+func (o *audioOutput) flush() {
+	for {
+		n := o.resampler.Read(o.samples)
+		if n == 0 {
+			break
+		}
+		o.bytes = o.bytes[:0]
+		for _, s := range o.samples[:n] {
+			v := int16(clamp(s, -1, 1) * 0x7FFF)
+			o.bytes = append(o.bytes, byte(v), byte(v>>8), byte(v), byte(v>>8))
+		}
+		o.ring.write(o.bytes)
+	}
+
+	fill := o.ring.fill()
+	o.resampler.SetRatio(o.ratio * (1 + maxRateDelta*(1-2*fill)))
+}
+
+func clamp(v, min, max float32) float32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// ring is a fixed size byte queue shared with the audio player.
+type ring struct {
+	mu  sync.Mutex
+	buf []byte
+	// start is the read position and n the number of queued bytes.
+	start int
+	n     int
+}
+
+func newRing(size int) *ring {
+	return &ring{buf: make([]byte, size)}
+}
+
+// write queues as much of p as fits.
+func (r *ring) write(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if free := len(r.buf) - r.n; len(p) > free {
+		p = p[:free-free%bytesPerSample]
+	}
+	for len(p) > 0 {
+		end := (r.start + r.n) % len(r.buf)
+		free := r.buf[end:]
+		if end < r.start {
+			free = r.buf[end:r.start]
+		}
+		c := copy(free, p)
+		r.n += c
+		p = p[c:]
+	}
+}
+
+// Read implements io.Reader for the player. It never blocks: when the
+// queue runs dry the rest of p is silence.
+func (r *ring) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	read := 0
+	for read < len(p) && r.n > 0 {
+		end := r.start + r.n
+		if end > len(r.buf) {
+			end = len(r.buf)
+		}
+		c := copy(p[read:], r.buf[r.start:end])
+		r.start = (r.start + c) % len(r.buf)
+		r.n -= c
+		read += c
+	}
+	for i := read; i < len(p); i++ {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func (r *ring) Close() error {
+	return nil
+}
+
+// fill returns how full the queue is, from 0 to 1.
+func (r *ring) fill() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return float64(r.n) / float64(len(r.buf))
+}
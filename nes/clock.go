@@ -0,0 +1,50 @@
+package nes
+
+import (
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/ppu"
+	"github.com/dqn/gones/region"
+)
+
+// clock is the master clock. The CPU bus ticks it once per CPU cycle,
+// before each memory access, and it runs the APU for the cycle and the
+// PPU for the same number of master clock cycles so register accesses
+// land on the right dot.
+type clock struct {
+	region *region.Region
+	ppu    *ppu.PPU
+	apu    *apu.APU
+	// board is the cartridge board if it counts CPU cycles.
+	board stepper
+	// resampler receives the APU output when audio is enabled.
+	resampler *apu.Resampler
+	recorder  *recorder
+	// lag is the number of master clock cycles the PPU is behind the CPU.
+	lag       uint
+	frameDone bool
+}
+
+// stepper is a cartridge.Board with a Step method.
+type stepper interface {
+	Step()
+}
+
+func (c *clock) Tick() {
+	if c.board != nil {
+		c.board.Step()
+	}
+	c.apu.Step()
+	if c.resampler != nil {
+		c.resampler.Add(c.apu.Output())
+	}
+	if c.recorder != nil {
+		c.recorder.add(c.apu)
+	}
+	c.lag += c.region.CPUDivider
+	for c.lag >= c.region.PPUDivider {
+		c.lag -= c.region.PPUDivider
+		if c.ppu.Step() {
+			c.frameDone = true
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package nes
+
+import (
+	"fmt"
+
+	"github.com/dqn/gones/controller"
+)
+
+// Port1Devices, Port2Devices and ExpansionDevices are the names accepted by Options.
+var (
+	Port1Devices     = []string{"controller", "fourscore", "none"}
+	Port2Devices     = []string{"controller", "zapper", "vaus", "powerpad", "fourscore", "none"}
+	ExpansionDevices = []string{"none", "controllers", "vaus"}
+)
+
+func (n *NES) connectDevices(port1, port2, expansion string) (*controller.Ports, error) {
+	for i := range n.controllers {
+		n.controllers[i] = &controller.Controller{}
+	}
+
+	if port1 == "fourscore" || port2 == "fourscore" {
+		if port1 != port2 {
+			return nil, fmt.Errorf("four score must be plugged into both ports")
+		}
+		f := controller.NewFourScore(n.controllers)
+		e, err := n.expansionDevice(expansion)
+		if err != nil {
+			return nil, err
+		}
+		return controller.NewPorts(f.Port(0), f.Port(1), e), nil
+	}
+
+	var p1, p2 controller.Device
+	switch port1 {
+	case "controller":
+		p1 = n.controllers[0]
+	case "none":
+	default:
+		return nil, fmt.Errorf("unknown port 1 device: %s", port1)
+	}
+
+	switch port2 {
+	case "controller":
+		p2 = n.controllers[1]
+	case "zapper":
+		n.zapper = controller.NewZapper(n.ppu)
+		p2 = n.zapper
+	case "vaus":
+		n.vaus = controller.NewVaus()
+		p2 = n.vaus
+	case "powerpad":
+		n.powerPad = &controller.PowerPad{}
+		p2 = n.powerPad
+	case "none":
+	default:
+		return nil, fmt.Errorf("unknown port 2 device: %s", port2)
+	}
+
+	e, err := n.expansionDevice(expansion)
+	if err != nil {
+		return nil, err
+	}
+	return controller.NewPorts(p1, p2, e), nil
+}
+
+func (n *NES) expansionDevice(name string) (controller.ExpansionDevice, error) {
+	switch name {
+	case "none":
+		return nil, nil
+	case "controllers":
+		return controller.NewFamicomControllers(n.controllers[2], n.controllers[3]), nil
+	case "vaus":
+		if n.vaus != nil {
+			return nil, fmt.Errorf("only one vaus can be connected")
+		}
+		v := controller.NewFamicomVaus()
+		n.vaus = v.Vaus
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unknown expansion device: %s", name)
+	}
+}
+
+func (n *NES) updateDevices() {
+	n.input.Update(n.controllers[:]...)
+	if n.zapper != nil {
+		n.input.UpdateZapper(n.zapper)
+	}
+	if n.vaus != nil {
+		n.input.UpdateVaus(n.vaus)
+	}
+	if n.powerPad != nil {
+		n.input.UpdatePowerPad(n.powerPad)
+	}
+}
@@ -0,0 +1,31 @@
+package nes
+
+import (
+	"fmt"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+// switchSideKey ejects the disk and inserts the next side (disk 1 side B
+// after side A, then disk 2 side A, ...) when running a disk image.
+const switchSideKey = ebiten.KeyF10
+
+func (n *NES) updateDisk() {
+	if n.disk != nil && inpututil.IsKeyJustPressed(switchSideKey) {
+		n.disk.SwitchSide()
+	}
+}
+
+// drawDisk shows the side being inserted while the drive is empty.
+func (n *NES) drawDisk(screen *ebiten.Image) {
+	if n.disk == nil || n.disk.Side >= 0 {
+		return
+	}
+	msg := "disk ejected"
+	if side := n.disk.Inserting; side >= 0 {
+		msg = fmt.Sprintf("inserting disk %d side %c", side/2+1, 'A'+side%2)
+	}
+	ebitenutil.DebugPrintAt(screen, msg, charWidth, height-2*charHeight)
+}
@@ -0,0 +1,158 @@
+package nes
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/dqn/gones/disasm"
+	"github.com/dqn/gones/memview"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+// The memory viewer is toggled with F6. While it is open the keyboard
+// edits memory instead of playing:
+//
+//	Tab / Shift+Tab   next / previous region
+//	arrows, PageUp/PageDown   move the cursor
+//	0-9, A-F          type a byte at the cursor
+const (
+	memviewRows    = 14
+	memviewColumns = 8
+	// size of a character of the debug font
+	charWidth  = 6
+	charHeight = 16
+)
+
+var (
+	memviewBackground = color.RGBA{0x00, 0x00, 0x00, 0xD0}
+	memviewChanged    = color.RGBA{0xA0, 0x20, 0x20, 0xFF}
+	memviewCursor     = color.RGBA{0x20, 0x40, 0xC0, 0xFF}
+)
+
+var hexKeys = map[ebiten.Key]uint8{
+	ebiten.Key0: 0x0, ebiten.Key1: 0x1, ebiten.Key2: 0x2, ebiten.Key3: 0x3,
+	ebiten.Key4: 0x4, ebiten.Key5: 0x5, ebiten.Key6: 0x6, ebiten.Key7: 0x7,
+	ebiten.Key8: 0x8, ebiten.Key9: 0x9, ebiten.KeyA: 0xA, ebiten.KeyB: 0xB,
+	ebiten.KeyC: 0xC, ebiten.KeyD: 0xD, ebiten.KeyE: 0xE, ebiten.KeyF: 0xF,
+}
+
+func (n *NES) memoryRegions() []memview.Region {
+	cpuBus, ppuBus := n.cpu.Bus(), n.ppu.Bus()
+	regions := []memview.Region{
+		{
+			Name: "CPU",
+			Size: 0x10000,
+			Peek: func(i int) uint8 { return cpuBus.Peek(uint16(i)) },
+			Poke: func(i int, data uint8) { cpuBus.Poke(uint16(i), data) },
+		},
+		{
+			Name: "RAM",
+			Size: 0x0800,
+			Peek: func(i int) uint8 { return cpuBus.Peek(uint16(i)) },
+			Poke: func(i int, data uint8) { cpuBus.Poke(uint16(i), data) },
+		},
+		memview.SliceRegion("PRG-RAM", 0x6000, n.cartridge.ProgramRAM),
+	}
+	for _, b := range disasm.Banks(n.cartridge.ProgramROM, n.cartridge.Mapper) {
+		regions = append(regions, memview.SliceRegion(fmt.Sprintf("PRG-ROM bank %d", b.Number), int(b.Address), b.Data))
+	}
+	ppuRegion := func(name string, base, size int) memview.Region {
+		return memview.Region{
+			Name: name,
+			Base: base,
+			Size: size,
+			Peek: func(i int) uint8 { return ppuBus.Peek(uint16(base + i)) },
+			Poke: func(i int, data uint8) { ppuBus.Poke(uint16(base+i), data) },
+		}
+	}
+	return append(regions,
+		ppuRegion("PPU", 0x0000, 0x4000),
+		ppuRegion("VRAM", 0x2000, 0x1000),
+		ppuRegion("Palette", 0x3F00, 0x0020),
+		memview.Region{
+			Name: "OAM",
+			Size: 0x0100,
+			Peek: func(i int) uint8 { return n.ppu.PeekOAM(uint8(i)) },
+			Poke: func(i int, data uint8) { n.ppu.PokeOAM(uint8(i), data) },
+		},
+	)
+}
+
+// repeated reports a key press, repeating while the key is held.
+func repeated(k ebiten.Key) bool {
+	d := inpututil.KeyPressDuration(k)
+	return d == 1 || d >= 20 && d%4 == 0
+}
+
+// updateMemview handles the viewer keys and reports whether it is open.
+func (n *NES) updateMemview() bool {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF6) {
+		if n.memview == nil {
+			n.memview = memview.New(memviewRows, memviewColumns, n.memoryRegions()...)
+		}
+		n.memviewOpen = !n.memviewOpen
+	}
+	if !n.memviewOpen {
+		return false
+	}
+
+	v := n.memview
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			v.NextRegion(-1)
+		} else {
+			v.NextRegion(1)
+		}
+	}
+	switch {
+	case repeated(ebiten.KeyLeft):
+		v.Move(-1)
+	case repeated(ebiten.KeyRight):
+		v.Move(1)
+	case repeated(ebiten.KeyUp):
+		v.Move(-memviewColumns)
+	case repeated(ebiten.KeyDown):
+		v.Move(memviewColumns)
+	case repeated(ebiten.KeyPageUp):
+		v.Page(-1)
+	case repeated(ebiten.KeyPageDown):
+		v.Page(1)
+	}
+	for k, d := range hexKeys {
+		if inpututil.IsKeyJustPressed(k) {
+			v.Type(d)
+		}
+	}
+	return true
+}
+
+func (n *NES) drawMemview(screen *ebiten.Image) {
+	if !n.memviewOpen {
+		return
+	}
+	v := n.memview
+	v.Update()
+	ebitenutil.DrawRect(screen, 0, 0, width, height, memviewBackground)
+
+	r := v.Region()
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s  $%04X", r.Name, r.Base+v.Cursor()), 0, 0)
+	for i, row := range v.Rows() {
+		y := (i + 1) * charHeight
+		for j := 0; j < memviewColumns; j++ {
+			offset := v.Top() + i*memviewColumns + j
+			c := memviewChanged
+			switch {
+			case offset == v.Cursor():
+				c = memviewCursor
+			case !v.Changed(offset):
+				continue
+			}
+			// rows are "AAAA  XX XX ..."
+			x := (6 + j*3) * charWidth
+			ebitenutil.DrawRect(screen, float64(x), float64(y), 2*charWidth, charHeight, c)
+		}
+		ebitenutil.DebugPrintAt(screen, row, 0, y)
+	}
+}
@@ -1,83 +1,520 @@
 package nes
 
 import (
-	"image/color"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
 
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/cartridge"
+	"github.com/dqn/gones/cheat"
 	"github.com/dqn/gones/controller"
 	"github.com/dqn/gones/cpu"
+	"github.com/dqn/gones/fds"
+	"github.com/dqn/gones/gamedb"
+	"github.com/dqn/gones/input"
+	// registers the boards of the iNES mappers
+	_ "github.com/dqn/gones/mapper"
+	"github.com/dqn/gones/memview"
+	"github.com/dqn/gones/movie"
 	"github.com/dqn/gones/ppu"
 	"github.com/dqn/gones/ram"
+	"github.com/dqn/gones/region"
 	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
 )
 
 const (
-	nesHeaderSize           = 0x0010 // 16 Byte
-	programROMSizePerPage   = 0x4000 // 16 KiB
-	characterROMSizePerPage = 0x2000 //  8 KiB
+	width  = 256
+	height = 240
 )
 
+var errFrameLimit = errors.New("frame limit reached")
+
 type NES struct {
-	cpu *cpu.CPU
-	ppu *ppu.PPU
+	cpu         *cpu.CPU
+	ppu         *ppu.PPU
+	apu         *apu.APU
+	audio       *audioOutput
+	cartridge   *cartridge.Cartridge
+	disk        *fds.RAMAdapter
+	controllers [4]*controller.Controller
+	zapper      *controller.Zapper
+	vaus        *controller.Vaus
+	powerPad    *controller.PowerPad
+	input       *input.Mapper
+	options     *Options
+	savePath    string
+	cheats      *cheat.List
+	cheatPath   string
+	recordPath  string
+	region      *region.Region
+	clock       *clock
+	frame       int
+	inFrame     bool
+	view        view
+	viewPalette int
+	memview     *memview.Viewer
+	memviewOpen bool
+	hooks       Hooks
+	fastForward bool
+	slowMotion  bool
+	slowTicks   int
+}
+
+// Hooks are called by the emulation, for scripts. Returning an error
+// stops the emulation.
+type Hooks struct {
+	// BeforeFrame and AfterFrame are called around each frame.
+	BeforeFrame func() error
+	AfterFrame  func() error
+	// Instruction is called before executing the instruction at pc.
+	Instruction func(pc uint16) error
+	// Overlay draws over the screen.
+	Overlay func(screen *ebiten.Image)
 }
 
-func splitROM(buf []byte) ([]uint8, []uint8) {
-	programROMPages, characterROMPages := int(buf[4]), int(buf[5])
-	programROMEnd := nesHeaderSize + programROMSizePerPage*programROMPages
-	characterROMEnd := programROMEnd + characterROMSizePerPage*characterROMPages
+// Options configures the emulator. The zero value runs the ROM in a
+// window with a controller on each port.
+type Options struct {
+	// Port1, Port2 and Expansion select the devices plugged into the ports
+	// (see Port1Devices, Port2Devices and ExpansionDevices). Empty fields
+	// are looked up in GameDB and otherwise default to a controller on each port.
+	Port1     string
+	Port2     string
+	Expansion string
+	GameDB    gamedb.DB
+
+	// Region is "ntsc", "pal", "dendy" or "auto" (default) to use the ROM header.
+	Region string
+	// SampleRate is the audio output rate in Hz. Audio is disabled if 0.
+	SampleRate int
+	Scale      float64
+	Fullscreen bool
+	Colors     *ppu.Colors
+	// SaveDir is where battery-backed RAM and written disks are saved,
+	// next to the ROM by default.
+	SaveDir string
+	// FDSBIOS is the Disk System BIOS file, fds.DefaultBIOSPath by default.
+	FDSBIOS string
+	// CheatFile is the cheats file (see cheat.Parse), <base>.cht in SaveDir by default.
+	CheatFile string
+	// RecordAudio is the WAV file the audio is recorded to, <base>.wav in
+	// SaveDir by default. Recording starts with the emulation if it is set
+	// and otherwise on F9, which numbers the files: <base>-1.wav, ...
+	RecordAudio string
+	// RecordChannels also records each APU channel to its own file.
+	RecordChannels bool
+	// Input is the key bindings, input.LoadDefaultConfig by default.
+	Input *input.Config
+	// FastForward is the number of frames run per tick while fast-forwarding,
+	// as many as time allows if 0.
+	FastForward int
+	// SlowMotion is the number of ticks a frame lasts in slow motion, 4 if 0.
+	SlowMotion int
+	// FrameLimit stops the emulation after the given number of frames if positive.
+	FrameLimit int
+	// Trace receives a line per executed instruction.
+	Trace io.Writer
+	// Movie is played back on the controllers from the first frame.
+	Movie *movie.Movie
+}
 
-	return buf[nesHeaderSize:programROMEnd], buf[programROMEnd:characterROMEnd]
+func (o *Options) resolve(rom []byte) (port1, port2, expansion string) {
+	port1, port2, expansion = o.Port1, o.Port2, o.Expansion
+	if e, ok := o.GameDB.Lookup(rom); ok {
+		if port1 == "" {
+			port1 = e.Port1
+		}
+		if port2 == "" {
+			port2 = e.Port2
+		}
+		if expansion == "" {
+			expansion = e.Expansion
+		}
+	}
+	// the four score takes both ports
+	if port1 == "fourscore" && port2 == "" {
+		port2 = port1
+	}
+	if port2 == "fourscore" && port1 == "" {
+		port1 = port2
+	}
+	if port1 == "" {
+		port1 = "controller"
+	}
+	if port2 == "" {
+		port2 = "controller"
+	}
+	if expansion == "" {
+		expansion = "none"
+	}
+	return
 }
 
-func New(path string) (*NES, error) {
+func New(path string, options *Options) (*NES, error) {
 	buf, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	controller := &controller.Controller{}
-	programROM, characterROM := splitROM(buf)
-	ppuBus := ppu.NewBus(characterROM)
+	cartridge, disk, err := parseROM(buf, options.FDSBIOS)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	rgn := region.Detect(cartridge)
+	if options.Region != "" && options.Region != "auto" {
+		if rgn, err = region.Parse(options.Region); err != nil {
+			return nil, err
+		}
+	}
+
+	saveDir := options.SaveDir
+	if saveDir == "" {
+		saveDir = filepath.Dir(path)
+	}
+	base := filepath.Join(saveDir, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	savePath := base + ".sav"
+	if disk != nil {
+		err = disk.LoadSave(savePath)
+	} else {
+		err = cartridge.LoadSave(savePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cheatPath := options.CheatFile
+	if cheatPath == "" {
+		cheatPath = base + ".cht"
+	}
+	cheats, err := cheat.Load(cheatPath)
+	if err != nil {
+		return nil, err
+	}
+
+	recordPath := options.RecordAudio
+	if recordPath == "" {
+		recordPath = base + ".wav"
+	}
+
+	inputConfig := options.Input
+	if inputConfig == nil {
+		inputConfig, err = input.LoadDefaultConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	mapper, err := input.NewMapper(inputConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ppuBus := ppu.NewBus(cartridge)
 	ppu := ppu.New(ppuBus)
-	cpuBus := cpu.NewBus(&ram.RAM{}, programROM, ppu, controller)
-	cpu := cpu.New(cpuBus)
+	ppu.SetTiming(rgn.PostRenderLines, rgn.VBlankLines)
+	if options.Colors != nil {
+		ppu.SetColors(options.Colors)
+	}
+
+	nes := &NES{
+		ppu:        ppu,
+		cartridge:  cartridge,
+		disk:       disk,
+		input:      mapper,
+		options:    options,
+		savePath:   savePath,
+		cheats:     cheats,
+		cheatPath:  cheatPath,
+		recordPath: recordPath,
+		region:     rgn,
+	}
+	ports, err := nes.connectDevices(options.resolve(buf))
+	if err != nil {
+		return nil, err
+	}
 
-	nes := &NES{cpu, ppu}
+	cpuBus := cpu.NewBus(&ram.RAM{}, cartridge, ppu, ports)
+	cpuBus.SetCheats(cheats)
+	nes.cpu = cpu.New(cpuBus)
+	nes.apu = apu.New(rgn)
+	nes.apu.SetMemory(cpuBus.Peek)
+	nes.apu.SetIRQ(func(asserted bool) {
+		nes.cpu.SetIRQ(cpu.IRQFrameCounter, asserted)
+	}, func(asserted bool) {
+		nes.cpu.SetIRQ(cpu.IRQDMC, asserted)
+	})
+	cpuBus.SetAPU(nes.apu)
+	nes.clock = &clock{region: rgn, ppu: ppu, apu: nes.apu}
+	board := cartridge.Board()
+	if b, ok := board.(stepper); ok {
+		nes.clock.board = b
+	}
+	if b, ok := board.(interface{ SetIRQ(func(bool)) }); ok {
+		b.SetIRQ(func(asserted bool) {
+			nes.cpu.SetIRQ(cpu.IRQMapper, asserted)
+		})
+	}
+	if b, ok := board.(interface{ Audio() apu.Expansion }); ok {
+		nes.apu.AddExpansion(b.Audio())
+	}
+	if disk != nil {
+		disk.SetIRQ(func(asserted bool) {
+			nes.cpu.SetIRQ(cpu.IRQMapper, asserted)
+		}, func(asserted bool) {
+			nes.cpu.SetIRQ(cpu.IRQDisk, asserted)
+		})
+	}
+	cpuBus.SetClock(nes.clock)
+	ppu.SetNMI(nes.cpu.NMI)
+	nes.cpu.SetTrace(options.Trace)
+
+	if options.RecordAudio != "" {
+		if err := nes.StartRecording(recordPath, options.RecordChannels); err != nil {
+			return nil, err
+		}
+	}
 
 	return nes, nil
 }
 
-func (n *NES) update(screen *ebiten.Image) error {
-	if ebiten.IsDrawingSkipped() {
-		return nil
+// parseROM returns the cartridge of an iNES ROM, or the Disk System RAM
+// adapter with a disk image inserted.
+func parseROM(buf []byte, biosPath string) (*cartridge.Cartridge, *fds.RAMAdapter, error) {
+	if !fds.IsImage(buf) {
+		c, err := cartridge.Parse(buf)
+		return c, nil, err
+	}
+	image, err := fds.Parse(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if biosPath == "" {
+		if biosPath, err = fds.DefaultBIOSPath(); err != nil {
+			return nil, nil, err
+		}
+	}
+	bios, err := fds.LoadBIOS(biosPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the Disk System BIOS is needed: %w", err)
+	}
+	return fds.New(image, bios, region.NTSC.CPUClock())
+}
+
+func (n *NES) playMovie() {
+	m := n.options.Movie
+	if m == nil || n.frame >= len(m.Frames) {
+		return
+	}
+	f := m.Frames[n.frame]
+	if f.Commands&(movie.CommandSoftReset|movie.CommandHardReset) != 0 {
+		n.cpu.Reset()
+	}
+	for i, c := range n.controllers {
+		c.SetButtons(f.Ports[i])
+	}
+}
+
+// Step executes a single CPU instruction and advances the PPU accordingly.
+// It reports whether a frame has been completed.
+func (n *NES) Step() (bool, error) {
+	if !n.inFrame {
+		n.playMovie()
+		n.inFrame = true
+	}
+
+	if h := n.hooks.Instruction; h != nil {
+		if err := h(n.cpu.Registers().PC); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := n.cpu.Run(); err != nil {
+		return false, err
+	}
+	if !n.clock.frameDone {
+		return false, nil
+	}
+	n.clock.frameDone = false
+
+	n.frame++
+	n.inFrame = false
+	return true, nil
+}
+
+// StepFrame runs the emulation until the PPU has output a frame. It fails
+// once Options.FrameLimit frames have been run.
+func (n *NES) StepFrame() error {
+	if limit := n.options.FrameLimit; limit > 0 && n.frame >= limit {
+		return errFrameLimit
+	}
+	if h := n.hooks.BeforeFrame; h != nil {
+		if err := h(); err != nil {
+			return err
+		}
 	}
 
 	for {
-		cycle, err := n.cpu.Run()
+		done, err := n.Step()
 		if err != nil {
 			return err
 		}
-
-		b := n.ppu.Run(cycle * 3)
-		if b == nil {
+		if !done {
 			continue
 		}
-
-		for i := 0; i < 240; i++ {
-			for j := 0; j < 256; j++ {
-				screen.Set(j, i, color.Color(b[i][j]))
+		if r := n.clock.recorder; r != nil {
+			if err := r.flush(); err != nil {
+				return err
 			}
 		}
-		break
+		if h := n.hooks.AfterFrame; h != nil {
+			return h()
+		}
+		return nil
+	}
+}
+
+// Frame returns the number of frames completed so far.
+func (n *NES) Frame() int {
+	return n.frame
+}
+
+func (n *NES) Region() *region.Region {
+	return n.region
+}
+
+func (n *NES) CPU() *cpu.CPU {
+	return n.cpu
+}
+
+func (n *NES) PPU() *ppu.PPU {
+	return n.ppu
+}
+
+func (n *NES) APU() *apu.APU {
+	return n.apu
+}
+
+// SetHooks replaces the hooks.
+func (n *NES) SetHooks(h Hooks) {
+	n.hooks = h
+}
+
+// Controller returns the controller of player i (0-3).
+func (n *NES) Controller(i int) *controller.Controller {
+	return n.controllers[i]
+}
+
+// Cheats returns the cheats of the game. Call Update on it after changing them.
+func (n *NES) Cheats() *cheat.List {
+	return n.cheats
+}
+
+// SaveCheats writes the cheats back to the cheats file.
+func (n *NES) SaveCheats() error {
+	return n.cheats.Save(n.cheatPath)
+}
+
+func (n *NES) update(screen *ebiten.Image) error {
+	n.updateSpeed()
+	if n.updateMemview() {
+		// the keyboard is editing memory, release the buttons
+		for _, c := range n.controllers {
+			c.SetButtons(0)
+		}
+	} else {
+		n.updateDevices()
+	}
+	n.updateView()
+	if inpututil.IsKeyJustPressed(ebiten.KeyF7) {
+		n.cheats.Disabled = !n.cheats.Disabled
+	}
+	n.updateDisk()
+	if err := n.updateRecording(); err != nil {
+		return err
+	}
+
+	if err := n.tick(); err != nil {
+		return err
+	}
+	if n.audio != nil {
+		n.audio.flush()
+	}
+	if ebiten.IsDrawingSkipped() {
+		return nil
 	}
 
+	screen.ReplacePixels(n.ppu.Pixels())
+
+	if h := n.hooks.Overlay; h != nil {
+		h(screen)
+	}
+	n.drawDisk(screen)
+	if err := n.drawView(screen); err != nil {
+		return err
+	}
+	n.drawMemview(screen)
 	return nil
 }
 
+// Save writes battery-backed RAM, or the disk if it has been written to,
+// to the save directory.
+func (n *NES) Save() error {
+	if n.disk != nil {
+		return n.disk.Save(n.savePath)
+	}
+	return n.cartridge.Save(n.savePath)
+}
+
+// Disk returns the Disk System RAM adapter, nil unless running a disk image.
+func (n *NES) Disk() *fds.RAMAdapter {
+	return n.disk
+}
+
 func (n *NES) Run() error {
-	if err := ebiten.Run(n.update, 256, 240, 1, "gones"); err != nil {
+	scale := n.options.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	ebiten.SetFullscreen(n.options.Fullscreen)
+	ebiten.SetMaxTPS(int(math.Round(n.region.FrameRate)))
+	if n.options.SampleRate > 0 {
+		audio, err := newAudioOutput(n.options.SampleRate, n.region.CPUClock())
+		if err != nil {
+			return err
+		}
+		n.audio = audio
+		n.clock.resampler = audio.resampler
+	}
+	if err := ebiten.Run(n.update, width, height, scale, "gones"); err != nil && err != errFrameLimit {
+		n.StopRecording()
 		return err
 	}
-	return nil
+	if err := n.StopRecording(); err != nil {
+		return err
+	}
+	return n.Save()
+}
+
+// RunHeadless runs the emulation without a window or live input until
+// the frame limit is reached. Without a limit it never returns unless
+// the emulation fails.
+func (n *NES) RunHeadless() error {
+	for {
+		if err := n.StepFrame(); err != nil {
+			if err != errFrameLimit {
+				n.StopRecording()
+				return err
+			}
+			if err := n.StopRecording(); err != nil {
+				return err
+			}
+			return n.Save()
+		}
+	}
 }
@@ -0,0 +1,130 @@
+package nes
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dqn/gones/nsf"
+	"github.com/dqn/gones/region"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+// The NSF player shows the tune and the song being played:
+//
+//	Left / Right   previous / next song
+//	Space          pause
+//
+// Songs of known length move on to the next one when they end.
+type nsfPlayer struct {
+	player *nsf.Player
+	audio  *audioOutput
+	// cycles is the number of CPU cycles run per tick.
+	cycles uint64
+	paused bool
+}
+
+// PlayNSF plays an NSF or NSFE file in a window, from the song given from
+// 0, or from the start song of the file if negative. Region, SampleRate,
+// Scale and Fullscreen of the options are used.
+func PlayNSF(path string, song int, options *Options) error {
+	n, err := nsf.Load(path)
+	if err != nil {
+		return err
+	}
+	var rgn *region.Region
+	if options.Region != "" && options.Region != "auto" {
+		if rgn, err = region.Parse(options.Region); err != nil {
+			return err
+		}
+	}
+	if song < 0 {
+		song = n.StartSong
+	}
+
+	p := &nsfPlayer{player: nsf.NewPlayer(n, rgn)}
+	rgn = p.player.Region()
+	p.cycles = uint64(rgn.CPUClock() / rgn.FrameRate)
+	if options.SampleRate > 0 {
+		if p.audio, err = newAudioOutput(options.SampleRate, rgn.CPUClock()); err != nil {
+			return err
+		}
+		p.player.SetResampler(p.audio.resampler)
+	}
+	if err := p.player.Start(song); err != nil {
+		return err
+	}
+
+	scale := options.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	ebiten.SetFullscreen(options.Fullscreen)
+	ebiten.SetMaxTPS(int(math.Round(rgn.FrameRate)))
+	title := n.Title
+	if title == "" {
+		title = "gones"
+	}
+	return ebiten.Run(p.update, width, height, scale, title)
+}
+
+func (p *nsfPlayer) update(screen *ebiten.Image) error {
+	n := p.player.NSF()
+	song := p.player.Song()
+	if length := n.Length(song); length > 0 && p.player.Elapsed() >= length+n.Tracks[song].Fade {
+		song++
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+		song++
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+		song--
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		p.paused = !p.paused
+	}
+	if song != p.player.Song() {
+		if err := p.player.Start((song + n.Songs) % n.Songs); err != nil {
+			return err
+		}
+	}
+
+	if !p.paused {
+		if err := p.player.Run(p.cycles); err != nil {
+			return err
+		}
+	}
+	if p.audio != nil {
+		p.audio.flush()
+	}
+	if ebiten.IsDrawingSkipped() {
+		return nil
+	}
+
+	lines := []string{n.Title, n.Artist, n.Copyright, ""}
+	song = p.player.Song()
+	lines = append(lines, fmt.Sprintf("song %d/%d  %s", song+1, n.Songs, n.Label(song)))
+	elapsed := formatDuration(p.player.Elapsed())
+	if length := n.Length(song); length > 0 {
+		elapsed += " / " + formatDuration(length)
+	}
+	if p.paused {
+		elapsed += "  paused"
+	}
+	lines = append(lines, elapsed)
+	if n.Chips != 0 {
+		lines = append(lines, "", "expansion audio: "+n.Chips.String())
+	}
+	for i, l := range lines {
+		ebitenutil.DebugPrintAt(screen, l, charWidth, charHeight*(i+1))
+	}
+	ebitenutil.DebugPrintAt(screen, "<- -> song  space pause", charWidth, height-2*charHeight)
+	return nil
+}
+
+func formatDuration(d time.Duration) string {
+	s := int(d.Seconds())
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
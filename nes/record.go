@@ -0,0 +1,168 @@
+package nes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/wav"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+const (
+	// recordKey starts and stops recording the audio.
+	recordKey         = ebiten.KeyF9
+	defaultRecordRate = 44100
+)
+
+// recorder writes the APU output to WAV files, resampled at a fixed
+// ratio so the same run always gives the same file.
+type recorder struct {
+	mixed    *apu.Resampler
+	file     *wav.Writer
+	channels []*apu.Resampler
+	files    []*wav.Writer
+	outputs  []float32
+	samples  []float32
+}
+
+// channelPath names the file of a channel after the mixed one:
+// music.wav gives music.pulse1.wav.
+func channelPath(path, channel string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + channel + ext
+}
+
+// nextRecordPath numbers the files recorded with the key so each one gets
+// a new name: music.wav gives music-1.wav, music-2.wav and so on.
+func nextRecordPath(path string) string {
+	ext := filepath.Ext(path)
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), i, ext)
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			return p
+		}
+	}
+}
+
+func newRecorder(path string, channels bool, clockRate float64, rate int) (*recorder, error) {
+	file, err := wav.Create(path, rate)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{
+		mixed:   apu.NewResampler(clockRate, float64(rate)),
+		file:    file,
+		samples: make([]float32, rate/10),
+	}
+	if !channels {
+		return r, nil
+	}
+	for _, name := range apu.Channels {
+		f, err := wav.Create(channelPath(path, name), rate)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		r.channels = append(r.channels, apu.NewResampler(clockRate, float64(rate)))
+		r.files = append(r.files, f)
+	}
+	r.outputs = make([]float32, len(apu.Channels))
+	return r, nil
+}
+
+func (r *recorder) add(a *apu.APU) {
+	r.mixed.Add(a.Output())
+	if r.channels == nil {
+		return
+	}
+	a.ChannelOutputs(r.outputs)
+	for i, c := range r.channels {
+		c.Add(r.outputs[i])
+	}
+}
+
+func (r *recorder) flush() error {
+	if err := r.drain(r.mixed, r.file); err != nil {
+		return err
+	}
+	for i, c := range r.channels {
+		if err := r.drain(c, r.files[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *recorder) drain(rs *apu.Resampler, w *wav.Writer) error {
+	for {
+		n := rs.Read(r.samples)
+		if n == 0 {
+			return nil
+		}
+		if err := w.Write(r.samples[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *recorder) close() error {
+	err := r.file.Close()
+	for _, f := range r.files {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// StartRecording writes the audio to a 16-bit mono WAV file at path until
+// StopRecording. With channels, each APU channel is also written alone to
+// a file named after path, e.g. music.pulse1.wav for music.wav.
+func (n *NES) StartRecording(path string, channels bool) error {
+	if err := n.StopRecording(); err != nil {
+		return err
+	}
+	rate := n.options.SampleRate
+	if rate <= 0 {
+		rate = defaultRecordRate
+	}
+	r, err := newRecorder(path, channels, n.region.CPUClock(), rate)
+	if err != nil {
+		return err
+	}
+	n.clock.recorder = r
+	return nil
+}
+
+// StopRecording writes the rest of the audio and closes the files. It
+// does nothing when not recording.
+func (n *NES) StopRecording() error {
+	r := n.clock.recorder
+	if r == nil {
+		return nil
+	}
+	n.clock.recorder = nil
+	if err := r.flush(); err != nil {
+		r.close()
+		return err
+	}
+	return r.close()
+}
+
+func (n *NES) Recording() bool {
+	return n.clock.recorder != nil
+}
+
+func (n *NES) updateRecording() error {
+	if !inpututil.IsKeyJustPressed(recordKey) {
+		return nil
+	}
+	if n.Recording() {
+		return n.StopRecording()
+	}
+	return n.StartRecording(nextRecordPath(n.recordPath), n.options.RecordChannels)
+}
@@ -0,0 +1,66 @@
+package nes
+
+import (
+	"time"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+// Emulation speed, at one tick per frame of the region (60 Hz on NTSC,
+// 50 Hz on PAL and Dendy):
+//
+//	` (hold)  fast-forward, Options.FastForward frames per tick
+//	F8        toggle slow motion, a frame every Options.SlowMotion ticks
+//
+// Every frame is emulated, so runs are the same at any speed for the same
+// input.
+const (
+	fastForwardKey = ebiten.KeyGraveAccent
+	slowMotionKey  = ebiten.KeyF8
+	// uncapped fast-forward runs frames for this long each tick
+	uncappedBudget    = 12 * time.Millisecond
+	defaultSlowMotion = 4
+)
+
+func (n *NES) updateSpeed() {
+	n.fastForward = ebiten.IsKeyPressed(fastForwardKey)
+	if inpututil.IsKeyJustPressed(slowMotionKey) {
+		n.slowMotion = !n.slowMotion
+		n.slowTicks = 0
+	}
+}
+
+// tick runs the frames of one tick.
+func (n *NES) tick() error {
+	switch {
+	case n.fastForward && n.options.FastForward > 0:
+		for i := 0; i < n.options.FastForward; i++ {
+			if err := n.StepFrame(); err != nil {
+				return err
+			}
+		}
+		return nil
+	case n.fastForward:
+		deadline := time.Now().Add(uncappedBudget)
+		for {
+			if err := n.StepFrame(); err != nil {
+				return err
+			}
+			if time.Now().After(deadline) {
+				return nil
+			}
+		}
+	case n.slowMotion:
+		ticks := n.options.SlowMotion
+		if ticks <= 0 {
+			ticks = defaultSlowMotion
+		}
+		n.slowTicks++
+		if n.slowTicks < ticks {
+			return nil
+		}
+		n.slowTicks = 0
+	}
+	return n.StepFrame()
+}
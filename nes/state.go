@@ -0,0 +1,95 @@
+package nes
+
+import (
+	"encoding/gob"
+	"os"
+
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/cartridge"
+	"github.com/dqn/gones/cpu"
+	"github.com/dqn/gones/fds"
+	"github.com/dqn/gones/ppu"
+)
+
+// State is a savestate: everything needed to resume the emulation at the
+// current instruction. Peripherals are not included, they are updated
+// from the input every frame.
+type State struct {
+	Frame     int
+	InFrame   bool
+	ClockLag  uint
+	CPU       *cpu.State
+	PPU       *ppu.State
+	APU       *apu.State
+	Cartridge *cartridge.State
+	// Disk is the RAM adapter and the disk when running a disk image.
+	Disk *fds.State
+}
+
+func (n *NES) State() (*State, error) {
+	c, err := n.cartridge.State()
+	if err != nil {
+		return nil, err
+	}
+	s := &State{
+		Frame:     n.frame,
+		InFrame:   n.inFrame,
+		ClockLag:  n.clock.lag,
+		CPU:       n.cpu.State(),
+		PPU:       n.ppu.State(),
+		APU:       n.apu.State(),
+		Cartridge: c,
+	}
+	if n.disk != nil {
+		s.Disk = n.disk.State()
+	}
+	return s, nil
+}
+
+func (n *NES) SetState(s *State) error {
+	n.frame, n.inFrame, n.clock.lag = s.Frame, s.InFrame, s.ClockLag
+	n.cpu.SetState(s.CPU)
+	n.ppu.SetState(s.PPU)
+	// savestates from before the APU was emulated have none
+	if s.APU != nil {
+		n.apu.SetState(s.APU)
+	}
+	if err := n.cartridge.SetState(s.Cartridge); err != nil {
+		return err
+	}
+	if n.disk != nil && s.Disk != nil {
+		n.disk.SetState(s.Disk)
+	}
+	return nil
+}
+
+// SaveState writes a savestate to path.
+func (n *NES) SaveState(path string) error {
+	s, err := n.State()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadState restores a savestate written by SaveState.
+func (n *NES) LoadState(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := &State{}
+	if err := gob.NewDecoder(f).Decode(s); err != nil {
+		return err
+	}
+	return n.SetState(s)
+}
@@ -0,0 +1,122 @@
+package nes
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+// PPU views shown over the game screen:
+//
+//	F1 pattern tables (F5 cycles the palette)
+//	F2 nametables
+//	F3 OAM
+//	F4 palettes
+type view int
+
+const (
+	viewNone view = iota
+	viewPatternTables
+	viewNameTables
+	viewSprites
+	viewPalettes
+)
+
+var viewKeys = map[ebiten.Key]view{
+	ebiten.KeyF1: viewPatternTables,
+	ebiten.KeyF2: viewNameTables,
+	ebiten.KeyF3: viewSprites,
+	ebiten.KeyF4: viewPalettes,
+}
+
+func (n *NES) updateView() {
+	for k, v := range viewKeys {
+		if !inpututil.IsKeyJustPressed(k) {
+			continue
+		}
+		if n.view == v {
+			n.view = viewNone
+		} else {
+			n.view = v
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+		n.viewPalette = (n.viewPalette + 1) % 8
+	}
+}
+
+func (n *NES) viewImage(v view, palette int) image.Image {
+	switch v {
+	case viewPatternTables:
+		return n.ppu.PatternTables(palette)
+	case viewNameTables:
+		return n.ppu.NameTables()
+	case viewSprites:
+		return n.ppu.Sprites()
+	case viewPalettes:
+		return n.ppu.Palettes()
+	}
+	return nil
+}
+
+// drawView draws the current view over the screen, shrunk to fit if needed.
+func (n *NES) drawView(screen *ebiten.Image) error {
+	img := n.viewImage(n.view, n.viewPalette)
+	if img == nil {
+		return nil
+	}
+	overlay, err := ebiten.NewImageFromImage(img, ebiten.FilterDefault)
+	if err != nil {
+		return err
+	}
+	defer overlay.Dispose()
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	scale := 1.0
+	if w > width || h > height {
+		scale = 0.5
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate((width-float64(w)*scale)/2, (height-float64(h)*scale)/2)
+	return screen.DrawImage(overlay, op)
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WritePPUViews dumps the pattern tables (with palette 0), nametables,
+// OAM and palettes as PNG files into dir.
+func (n *NES) WritePPUViews(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	views := []struct {
+		name string
+		view view
+	}{
+		{"pattern_tables.png", viewPatternTables},
+		{"nametables.png", viewNameTables},
+		{"oam.png", viewSprites},
+		{"palettes.png", viewPalettes},
+	}
+	for _, v := range views {
+		if err := writePNG(filepath.Join(dir, v.name), n.viewImage(v.view, 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package nsf
+
+import "github.com/dqn/gones/apu"
+
+// アドレス	       用途
+// 0x4100～0x4102	ルーチンの戻り先 (JMP 0x4100)
+// 0x5205～0x5206	MMC5: 乗算器
+// 0x5C00～0x5FF5	MMC5: 拡張 RAM
+// 0x5FF6～0x5FF7	FDS: 0x6000～0x7FFF のバンク
+// 0x5FF8～0x5FFF	0x8000～0xFFFF の 4 KiB バンク
+// 0x6000～0x7FFF	RAM
+// 0x8000～0xFFFF	データ (FDS では RAM)
+
+const (
+	// idleAddress is where INIT and PLAY return to. It jumps to itself, so
+	// the CPU keeps running, and clocking the APU, between calls.
+	idleAddress = 0x4100
+	bankSize    = 0x1000
+)
+
+var idleLoop = []uint8{0x4C, idleAddress & 0xFF, idleAddress >> 8}
+
+// memory maps a tune from $4020 on the CPU bus.
+type memory struct {
+	nsf *NSF
+	// rom is the data preceded by its offset in the first bank.
+	rom   []uint8
+	banks [8]uint8
+	// ram is $6000-$7FFF, or $6000-$FFFF for FDS tunes which are copied
+	// to RAM and may modify themselves.
+	ram []uint8
+	fds bool
+	// exram and the multiplier are used by MMC5 tunes.
+	exram      []uint8
+	multiplier [2]uint8
+	// chips are the expansion sound chips, which see every write from
+	// $4020.
+	chips []apu.Expansion
+}
+
+func newMemory(n *NSF) *memory {
+	m := &memory{nsf: n, fds: n.Chips&FDS != 0}
+	padding := int(n.LoadAddress & (bankSize - 1))
+	if !n.Banked() && !m.fds {
+		padding = int(n.LoadAddress) - 0x8000
+	}
+	m.rom = make([]uint8, padding+len(n.Data))
+	copy(m.rom[padding:], n.Data)
+	if m.fds {
+		m.ram = make([]uint8, 0xA000)
+	} else {
+		m.ram = make([]uint8, 0x2000)
+	}
+	if n.Chips&MMC5 != 0 {
+		m.exram = make([]uint8, 0x0400)
+	}
+	return m
+}
+
+// reset clears the RAM and restores the initial banks.
+func (m *memory) reset() {
+	for i := range m.ram {
+		m.ram[i] = 0
+	}
+	for i := range m.exram {
+		m.exram[i] = 0
+	}
+	n := m.nsf
+	switch {
+	case !n.Banked() && m.fds:
+		copy(m.ram[n.LoadAddress-0x6000:], n.Data)
+	case !n.Banked():
+		for i := range m.banks {
+			m.banks[i] = uint8(i)
+		}
+	case m.fds:
+		m.switchBank(0x5FF6, n.Banks[6])
+		m.switchBank(0x5FF7, n.Banks[7])
+		for i, b := range n.Banks {
+			m.switchBank(0x5FF8+uint16(i), b)
+		}
+	default:
+		m.banks = n.Banks
+	}
+}
+
+func (m *memory) switchBank(addr uint16, bank uint8) {
+	if !m.fds {
+		m.banks[addr-0x5FF8] = bank
+		return
+	}
+	// FDS tunes copy the bank to RAM
+	dst := m.ram[int(addr-0x5FF6)*bankSize:][:bankSize]
+	for i := range dst {
+		dst[i] = 0
+	}
+	if start := int(bank) * bankSize; start < len(m.rom) {
+		copy(dst, m.rom[start:])
+	}
+}
+
+// ReadProgram also reads the registers of the chips, which PeekProgram
+// leaves alone as reading some has side effects.
+func (m *memory) ReadProgram(addr uint16) uint8 {
+	if addr < 0x6000 {
+		for _, c := range m.chips {
+			if data, ok := c.ReadRegister(addr); ok {
+				return data
+			}
+		}
+	}
+	return m.PeekProgram(addr)
+}
+
+func (m *memory) PeekProgram(addr uint16) uint8 {
+	switch {
+	case m.exram != nil && addr == 0x5205:
+		return uint8(uint16(m.multiplier[0]) * uint16(m.multiplier[1]))
+	case m.exram != nil && addr == 0x5206:
+		return uint8(uint16(m.multiplier[0]) * uint16(m.multiplier[1]) >> 8)
+	case m.exram != nil && addr >= 0x5C00 && addr < 0x5FF6:
+		return m.exram[addr-0x5C00]
+	case addr >= idleAddress && addr < idleAddress+uint16(len(idleLoop)):
+		return idleLoop[addr-idleAddress]
+	case addr >= 0x6000 && int(addr-0x6000) < len(m.ram):
+		return m.ram[addr-0x6000]
+	case addr >= 0x8000:
+		i := int(m.banks[(addr-0x8000)/bankSize])*bankSize + int(addr%bankSize)
+		if i < len(m.rom) {
+			return m.rom[i]
+		}
+	}
+	return 0
+}
+
+func (m *memory) WriteProgram(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x5FF8 && addr < 0x6000, m.fds && (addr == 0x5FF6 || addr == 0x5FF7):
+		if m.nsf.Banked() {
+			m.switchBank(addr, data)
+		}
+	case addr >= 0x6000 && int(addr-0x6000) < len(m.ram):
+		m.ram[addr-0x6000] = data
+	case m.exram != nil && (addr == 0x5205 || addr == 0x5206):
+		m.multiplier[addr-0x5205] = data
+	case m.exram != nil && addr >= 0x5C00 && addr < 0x5FF6:
+		m.exram[addr-0x5C00] = data
+	}
+	for _, c := range m.chips {
+		c.WriteRegister(addr, data)
+	}
+}
+
+func (m *memory) PokeProgram(addr uint16, data uint8) {
+	switch {
+	case addr >= 0x6000 && int(addr-0x6000) < len(m.ram):
+		m.ram[addr-0x6000] = data
+	case m.exram != nil && addr >= 0x5C00 && addr < 0x5FF6:
+		m.exram[addr-0x5C00] = data
+	}
+}
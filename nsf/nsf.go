@@ -0,0 +1,294 @@
+package nsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/dqn/gones/cartridge"
+)
+
+// https://wiki.nesdev.com/w/index.php/NSF
+// https://wiki.nesdev.com/w/index.php/NSFe
+
+const headerSize = 0x80
+
+var (
+	magic     = []byte("NESM\x1A")
+	magicNSFE = []byte("NSFE")
+)
+
+var ErrInvalidNSF = errors.New("not an NSF or NSFE file")
+
+// Chips are the expansion sound chips a tune uses.
+type Chips uint8
+
+const (
+	VRC6 Chips = 1 << iota
+	VRC7
+	FDS
+	MMC5
+	N163
+	Sunsoft5B
+)
+
+var chipNames = []string{"VRC6", "VRC7", "FDS", "MMC5", "N163", "5B"}
+
+func (c Chips) String() string {
+	var names []string
+	for i, name := range chipNames {
+		if c&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+// Track is what an NSFE file tells about a song. Zero durations are unknown.
+type Track struct {
+	Label  string
+	Length time.Duration
+	Fade   time.Duration
+}
+
+type NSF struct {
+	Songs int
+	// StartSong is the song played first, from 0.
+	StartSong   int
+	LoadAddress uint16
+	InitAddress uint16
+	PlayAddress uint16
+	Title       string
+	Artist      string
+	Copyright   string
+	// NTSCSpeed and PALSpeed are the periods of PLAY in microseconds.
+	NTSCSpeed uint16
+	PALSpeed  uint16
+	// Banks are the initial 4 KiB banks at $8000-$FFFF. The data is not
+	// bank switched if they are all 0.
+	Banks  [8]uint8
+	Timing cartridge.Timing
+	Chips  Chips
+	// Tracks has an entry per song in NSFE files and is nil otherwise.
+	Tracks []Track
+	Data   []uint8
+}
+
+func Parse(buf []byte) (*NSF, error) {
+	switch {
+	case bytes.HasPrefix(buf, magic):
+		return parseNSF(buf)
+	case bytes.HasPrefix(buf, magicNSFE):
+		return parseNSFE(buf[len(magicNSFE):])
+	}
+	return nil, ErrInvalidNSF
+}
+
+func Load(path string) (*NSF, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	n, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return n, nil
+}
+
+func parseNSF(buf []byte) (*NSF, error) {
+	if len(buf) < headerSize {
+		return nil, fmt.Errorf("%w: short header", ErrInvalidNSF)
+	}
+	n := &NSF{
+		Songs:       int(buf[0x06]),
+		StartSong:   int(buf[0x07]) - 1,
+		LoadAddress: binary.LittleEndian.Uint16(buf[0x08:]),
+		InitAddress: binary.LittleEndian.Uint16(buf[0x0A:]),
+		PlayAddress: binary.LittleEndian.Uint16(buf[0x0C:]),
+		Title:       cString(buf[0x0E:0x2E]),
+		Artist:      cString(buf[0x2E:0x4E]),
+		Copyright:   cString(buf[0x4E:0x6E]),
+		NTSCSpeed:   binary.LittleEndian.Uint16(buf[0x6E:]),
+		PALSpeed:    binary.LittleEndian.Uint16(buf[0x78:]),
+		Timing:      timing(buf[0x7A]),
+		Chips:       Chips(buf[0x7B]),
+		Data:        buf[headerSize:],
+	}
+	copy(n.Banks[:], buf[0x70:0x78])
+	return n, n.validate()
+}
+
+func timing(flags uint8) cartridge.Timing {
+	switch {
+	case flags&0b10 != 0:
+		return cartridge.TimingMulti
+	case flags&0b01 != 0:
+		return cartridge.TimingPAL
+	}
+	return cartridge.TimingNTSC
+}
+
+func (n *NSF) validate() error {
+	if n.Songs == 0 {
+		return fmt.Errorf("%w: no songs", ErrInvalidNSF)
+	}
+	if n.StartSong < 0 || n.StartSong >= n.Songs {
+		n.StartSong = 0
+	}
+	if n.LoadAddress < 0x8000 && n.Chips&FDS == 0 {
+		return fmt.Errorf("%w: load address $%04X", ErrInvalidNSF, n.LoadAddress)
+	}
+	return nil
+}
+
+func parseNSFE(buf []byte) (*NSF, error) {
+	n := &NSF{}
+	var info, data bool
+	var lengths, fades []time.Duration
+	var labels []string
+	for {
+		if len(buf) < 8 {
+			return nil, fmt.Errorf("%w: missing NEND chunk", ErrInvalidNSF)
+		}
+		size := binary.LittleEndian.Uint32(buf)
+		id := string(buf[4:8])
+		buf = buf[8:]
+		if uint32(len(buf)) < size {
+			return nil, fmt.Errorf("%w: truncated %s chunk", ErrInvalidNSF, id)
+		}
+		chunk := buf[:size]
+		buf = buf[size:]
+
+		switch id {
+		case "INFO":
+			if len(chunk) < 9 {
+				return nil, fmt.Errorf("%w: short INFO chunk", ErrInvalidNSF)
+			}
+			n.LoadAddress = binary.LittleEndian.Uint16(chunk[0:])
+			n.InitAddress = binary.LittleEndian.Uint16(chunk[2:])
+			n.PlayAddress = binary.LittleEndian.Uint16(chunk[4:])
+			n.Timing = timing(chunk[6])
+			n.Chips = Chips(chunk[7])
+			n.Songs = int(chunk[8])
+			if len(chunk) > 9 {
+				n.StartSong = int(chunk[9])
+			}
+			// the default speeds of the NSF header
+			n.NTSCSpeed, n.PALSpeed = 16639, 19997
+			info = true
+		case "DATA":
+			n.Data = chunk
+			data = true
+		case "BANK":
+			copy(n.Banks[:], chunk)
+		case "RATE":
+			if len(chunk) >= 2 {
+				n.NTSCSpeed = binary.LittleEndian.Uint16(chunk)
+			}
+			if len(chunk) >= 4 {
+				n.PALSpeed = binary.LittleEndian.Uint16(chunk[2:])
+			}
+		case "auth":
+			s := cStrings(chunk)
+			for i, f := range []*string{&n.Title, &n.Artist, &n.Copyright} {
+				if i < len(s) {
+					*f = s[i]
+				}
+			}
+		case "tlbl":
+			labels = cStrings(chunk)
+		case "time":
+			lengths = durations(chunk)
+		case "fade":
+			fades = durations(chunk)
+		case "NEND":
+			if !info || !data {
+				return nil, fmt.Errorf("%w: missing INFO or DATA chunk", ErrInvalidNSF)
+			}
+			if err := n.validate(); err != nil {
+				return nil, err
+			}
+			n.Tracks = make([]Track, n.Songs)
+			for i := range n.Tracks {
+				t := &n.Tracks[i]
+				if i < len(labels) {
+					t.Label = labels[i]
+				}
+				if i < len(lengths) {
+					t.Length = lengths[i]
+				}
+				if i < len(fades) {
+					t.Fade = fades[i]
+				}
+			}
+			return n, nil
+		default:
+			// chunks starting with an uppercase letter must be understood
+			if id[0] >= 'A' && id[0] <= 'Z' {
+				return nil, fmt.Errorf("%w: unsupported %s chunk", ErrInvalidNSF, id)
+			}
+		}
+	}
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func cStrings(b []byte) []string {
+	var s []string
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, 0)
+		if i < 0 {
+			return append(s, string(b))
+		}
+		s = append(s, string(b[:i]))
+		b = b[i+1:]
+	}
+	return s
+}
+
+// durations reads signed 32-bit milliseconds. Negative values are unknown.
+func durations(b []byte) []time.Duration {
+	d := make([]time.Duration, len(b)/4)
+	for i := range d {
+		if ms := int32(binary.LittleEndian.Uint32(b[4*i:])); ms > 0 {
+			d[i] = time.Duration(ms) * time.Millisecond
+		}
+	}
+	return d
+}
+
+// Banked reports whether the data is bank switched.
+func (n *NSF) Banked() bool {
+	for _, b := range n.Banks {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Length returns the length of the song if the file tells it.
+func (n *NSF) Length(song int) time.Duration {
+	if song < len(n.Tracks) {
+		return n.Tracks[song].Length
+	}
+	return 0
+}
+
+// Label returns the name of the song if the file tells it.
+func (n *NSF) Label(song int) string {
+	if song < len(n.Tracks) {
+		return n.Tracks[song].Label
+	}
+	return ""
+}
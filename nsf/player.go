@@ -0,0 +1,219 @@
+package nsf
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/cartridge"
+	"github.com/dqn/gones/controller"
+	"github.com/dqn/gones/cpu"
+	"github.com/dqn/gones/ppu"
+	"github.com/dqn/gones/ram"
+	"github.com/dqn/gones/region"
+)
+
+// https://wiki.nesdev.com/w/index.php/NSF#Initializing_a_tune
+
+// default periods of PLAY in microseconds
+const (
+	ntscSpeed = 16639
+	palSpeed  = 19997
+)
+
+// initCycles bounds the time INIT may take. A few tunes never return from
+// INIT and play from it instead.
+const initCycles = 1 << 20
+
+// Player runs the routines of a tune on the emulated CPU and APU.
+type Player struct {
+	nsf       *NSF
+	region    *region.Region
+	memory    *memory
+	bus       *cpu.CPUBus
+	cpu       *cpu.CPU
+	apu       *apu.APU
+	resampler *apu.Resampler
+	song      int
+	// cycles counts the CPU cycles since the song was started.
+	cycles     uint64
+	playPeriod float64
+	nextPlay   float64
+}
+
+// NewPlayer returns a player of the tune on the consoles of the region,
+// or of the region the tune was made for if nil. Start must be called
+// before Run.
+func NewPlayer(n *NSF, r *region.Region) *Player {
+	if r == nil {
+		r = region.ForTiming(n.Timing)
+	}
+	p := &Player{nsf: n, region: r, memory: newMemory(n)}
+
+	speed := n.NTSCSpeed
+	if r != region.NTSC {
+		speed = n.PALSpeed
+	}
+	if speed == 0 {
+		speed = ntscSpeed
+		if r != region.NTSC {
+			speed = palSpeed
+		}
+	}
+	p.playPeriod = float64(speed) * r.CPUClock() / 1e6
+
+	// the PPU is never used but the bus maps it
+	ppu := ppu.New(ppu.NewBus(&cartridge.Cartridge{CharacterROM: make([]uint8, 0x2000)}))
+	p.bus = cpu.NewBus(&ram.RAM{}, p.memory, ppu, controller.NewPorts(nil, nil, nil))
+	p.bus.SetClock(p)
+	p.resetAPU()
+	p.cpu = cpu.New(p.bus)
+	return p
+}
+
+func (p *Player) resetAPU() {
+	p.apu = apu.New(p.region)
+	p.apu.SetMemory(p.bus.Peek)
+	p.bus.SetAPU(p.apu)
+	p.memory.chips = newChips(p.nsf.Chips, p.region.CPUClock())
+	for _, c := range p.memory.chips {
+		p.apu.AddExpansion(c)
+	}
+}
+
+func newChips(chips Chips, cpuClock float64) []apu.Expansion {
+	var e []apu.Expansion
+	if chips&VRC6 != 0 {
+		e = append(e, apu.NewVRC6())
+	}
+	if chips&VRC7 != 0 {
+		e = append(e, apu.NewVRC7(cpuClock))
+	}
+	if chips&FDS != 0 {
+		e = append(e, apu.NewFDS(cpuClock))
+	}
+	if chips&MMC5 != 0 {
+		e = append(e, apu.NewMMC5(cpuClock))
+	}
+	if chips&N163 != 0 {
+		e = append(e, apu.NewN163())
+	}
+	if chips&Sunsoft5B != 0 {
+		e = append(e, apu.NewSunsoft5B())
+	}
+	return e
+}
+
+func (p *Player) NSF() *NSF {
+	return p.nsf
+}
+
+func (p *Player) Region() *region.Region {
+	return p.region
+}
+
+func (p *Player) APU() *apu.APU {
+	return p.apu
+}
+
+// SetResampler sets the resampler the output is added to on every cycle.
+func (p *Player) SetResampler(r *apu.Resampler) {
+	p.resampler = r
+}
+
+// Song returns the song being played, from 0.
+func (p *Player) Song() int {
+	return p.song
+}
+
+// Elapsed returns the time since the song was started.
+func (p *Player) Elapsed() time.Duration {
+	return time.Duration(float64(p.cycles) / p.region.CPUClock() * float64(time.Second))
+}
+
+// Tick implements cpu.Clock.
+func (p *Player) Tick() {
+	p.cycles++
+	p.apu.Step()
+	if p.resampler != nil {
+		p.resampler.Add(p.Output())
+	}
+}
+
+// Output returns the mixed output of the APU and the expansion chips.
+func (p *Player) Output() float32 {
+	return p.apu.Output()
+}
+
+// Start resets the console and calls INIT for the song, from 0.
+func (p *Player) Start(song int) error {
+	if song < 0 || song >= p.nsf.Songs {
+		return fmt.Errorf("song %d out of range: the tune has %d", song+1, p.nsf.Songs)
+	}
+	p.song = song
+	p.cycles = 0
+	p.nextPlay = 0
+
+	*p.bus.RAM() = ram.RAM{}
+	p.memory.reset()
+	p.resetAPU()
+	for addr := uint16(0x4000); addr < 0x4014; addr++ {
+		p.bus.Write(addr, 0)
+	}
+	p.bus.Write(0x4015, 0x00)
+	p.bus.Write(0x4015, 0x0F)
+	p.bus.Write(0x4017, 0x40)
+
+	r := p.cpu.Registers()
+	r.A = uint8(song)
+	r.X = 0
+	if p.region != region.NTSC {
+		r.X = 1
+	}
+	r.Y = 0
+	p.call(p.nsf.InitAddress)
+	for !p.idle() && p.cycles < initCycles {
+		if _, err := p.cpu.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call jumps to the routine at addr with the return address of the idle
+// loop on the stack, like JSR.
+func (p *Player) call(addr uint16) {
+	r := p.cpu.Registers()
+	r.SP = 0x01FF
+	ret := uint16(idleAddress - 1)
+	p.bus.Poke(r.SP, uint8(ret>>8))
+	p.bus.Poke(r.SP-1, uint8(ret))
+	r.SP -= 2
+	r.P.I = true
+	r.PC = addr
+}
+
+func (p *Player) idle() bool {
+	return p.cpu.Registers().PC == idleAddress
+}
+
+// Run runs the song for the given number of CPU cycles, calling PLAY at
+// the speed of the region. A call is skipped if the previous one has not
+// returned yet.
+func (p *Player) Run(cycles uint64) error {
+	end := p.cycles + cycles
+	for p.cycles < end {
+		if float64(p.cycles) >= p.nextPlay {
+			if p.idle() {
+				p.call(p.nsf.PlayAddress)
+			}
+			for p.nextPlay <= float64(p.cycles) {
+				p.nextPlay += p.playPeriod
+			}
+		}
+		if _, err := p.cpu.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
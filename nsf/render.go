@@ -0,0 +1,64 @@
+package nsf
+
+import (
+	"time"
+
+	"github.com/dqn/gones/apu"
+	"github.com/dqn/gones/wav"
+)
+
+// DefaultLength is how long songs of unknown length are rendered.
+const DefaultLength = 2 * time.Minute
+
+// Render writes the song, from 0, to a WAV file. A length of 0 renders the
+// length and fade the file tells, or DefaultLength.
+func (p *Player) Render(path string, song int, sampleRate int, length time.Duration) error {
+	var fade time.Duration
+	if length == 0 {
+		length = DefaultLength
+		if song < len(p.nsf.Tracks) && p.nsf.Tracks[song].Length > 0 {
+			length = p.nsf.Tracks[song].Length
+			fade = p.nsf.Tracks[song].Fade
+		}
+	}
+	total := int((length + fade).Seconds() * float64(sampleRate))
+	fadeStart := int(length.Seconds() * float64(sampleRate))
+
+	w, err := wav.Create(path, sampleRate)
+	if err != nil {
+		return err
+	}
+	resampler := apu.NewResampler(p.region.CPUClock(), float64(sampleRate))
+	p.SetResampler(resampler)
+	defer p.SetResampler(nil)
+	if err := p.Start(song); err != nil {
+		w.Close()
+		return err
+	}
+
+	// run a tenth of a second at a time
+	step := uint64(p.region.CPUClock() / 10)
+	samples := make([]float32, sampleRate)
+	written := 0
+	for written < total {
+		if err := p.Run(step); err != nil {
+			w.Close()
+			return err
+		}
+		n := resampler.Read(samples)
+		if n > total-written {
+			n = total - written
+		}
+		for i := range samples[:n] {
+			if j := written + i; j >= fadeStart {
+				samples[i] *= 1 - float32(j-fadeStart)/float32(total-fadeStart)
+			}
+		}
+		if err := w.Write(samples[:n]); err != nil {
+			w.Close()
+			return err
+		}
+		written += n
+	}
+	return w.Close()
+}
@@ -9,10 +9,11 @@ const (
 	width        = 256
 	height       = 240
 	cyclePerLine = 341
-	vBlank       = 20
 )
 
-var colors = [...]color.RGBA{
+type Colors [64]color.RGBA
+
+var defaultColors = Colors{
 	{0x80, 0x80, 0x80, 0xFF}, {0x00, 0x3D, 0xA6, 0xFF}, {0x00, 0x12, 0xB0, 0xFF}, {0x44, 0x00, 0x96, 0xFF},
 	{0xA1, 0x00, 0x5E, 0xFF}, {0xC7, 0x00, 0x28, 0xFF}, {0xBA, 0x06, 0x00, 0xFF}, {0x8C, 0x17, 0x00, 0xFF},
 	{0x5C, 0x2F, 0x00, 0xFF}, {0x10, 0x45, 0x00, 0xFF}, {0x05, 0x4A, 0x00, 0xFF}, {0x00, 0x47, 0x2E, 0xFF},
@@ -31,37 +32,86 @@ var colors = [...]color.RGBA{
 	{0x99, 0xFF, 0xFC, 0xFF}, {0xDD, 0xDD, 0xDD, 0xFF}, {0x11, 0x11, 0x11, 0xFF}, {0x11, 0x11, 0x11, 0xFF},
 }
 
-type screen [height][width]*color.RGBA
-type pattern [8][8]uint8
+// noColor marks a pixel that has not been drawn.
+const noColor = 0xFF
+
 type palette [4]uint8
 type oam [0x0100]uint8
 
 type PPU struct {
-	bus       *PPUBus
-	cycle     uint
-	line      uint
-	ppuctrl   ppuctrl
-	ppumask   uint8
-	ppustatus ppustatus
-	oamaddr   uint8
-	ppuscroll uint8
-	ppuaddr   uint16
-	oam       *oam
-	screen    *screen
+	bus         *PPUBus
+	cycle       uint
+	line        uint
+	ppuctrl     ppuctrl
+	ppumask     uint8
+	ppustatus   ppustatus
+	oamaddr     uint8
+	scrollX     uint8
+	scrollY     uint8
+	writeToggle bool
+	ppuaddr     uint16
+	oam         *oam
+	screen      []uint8
+	pixels      []uint8
+	colors      *Colors
+	postRender  uint
+	vBlank      uint
+	nmi         func()
 }
 
 func New(ppuBus *PPUBus) *PPU {
-	return &PPU{
-		bus:    ppuBus,
-		oam:    &oam{},
-		screen: &screen{},
+	colors := defaultColors
+	p := &PPU{
+		bus:        ppuBus,
+		oam:        &oam{},
+		colors:     &colors,
+		postRender: 1,
+		vBlank:     20,
+	}
+	p.screen = make([]uint8, width*height)
+	p.pixels = make([]uint8, width*height*4)
+	p.clearScreen()
+	return p
+}
+
+// SetNMI sets the function called when the PPU raises an NMI.
+func (p *PPU) SetNMI(nmi func()) {
+	p.nmi = nmi
+}
+
+// SetTiming sets the number of idle lines after the picture and of vblank
+// lines, 1 and 20 on NTSC. A pre-render line follows vblank.
+func (p *PPU) SetTiming(postRender, vBlank uint) {
+	p.postRender, p.vBlank = postRender, vBlank
+}
+
+// ParseColors reads a .pal file: 64 RGB triplets. Files with the emphasis
+// variants appended are accepted and only the first 64 colors are used.
+func ParseColors(buf []byte) (*Colors, error) {
+	if len(buf) < len(Colors{})*3 || len(buf)%(len(Colors{})*3) != 0 {
+		return nil, fmt.Errorf("invalid palette size: %d", len(buf))
+	}
+	c := &Colors{}
+	for i := range c {
+		c[i] = color.RGBA{buf[i*3], buf[i*3+1], buf[i*3+2], 0xFF}
+	}
+	return c, nil
+}
+
+func (p *PPU) SetColors(c *Colors) {
+	*p.colors = *c
+	for i, index := range p.screen {
+		p.setPixel(i, index)
 	}
 }
 
 func (p *PPU) ReadRegister(addr uint16) uint8 {
 	switch addr {
 	case 0x2002:
-		return p.ppustatus.Uint8()
+		v := p.ppustatus.Uint8()
+		p.ppustatus.SetVBlank(false)
+		p.writeToggle = false
+		return v
 	case 0x2007:
 		tmp := p.ppuaddr
 		p.ppuaddr += p.ppuctrl.GetIncrementSize()
@@ -72,10 +122,29 @@ func (p *PPU) ReadRegister(addr uint16) uint8 {
 	}
 }
 
+// PeekRegister returns what ReadRegister would without clearing vblank
+// or advancing PPUADDR. Write-only registers read as 0.
+func (p *PPU) PeekRegister(addr uint16) uint8 {
+	switch addr {
+	case 0x2002:
+		return p.ppustatus.Uint8()
+	case 0x2004:
+		return p.oam[p.oamaddr]
+	case 0x2007:
+		return p.bus.Peek(p.ppuaddr)
+	}
+	return 0
+}
+
 func (p *PPU) WriteRegister(addr uint16, data uint8) {
 	switch addr {
 	case 0x2000:
-		p.ppuctrl = ppuctrl(data)
+		ctrl := ppuctrl(data)
+		// enabling NMI during vblank triggers it right away
+		if !p.ppuctrl.NMIEnabled() && ctrl.NMIEnabled() && p.ppustatus.VBlank() && p.nmi != nil {
+			p.nmi()
+		}
+		p.ppuctrl = ctrl
 	case 0x2001:
 		p.ppumask = data
 	case 0x2003:
@@ -84,7 +153,12 @@ func (p *PPU) WriteRegister(addr uint16, data uint8) {
 		p.oam[p.oamaddr] = data
 		p.oamaddr++
 	case 0x2005:
-		p.ppuscroll = data
+		if p.writeToggle {
+			p.scrollY = data
+		} else {
+			p.scrollX = data
+		}
+		p.writeToggle = !p.writeToggle
 	case 0x2006:
 		p.ppuaddr = p.ppuaddr<<8 + uint16(data)
 	case 0x2007:
@@ -96,11 +170,12 @@ func (p *PPU) WriteRegister(addr uint16, data uint8) {
 	}
 }
 
-func (p *PPU) DMA(data []uint8) {
-	for i := 0; i < len(data); i++ {
-		p.oam[p.oamaddr+uint8(i)] = data[i]
-	}
-	// TODO: 513 or 514 cycle
+func (p *PPU) PeekOAM(addr uint8) uint8 {
+	return p.oam[addr]
+}
+
+func (p *PPU) PokeOAM(addr uint8, data uint8) {
+	p.oam[addr] = data
 }
 
 func (p *PPU) readByte(addr uint16) uint8 {
@@ -126,62 +201,133 @@ func (p *PPU) getPalette(index uint8) *palette {
 	return &palette
 }
 
-func (p *PPU) buildPattern(baseAddr uint16) *pattern {
-	pattern := pattern{}
-	for i := uint16(0); i < 16; i++ {
-		d := p.readByte(baseAddr + i)
-		for j := 0; j < 8; j++ {
-			pattern[i%8][j] += ((d >> (7 - j)) & 0b01) << (i / 8)
+// renderLine draws a background line a tile at a time.
+func (p *PPU) renderLine(y uint) {
+	base := p.ppuctrl.GetBGPatternBaseAddress()
+	for x := uint(0); x < width; x += 8 {
+		// fetched in the order of the hardware for boards watching them
+		name := p.getName(x, y)
+		attr := p.getAttribute(x, y)
+		addr := base + uint16(name)*0x10 + uint16(y%8)
+		lo, hi := p.readByte(addr), p.readByte(addr+8)
+		for dx := uint(0); dx < 8; dx++ {
+			v := (lo>>(7-dx))&1 | (hi>>(7-dx))&1<<1
+			index := (attr >> v) & 0b11
+			p.setPixel(int(y*width+x+dx), p.readByte(0x3F00+uint16(0x04*index+v))&0x3F)
+		}
+	}
+}
+
+// renderSprites draws the rows of the sprites on a line over the
+// background, so the line is final once drawn.
+func (p *PPU) renderSprites(y uint) {
+	base := p.ppuctrl.GetSpritePatternBaseAddress()
+	// drawn from the last so the first sprites end up in front
+	for i := len(p.oam) - 4; i >= 0; i -= 4 {
+		x, dy := int(p.oam[i+3]), int(y)-int(p.oam[i])
+		if dy < 0 || dy >= 8 {
+			continue
+		}
+		addr := base + uint16(p.oam[i+1])*0x10 + uint16(dy)
+		lo, hi := p.readByte(addr), p.readByte(addr+8)
+		// the sprite palettes at $3F10 follow the four of the background
+		palette := p.getPalette(4 + p.oam[i+2]&0b00000011)
+		for dx := 0; dx < 8 && x+dx < width; dx++ {
+			v := (lo>>(7-dx))&1 | (hi>>(7-dx))&1<<1
+			if v == 0 {
+				// transparent
+				continue
+			}
+			p.setPixel(int(y)*width+x+dx, palette[v]&0x3F)
 		}
 	}
-	return &pattern
 }
 
-func (p *PPU) getPattern(baseAddr uint16, index uint8) *pattern {
-	addr := baseAddr + uint16(index)*0x10
-	return p.buildPattern(addr)
+// setPixel stores a color index and its RGBA value.
+func (p *PPU) setPixel(i int, index uint8) {
+	p.screen[i] = index
+	pix := p.pixels[i*4 : i*4+4]
+	if index == noColor {
+		pix[0], pix[1], pix[2], pix[3] = 0, 0, 0, 0
+		return
+	}
+	c := p.colors[index&0x3F]
+	pix[0], pix[1], pix[2], pix[3] = c.R, c.G, c.B, c.A
 }
 
-func (p *PPU) calcRGBA(x, y uint) *color.RGBA {
-	attr := p.getAttribute(x, y)
-	pattern := p.getPattern(p.ppuctrl.GetBGPatternBaseAddress(), p.getName(x, y))
-	index := (attr >> pattern[y%8][x%8]) & 0b11
-	palette := p.getPalette(index)
-	return &colors[palette[pattern[y%8][x%8]]]
+func (p *PPU) clearScreen() {
+	for i := range p.screen {
+		p.setPixel(i, noColor)
+	}
 }
 
-func (p *PPU) Run(cycle uint) *screen {
-	p.cycle += cycle
+func (p *PPU) Bus() *PPUBus {
+	return p.bus
+}
 
-	if p.cycle < cyclePerLine {
-		return nil
-	}
-	p.cycle -= cyclePerLine
+// Scanline returns the line currently being drawn. Lines above it have
+// already been output for the current frame.
+func (p *PPU) Scanline() int {
+	return int(p.line)
+}
 
-	if p.line < height {
-		for i := uint(0); i < width; i++ {
-			p.screen[p.line][i] = p.calcRGBA(i, p.line)
-		}
+// Pixel returns the color last output at (x, y).
+func (p *PPU) Pixel(x, y int) color.RGBA {
+	if x < 0 || x >= width || y < 0 || y >= height {
+		return color.RGBA{}
 	}
-	p.line++
+	i := y*width + x
+	return color.RGBA{p.pixels[i*4], p.pixels[i*4+1], p.pixels[i*4+2], p.pixels[i*4+3]}
+}
 
-	if p.line < height+vBlank {
-		p.ppustatus.SetVBlank(true)
-		return nil
-	}
+// Screen returns the color index of each pixel, row by row. Pixels not
+// drawn yet are 0xFF.
+func (p *PPU) Screen() []uint8 {
+	return p.screen
+}
+
+// Pixels returns the picture as RGBA bytes, row by row. Pixels not drawn
+// yet are transparent.
+func (p *PPU) Pixels() []uint8 {
+	return p.pixels
+}
 
-	for i := 0; i < len(p.oam); i += 4 {
-		x, y := p.oam[i+3], p.oam[i]
-		pattern := p.getPattern(p.ppuctrl.GetSpritePatternBaseAddress(), p.oam[i+1])
-		palette := p.getPalette(p.oam[i+2] & 0b00000011)
-		for dy := uint8(0); dy < 8; dy++ {
-			for dx := uint8(0); dx < 8; dx++ {
-				p.screen[y+dy][x+dx] = &colors[palette[pattern[dy][dx]]]
+// Step advances the PPU by a dot and reports whether a frame has been
+// completed. Lines are drawn on their last dot.
+func (p *PPU) Step() bool {
+	vblankLine := height + p.postRender
+	preRenderLine := vblankLine + p.vBlank
+
+	if p.cycle == 1 {
+		switch p.line {
+		case vblankLine:
+			p.bus.scanline(p.line)
+			p.ppustatus.SetVBlank(true)
+			if p.ppuctrl.NMIEnabled() && p.nmi != nil {
+				p.nmi()
 			}
+		case preRenderLine:
+			p.ppustatus.SetVBlank(false)
+		}
+		if p.line < height && p.ppumask&0b00011000 != 0 {
+			p.bus.scanline(p.line)
 		}
 	}
+	p.cycle++
+	if p.cycle < cyclePerLine {
+		return false
+	}
+	p.cycle = 0
+
+	if p.line < height {
+		p.renderLine(p.line)
+		p.renderSprites(p.line)
+	}
+	p.line++
+	if p.line <= preRenderLine {
+		return false
+	}
 
 	p.line = 0
-	p.ppustatus.SetVBlank(false)
-	return p.screen
+	return true
 }
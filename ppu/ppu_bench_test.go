@@ -0,0 +1,72 @@
+package ppu
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/dqn/gones/cartridge"
+)
+
+// newBenchPPU returns a PPU showing random tiles and sprites. Sprites are
+// kept inside the screen.
+func newBenchPPU(b *testing.B) *PPU {
+	rnd := rand.New(rand.NewSource(1))
+	rom := make([]uint8, 0x10+0x4000+0x2000)
+	copy(rom, "NES\x1a\x01\x01")
+	rnd.Read(rom[0x10+0x4000:])
+	cart, err := cartridge.Parse(rom)
+	if err != nil {
+		b.Fatal(err)
+	}
+	p := New(NewBus(cart))
+	for addr := uint16(0x2000); addr < 0x3F00; addr++ {
+		p.bus.Poke(addr, uint8(rnd.Intn(0x100)))
+	}
+	for addr := uint16(0x3F00); addr < 0x3F20; addr++ {
+		p.bus.Poke(addr, uint8(rnd.Intn(0x40)))
+	}
+	for i := 0; i < len(p.oam); i += 4 {
+		p.oam[i] = uint8(rnd.Intn(height - 8))
+		p.oam[i+1] = uint8(rnd.Intn(0x100))
+		p.oam[i+2] = uint8(rnd.Intn(0x100))
+		p.oam[i+3] = uint8(rnd.Intn(width - 8))
+	}
+	return p
+}
+
+// BenchmarkFrame renders frames into the RGBA buffer.
+func BenchmarkFrame(b *testing.B) {
+	p := newBenchPPU(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for !p.Step() {
+		}
+	}
+}
+
+// BenchmarkUpload copies a frame to an image a pixel at a time through
+// Set, as the window did before the RGBA buffer, and in one copy of the
+// buffer, as ReplacePixels does. It measures the CPU side only: on the
+// window every Set was also a draw call.
+func BenchmarkUpload(b *testing.B) {
+	p := newBenchPPU(b)
+	for !p.Step() {
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	b.Run("Set", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					img.Set(x, y, color.Color(p.Pixel(x, y)))
+				}
+			}
+		}
+	})
+	b.Run("ReplacePixels", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			copy(img.Pix, p.Pixels())
+		}
+	})
+}
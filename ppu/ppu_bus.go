@@ -1,5 +1,7 @@
 package ppu
 
+import "github.com/dqn/gones/cartridge"
+
 // https://qiita.com/bokuweb/items/1575337bef44ae82f4d3#%E3%83%A1%E3%83%A2%E3%83%AA%E3%83%9E%E3%83%83%E3%83%97-1
 
 // アドレス	       サイズ   用途
@@ -21,33 +23,110 @@ package ppu
 type vram [0x4000]uint8
 
 type PPUBus struct {
-	vram         *vram
-	characterROM []uint8
+	vram      *vram
+	cartridge *cartridge.Cartridge
+	// nametables is the board if it maps the nametables itself.
+	nametables cartridge.NametableBoard
+	// counter is the board if it counts the lines.
+	counter scanlineCounter
+	hook    AccessHook
+}
+
+type scanlineCounter interface {
+	Scanline(line int)
+}
+
+// AccessHook is called after every access through the bus.
+type AccessHook func(addr uint16, data uint8, write bool)
+
+func NewBus(c *cartridge.Cartridge) *PPUBus {
+	b := &PPUBus{vram: &vram{}, cartridge: c}
+	board := c.Board()
+	if n, ok := board.(cartridge.NametableBoard); ok {
+		b.nametables = n
+		n.SetCIRAM(b.vram[0x2000:0x2800])
+	}
+	b.counter, _ = board.(scanlineCounter)
+	return b
 }
 
-func NewBus(characterROM []uint8) *PPUBus {
-	return &PPUBus{&vram{}, characterROM}
+func (b *PPUBus) SetHook(hook AccessHook) {
+	b.hook = hook
 }
 
 func (b *PPUBus) Read(addr uint16) uint8 {
+	data := b.read(addr)
+	if b.hook != nil {
+		b.hook(addr, data, false)
+	}
+	return data
+}
+
+func (b *PPUBus) Write(addr uint16, data uint8) {
+	b.write(addr, data)
+	if b.hook != nil {
+		b.hook(addr, data, true)
+	}
+}
+
+// Peek returns what Read would without side effects or calling the hook.
+func (b *PPUBus) Peek(addr uint16) uint8 {
+	addr &= 0x3FFF
 	switch {
 	case addr < 0x2000:
-		return b.characterROM[addr]
-	case addr < 0x3F00:
-		return b.vram[addr]
-	case addr < 0x4000:
-		return b.vram[addr]
+		return b.cartridge.PeekCharacter(addr)
+	case addr < 0x3F00 && b.nametables != nil:
+		return b.nametables.PeekNametable(addr)
 	}
+	return b.read(addr)
+}
 
-	println("!!!", addr)
-	panic(1)
+// Poke writes without calling the hook.
+func (b *PPUBus) Poke(addr uint16, data uint8) {
+	b.write(addr, data)
 }
 
-func (b *PPUBus) Write(addr uint16, data uint8) {
-	// fmt.Printf("!!! %x 0x%x\n", addr, data)
+// The PPU has 14 address lines, $4000-$FFFF mirror $0000-$3FFF.
+func (b *PPUBus) read(addr uint16) uint8 {
+	addr &= 0x3FFF
+	switch {
+	case addr < 0x2000:
+		return b.cartridge.ReadCharacter(addr)
+	case addr < 0x3F00:
+		if b.nametables != nil {
+			return b.nametables.ReadNametable(addr)
+		}
+		return b.vram[b.nametable(addr)]
+	}
+	return b.vram[addr]
+}
+
+func (b *PPUBus) write(addr uint16, data uint8) {
+	addr &= 0x3FFF
 	switch {
 	case addr < 0x2000:
-	case addr < 0x4000:
+		b.cartridge.WriteCharacter(addr, data)
+	case addr < 0x3F00:
+		if b.nametables != nil {
+			b.nametables.WriteNametable(addr, data)
+			return
+		}
+		b.vram[b.nametable(addr)] = data
+	default:
 		b.vram[addr] = data
 	}
 }
+
+// nametable returns where a nametable address is in VRAM, in the page the
+// cartridge wires the nametable to.
+func (b *PPUBus) nametable(addr uint16) uint16 {
+	page := b.cartridge.Board().Mirroring().Page(addr >> 10 & 0b11)
+	return 0x2000 | page<<10 | addr&0x03FF
+}
+
+// scanline tells the cartridge that a line starts.
+func (b *PPUBus) scanline(line uint) {
+	if b.counter != nil {
+		b.counter.Scanline(int(line))
+	}
+}
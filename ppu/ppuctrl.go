@@ -50,3 +50,7 @@ func (p *ppuctrl) GetNameTableBaseAddress() uint16 {
 		panic("system error")
 	}
 }
+
+func (p *ppuctrl) NMIEnabled() bool {
+	return *p&0b10000000 != 0
+}
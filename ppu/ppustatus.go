@@ -19,3 +19,7 @@ func (p *ppustatus) SetVBlank(b bool) {
 		*p &= 0b01111111
 	}
 }
+
+func (p *ppustatus) VBlank() bool {
+	return *p&0b10000000 != 0
+}
@@ -0,0 +1,55 @@
+package ppu
+
+// State is a copy of the PPU registers and memory for savestates. Screen
+// holds the color index of each pixel, 0xFF where nothing was drawn.
+type State struct {
+	Cycle, Line      uint
+	Ctrl, Mask       uint8
+	Status           uint8
+	OAMAddr          uint8
+	ScrollX, ScrollY uint8
+	WriteToggle      bool
+	Addr             uint16
+	OAM              [0x0100]uint8
+	VRAM             [0x4000]uint8
+	Screen           [height][width]uint8
+}
+
+func (p *PPU) State() *State {
+	s := &State{
+		Cycle:       p.cycle,
+		Line:        p.line,
+		Ctrl:        uint8(p.ppuctrl),
+		Mask:        p.ppumask,
+		Status:      p.ppustatus.Uint8(),
+		OAMAddr:     p.oamaddr,
+		ScrollX:     p.scrollX,
+		ScrollY:     p.scrollY,
+		WriteToggle: p.writeToggle,
+		Addr:        p.ppuaddr,
+		OAM:         *p.oam,
+		VRAM:        *p.bus.vram,
+	}
+	for y := range s.Screen {
+		copy(s.Screen[y][:], p.screen[y*width:])
+	}
+	return s
+}
+
+func (p *PPU) SetState(s *State) {
+	p.cycle, p.line = s.Cycle, s.Line
+	p.ppuctrl = ppuctrl(s.Ctrl)
+	p.ppumask = s.Mask
+	p.ppustatus = ppustatus(s.Status)
+	p.oamaddr = s.OAMAddr
+	p.scrollX, p.scrollY = s.ScrollX, s.ScrollY
+	p.writeToggle = s.WriteToggle
+	p.ppuaddr = s.Addr
+	*p.oam = s.OAM
+	*p.bus.vram = s.VRAM
+	for y := range s.Screen {
+		for x, i := range s.Screen[y] {
+			p.setPixel(y*width+x, i)
+		}
+	}
+}
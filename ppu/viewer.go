@@ -0,0 +1,121 @@
+package ppu
+
+import (
+	"image"
+	"image/color"
+)
+
+// The views below peek the PPU memory, so they have no side effects.
+
+var viewportColor = color.RGBA{0xFF, 0x00, 0x00, 0xFF}
+
+func (p *PPU) viewColor(addr uint16) color.RGBA {
+	return p.colors[p.bus.Peek(addr)&0x3F]
+}
+
+func (p *PPU) drawTile(img *image.RGBA, x0, y0 int, patternAddr uint16, paletteAddr uint16, flipH, flipV bool) {
+	for y := 0; y < 8; y++ {
+		lo := p.bus.Peek(patternAddr + uint16(y))
+		hi := p.bus.Peek(patternAddr + uint16(y) + 8)
+		for x := 0; x < 8; x++ {
+			v := (lo>>(7-x))&0b1 | ((hi>>(7-x))&0b1)<<1
+			dx, dy := x, y
+			if flipH {
+				dx = 7 - x
+			}
+			if flipV {
+				dy = 7 - y
+			}
+			img.SetRGBA(x0+dx, y0+dy, p.viewColor(paletteAddr+uint16(v)))
+		}
+	}
+}
+
+// PatternTables renders both pattern tables side by side (256x128) with
+// one of the 8 palettes (0-3 background, 4-7 sprites).
+func (p *PPU) PatternTables(palette int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 128))
+	paletteAddr := 0x3F00 + uint16(palette&0b111)*4
+	for table := 0; table < 2; table++ {
+		for i := 0; i < 256; i++ {
+			addr := uint16(table)*0x1000 + uint16(i)*0x10
+			p.drawTile(img, table*128+(i%16)*8, (i/16)*8, addr, paletteAddr, false, false)
+		}
+	}
+	return img
+}
+
+// NameTables renders the four nametables (512x480) with the scroll
+// viewport outlined.
+func (p *PPU) NameTables() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width*2, height*2))
+	patternBase := p.ppuctrl.GetBGPatternBaseAddress()
+	for table := 0; table < 4; table++ {
+		base := 0x2000 + uint16(table)*0x0400
+		ox, oy := (table%2)*width, (table/2)*height
+		for ty := 0; ty < height/8; ty++ {
+			for tx := 0; tx < width/8; tx++ {
+				name := p.bus.Peek(base + uint16(ty*32+tx))
+				attr := p.bus.Peek(base + 0x03C0 + uint16((ty/4)*8+tx/4))
+				shift := uint((ty%4)/2*4 + (tx%4)/2*2)
+				paletteAddr := 0x3F00 + uint16((attr>>shift)&0b11)*4
+				p.drawTile(img, ox+tx*8, oy+ty*8, patternBase+uint16(name)*0x10, paletteAddr, false, false)
+			}
+		}
+	}
+
+	base := p.ppuctrl.GetNameTableBaseAddress() - 0x2000
+	vx := int(base/0x0400%2)*width + int(p.scrollX)
+	vy := int(base/0x0800)*height + int(p.scrollY)
+	for i := 0; i < width; i++ {
+		img.SetRGBA((vx+i)%(width*2), vy%(height*2), viewportColor)
+		img.SetRGBA((vx+i)%(width*2), (vy+height-1)%(height*2), viewportColor)
+	}
+	for i := 0; i < height; i++ {
+		img.SetRGBA(vx%(width*2), (vy+i)%(height*2), viewportColor)
+		img.SetRGBA((vx+width-1)%(width*2), (vy+i)%(height*2), viewportColor)
+	}
+	return img
+}
+
+// Sprites renders the 64 OAM entries in an 8x8 grid of 16x24 cells (128x192),
+// large enough for 8x16 sprites.
+func (p *PPU) Sprites() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 128, 192))
+	tall := p.ppuctrl&0b00100000 != 0
+	for i := 0; i < 64; i++ {
+		tile, attr := p.oam[i*4+1], p.oam[i*4+2]
+		paletteAddr := 0x3F10 + uint16(attr&0b11)*4
+		flipH, flipV := attr&0b01000000 != 0, attr&0b10000000 != 0
+		x, y := (i%8)*16+4, (i/8)*24+4
+		if !tall {
+			p.drawTile(img, x, y, p.ppuctrl.GetSpritePatternBaseAddress()+uint16(tile)*0x10, paletteAddr, flipH, flipV)
+			continue
+		}
+		// 8x16 sprites take the pattern table from bit 0 of the tile index
+		addr := uint16(tile&0b1)*0x1000 + uint16(tile&0b11111110)*0x10
+		top, bottom := addr, addr+0x10
+		if flipV {
+			top, bottom = bottom, top
+		}
+		p.drawTile(img, x, y, top, paletteAddr, flipH, flipV)
+		p.drawTile(img, x, y+8, bottom, paletteAddr, flipH, flipV)
+	}
+	return img
+}
+
+// Palettes renders the 32 palette entries as 16x16 swatches (256x32),
+// background palettes on the first row and sprite palettes on the second.
+func (p *PPU) Palettes() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 32))
+	for i := 0; i < 32; i++ {
+		c := p.viewColor(0x3F00 + uint16(i))
+		x0, y0 := (i%16)*16, (i/16)*16
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				img.SetRGBA(x0+x, y0+y, c)
+			}
+		}
+	}
+	return img
+}
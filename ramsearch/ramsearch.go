@@ -0,0 +1,137 @@
+package ramsearch
+
+import (
+	"fmt"
+
+	"github.com/dqn/gones/cheat"
+	"github.com/dqn/gones/ram"
+)
+
+// Op compares the value of a candidate with an operand.
+type Op int
+
+const (
+	Equal Op = iota
+	NotEqual
+	Greater
+	Less
+)
+
+var opNames = map[string]Op{
+	"==": Equal, "eq": Equal,
+	"!=": NotEqual, "ne": NotEqual,
+	">": Greater, "gt": Greater,
+	"<": Less, "lt": Less,
+}
+
+func ParseOp(s string) (Op, error) {
+	op, ok := opNames[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown comparison: %q", s)
+	}
+	return op, nil
+}
+
+func (op Op) match(a, b int) bool {
+	switch op {
+	case Equal:
+		return a == b
+	case NotEqual:
+		return a != b
+	case Greater:
+		return a > b
+	case Less:
+		return a < b
+	}
+	return false
+}
+
+// Result is a candidate address with its value in the last two snapshots.
+type Result struct {
+	Address  uint16
+	Value    int
+	Previous int
+}
+
+// Search narrows down the RAM addresses holding a game variable. Values
+// are 8 or 16 bits (little endian) wide and signed or unsigned.
+type Search struct {
+	size       int
+	signed     bool
+	candidates []Result
+}
+
+// New starts a search with every address of the snapshot as a candidate.
+func New(snapshot *ram.RAM, bits int, signed bool) (*Search, error) {
+	if bits != 8 && bits != 16 {
+		return nil, fmt.Errorf("unsupported value size: %d bits", bits)
+	}
+	s := &Search{size: bits / 8, signed: signed}
+	for addr := 0; addr+s.size <= len(snapshot); addr++ {
+		v := s.value(snapshot, uint16(addr))
+		s.candidates = append(s.candidates, Result{uint16(addr), v, v})
+	}
+	return s, nil
+}
+
+func (s *Search) value(r *ram.RAM, addr uint16) int {
+	if s.size == 1 {
+		if s.signed {
+			return int(int8(r[addr]))
+		}
+		return int(r[addr])
+	}
+	v := uint16(r[addr]) | uint16(r[addr+1])<<8
+	if s.signed {
+		return int(int16(v))
+	}
+	return int(v)
+}
+
+func (s *Search) filter(r *ram.RAM, keep func(value, previous int) bool) {
+	kept := s.candidates[:0]
+	for _, c := range s.candidates {
+		v := s.value(r, c.Address)
+		if keep(v, c.Value) {
+			kept = append(kept, Result{c.Address, v, c.Value})
+		}
+	}
+	s.candidates = kept
+}
+
+// Compare keeps the candidates whose current value compares to their
+// value in the previous snapshot, e.g. Less for "decreased".
+func (s *Search) Compare(r *ram.RAM, op Op) {
+	s.filter(r, func(v, prev int) bool { return op.match(v, prev) })
+}
+
+// CompareValue keeps the candidates whose current value compares to n.
+func (s *Search) CompareValue(r *ram.RAM, op Op, n int) {
+	s.filter(r, func(v, prev int) bool { return op.match(v, n) })
+}
+
+// ChangedBy keeps the candidates that changed by exactly n since the
+// previous snapshot.
+func (s *Search) ChangedBy(r *ram.RAM, n int) {
+	s.filter(r, func(v, prev int) bool { return v-prev == n })
+}
+
+func (s *Search) Results() []Result {
+	return s.candidates
+}
+
+// Cheats returns RAM-freeze cheats holding addr at value, one per byte.
+func (s *Search) Cheats(addr uint16, value int, name string) []*cheat.Cheat {
+	cheats := make([]*cheat.Cheat, s.size)
+	for i := range cheats {
+		a, v := addr+uint16(i), uint8(value>>(8*i))
+		cheats[i] = &cheat.Cheat{
+			Code:    fmt.Sprintf("%04X:%02X", a, v),
+			Name:    name,
+			Address: a,
+			Value:   v,
+			Enabled: true,
+		}
+	}
+	return cheats
+}
@@ -0,0 +1,110 @@
+package region
+
+import (
+	"fmt"
+
+	"github.com/dqn/gones/cartridge"
+)
+
+// https://wiki.nesdev.com/w/index.php/Cycle_reference_chart
+// https://wiki.nesdev.com/w/index.php/APU_Noise
+// https://wiki.nesdev.com/w/index.php/APU_DMC
+
+// Region holds the timing differences between consoles.
+type Region struct {
+	Name string
+	// MasterClock is in Hz. The CPU and the PPU run at the master clock
+	// divided by CPUDivider and PPUDivider.
+	MasterClock float64
+	CPUDivider  uint
+	PPUDivider  uint
+	FrameRate   float64
+	// PostRenderLines are idle lines between the picture and vblank.
+	PostRenderLines uint
+	VBlankLines     uint
+
+	// APU timer periods in CPU cycles.
+	NoisePeriods [16]uint16
+	DMCRates     [16]uint16
+	// FrameCounterPeriod is the number of CPU cycles between frame counter steps.
+	FrameCounterPeriod uint16
+}
+
+var ntscNoisePeriods = [16]uint16{4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068}
+var ntscDMCRates = [16]uint16{428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54}
+
+var (
+	NTSC = &Region{
+		Name:               "ntsc",
+		MasterClock:        21477272,
+		CPUDivider:         12,
+		PPUDivider:         4,
+		FrameRate:          60.0988,
+		PostRenderLines:    1,
+		VBlankLines:        20,
+		NoisePeriods:       ntscNoisePeriods,
+		DMCRates:           ntscDMCRates,
+		FrameCounterPeriod: 7457,
+	}
+	PAL = &Region{
+		Name:               "pal",
+		MasterClock:        26601712,
+		CPUDivider:         16,
+		PPUDivider:         5,
+		FrameRate:          50.0070,
+		PostRenderLines:    1,
+		VBlankLines:        70,
+		NoisePeriods:       [16]uint16{4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778},
+		DMCRates:           [16]uint16{398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50},
+		FrameCounterPeriod: 8313,
+	}
+	// Dendy is a Famicom clone with PAL frame timing, an NTSC clock ratio
+	// and the NTSC APU.
+	Dendy = &Region{
+		Name:               "dendy",
+		MasterClock:        26601712,
+		CPUDivider:         15,
+		PPUDivider:         5,
+		FrameRate:          50.0070,
+		PostRenderLines:    51,
+		VBlankLines:        20,
+		NoisePeriods:       ntscNoisePeriods,
+		DMCRates:           ntscDMCRates,
+		FrameCounterPeriod: 7457,
+	}
+)
+
+// CPUClock returns the CPU clock in Hz.
+func (r *Region) CPUClock() float64 {
+	return r.MasterClock / float64(r.CPUDivider)
+}
+
+// Regions are the names accepted by Parse besides "auto".
+var Regions = []string{"ntsc", "pal", "dendy"}
+
+// Parse returns the region by name.
+func Parse(name string) (*Region, error) {
+	for _, r := range []*Region{NTSC, PAL, Dendy} {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported region: %s", name)
+}
+
+// Detect returns the region from the ROM header. ROMs running on both
+// consoles get NTSC.
+func Detect(c *cartridge.Cartridge) *Region {
+	return ForTiming(c.Timing)
+}
+
+// ForTiming returns the region of the timing. Multi-region timing gets NTSC.
+func ForTiming(t cartridge.Timing) *Region {
+	switch t {
+	case cartridge.TimingPAL:
+		return PAL
+	case cartridge.TimingDendy:
+		return Dendy
+	}
+	return NTSC
+}
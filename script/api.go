@@ -0,0 +1,207 @@
+package script
+
+import (
+	"strings"
+
+	"github.com/dqn/gones/controller"
+	"github.com/dqn/gones/nes"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Memory is peeked and poked, so scripts do not disturb the emulation.
+
+func (s *Script) readByte(L *lua.LState) int {
+	L.Push(lua.LNumber(s.nes.CPU().Bus().Peek(uint16(L.CheckInt(1)))))
+	return 1
+}
+
+func (s *Script) readByteSigned(L *lua.LState) int {
+	L.Push(lua.LNumber(int8(s.nes.CPU().Bus().Peek(uint16(L.CheckInt(1))))))
+	return 1
+}
+
+func (s *Script) readWord(L *lua.LState) int {
+	bus := s.nes.CPU().Bus()
+	addr := uint16(L.CheckInt(1))
+	L.Push(lua.LNumber(uint16(bus.Peek(addr)) | uint16(bus.Peek(addr+1))<<8))
+	return 1
+}
+
+func (s *Script) writeByte(L *lua.LState) int {
+	s.nes.CPU().Bus().Poke(uint16(L.CheckInt(1)), uint8(L.CheckInt(2)))
+	return 0
+}
+
+func (s *Script) getRegister(L *lua.LState) int {
+	r := s.nes.CPU().Registers()
+	var v int
+	switch strings.ToLower(L.CheckString(1)) {
+	case "a":
+		v = int(r.A)
+	case "x":
+		v = int(r.X)
+	case "y":
+		v = int(r.Y)
+	case "s":
+		v = int(uint8(r.SP))
+	case "p":
+		v = int(r.P.Uint8())
+	case "pc":
+		v = int(r.PC)
+	default:
+		L.ArgError(1, "unknown register")
+	}
+	L.Push(lua.LNumber(v))
+	return 1
+}
+
+func (s *Script) setRegister(L *lua.LState) int {
+	r := s.nes.CPU().Registers()
+	v := L.CheckInt(2)
+	switch strings.ToLower(L.CheckString(1)) {
+	case "a":
+		r.A = uint8(v)
+	case "x":
+		r.X = uint8(v)
+	case "y":
+		r.Y = uint8(v)
+	case "s":
+		r.SP = 0x0100 | uint16(uint8(v))
+	case "p":
+		r.P.SetByUint8(uint8(v))
+	case "pc":
+		r.PC = uint16(v)
+	default:
+		L.ArgError(1, "unknown register")
+	}
+	return 0
+}
+
+// registerExecute calls a function before the instructions at [addr, addr+size)
+// are executed: memory.registerexecute(addr, [size,] fn). Without an address
+// the function is called before every instruction. A nil function removes
+// the callbacks.
+func (s *Script) registerExecute(L *lua.LState) int {
+	if L.GetTop() <= 1 {
+		s.every = optFunctions(L, 1)
+		s.install()
+		return 0
+	}
+	addr, size, n := L.CheckInt(1), 1, 2
+	if L.GetTop() >= 3 {
+		size, n = L.CheckInt(2), 3
+	}
+	fn := L.OptFunction(n, nil)
+	for a := addr; a < addr+size; a++ {
+		if fn == nil {
+			delete(s.execute, uint16(a))
+		} else {
+			s.execute[uint16(a)] = append(s.execute[uint16(a)], fn)
+		}
+	}
+	s.install()
+	return 0
+}
+
+var joypadButtons = map[string]controller.Button{
+	"A":      controller.ButtonA,
+	"B":      controller.ButtonB,
+	"select": controller.ButtonSelect,
+	"start":  controller.ButtonStart,
+	"up":     controller.ButtonUp,
+	"down":   controller.ButtonDown,
+	"left":   controller.ButtonLeft,
+	"right":  controller.ButtonRight,
+}
+
+func checkPlayer(L *lua.LState) int {
+	p := L.CheckInt(1)
+	if p < 1 || p > 4 {
+		L.ArgError(1, "player must be 1-4")
+	}
+	return p - 1
+}
+
+// joypadGet returns the buttons of a player (1-4) as a table like {A=true, up=false, ...}.
+func (s *Script) joypadGet(L *lua.LState) int {
+	c := s.nes.Controller(checkPlayer(L))
+	t := L.NewTable()
+	for name, b := range joypadButtons {
+		t.RawSetString(name, lua.LBool(c.IsPressed(b)))
+	}
+	L.Push(t)
+	return 1
+}
+
+// joypadSet presses (true) or releases (false) buttons of a player on the
+// next frame. Buttons missing from the table follow the input.
+func (s *Script) joypadSet(L *lua.LState) int {
+	p := checkPlayer(L)
+	L.CheckTable(2).ForEach(func(k, v lua.LValue) {
+		b, ok := joypadButtons[k.String()]
+		if !ok || v == lua.LNil {
+			return
+		}
+		if lua.LVAsBool(v) {
+			s.press[p] |= 1 << b
+		} else {
+			s.release[p] |= 1 << b
+		}
+	})
+	return 0
+}
+
+// A savestate object keeps the state in memory, or in a file when
+// created with a path: savestate.create([path]).
+type savestate struct {
+	path  string
+	state *nes.State
+}
+
+func (s *Script) savestateCreate(L *lua.LState) int {
+	ud := L.NewUserData()
+	ud.Value = &savestate{path: L.OptString(1, "")}
+	L.Push(ud)
+	return 1
+}
+
+func checkSavestate(L *lua.LState) *savestate {
+	st, ok := L.CheckUserData(1).Value.(*savestate)
+	if !ok {
+		L.ArgError(1, "savestate expected")
+	}
+	return st
+}
+
+func (s *Script) savestateSave(L *lua.LState) int {
+	st := checkSavestate(L)
+	if st.path == "" {
+		state, err := s.nes.State()
+		if err != nil {
+			L.RaiseError("%s", err)
+		}
+		st.state = state
+		return 0
+	}
+	if err := s.nes.SaveState(st.path); err != nil {
+		L.RaiseError("%s", err)
+	}
+	return 0
+}
+
+func (s *Script) savestateLoad(L *lua.LState) int {
+	st := checkSavestate(L)
+	if st.path == "" {
+		if st.state == nil {
+			L.RaiseError("savestate has not been saved")
+		}
+		if err := s.nes.SetState(st.state); err != nil {
+			L.RaiseError("%s", err)
+		}
+		return 0
+	}
+	if err := s.nes.LoadState(st.path); err != nil {
+		L.RaiseError("%s", err)
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package script
+
+import (
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Drawings last for the frame they are made in.
+type drawOp func(screen *ebiten.Image)
+
+var colorNames = map[string]color.RGBA{
+	"white":  {0xFF, 0xFF, 0xFF, 0xFF},
+	"black":  {0x00, 0x00, 0x00, 0xFF},
+	"red":    {0xFF, 0x00, 0x00, 0xFF},
+	"green":  {0x00, 0xFF, 0x00, 0xFF},
+	"blue":   {0x00, 0x00, 0xFF, 0xFF},
+	"yellow": {0xFF, 0xFF, 0x00, 0xFF},
+	"orange": {0xFF, 0x80, 0x00, 0xFF},
+	"purple": {0x80, 0x00, 0x80, 0xFF},
+	"gray":   {0x80, 0x80, 0x80, 0xFF},
+	"clear":  {},
+}
+
+// optColor reads a color as a name, "#RRGGBB", "#RRGGBBAA" or a number 0xRRGGBBAA.
+func optColor(L *lua.LState, n int, d color.RGBA) color.RGBA {
+	v := L.Get(n)
+	switch v := v.(type) {
+	case lua.LNumber:
+		c := uint32(v)
+		return color.RGBA{uint8(c >> 24), uint8(c >> 16), uint8(c >> 8), uint8(c)}
+	case lua.LString:
+		s := strings.ToLower(string(v))
+		if c, ok := colorNames[s]; ok {
+			return c
+		}
+		if strings.HasPrefix(s, "#") && (len(s) == 7 || len(s) == 9) {
+			if len(s) == 7 {
+				s += "ff"
+			}
+			if c, err := strconv.ParseUint(s[1:], 16, 32); err == nil {
+				return color.RGBA{uint8(c >> 24), uint8(c >> 16), uint8(c >> 8), uint8(c)}
+			}
+		}
+		L.ArgError(n, "invalid color")
+	case *lua.LNilType:
+		return d
+	default:
+		L.ArgError(n, "invalid color")
+	}
+	return d
+}
+
+func (s *Script) draw(op drawOp) {
+	s.gui = append(s.gui, op)
+}
+
+func (s *Script) drawGUI(screen *ebiten.Image) {
+	for _, op := range s.gui {
+		op(screen)
+	}
+}
+
+// guiText draws text with the debug font: gui.text(x, y, str).
+func (s *Script) guiText(L *lua.LState) int {
+	x, y, str := L.CheckInt(1), L.CheckInt(2), L.ToStringMeta(L.CheckAny(3)).String()
+	s.draw(func(screen *ebiten.Image) {
+		ebitenutil.DebugPrintAt(screen, str, x, y)
+	})
+	return 0
+}
+
+// guiBox draws a rectangle: gui.box(x1, y1, x2, y2, [fill, [outline]]).
+func (s *Script) guiBox(L *lua.LState) int {
+	x1, y1, x2, y2 := float64(L.CheckInt(1)), float64(L.CheckInt(2)), float64(L.CheckInt(3)), float64(L.CheckInt(4))
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	fill := optColor(L, 5, color.RGBA{0xFF, 0xFF, 0xFF, 0x3F})
+	outline := optColor(L, 6, colorNames["white"])
+	s.draw(func(screen *ebiten.Image) {
+		w, h := x2-x1+1, y2-y1+1
+		ebitenutil.DrawRect(screen, x1, y1, w, h, fill)
+		ebitenutil.DrawRect(screen, x1, y1, w, 1, outline)
+		ebitenutil.DrawRect(screen, x1, y2, w, 1, outline)
+		ebitenutil.DrawRect(screen, x1, y1, 1, h, outline)
+		ebitenutil.DrawRect(screen, x2, y1, 1, h, outline)
+	})
+	return 0
+}
+
+// guiLine draws a line: gui.line(x1, y1, x2, y2, [color]).
+func (s *Script) guiLine(L *lua.LState) int {
+	x1, y1, x2, y2 := float64(L.CheckInt(1)), float64(L.CheckInt(2)), float64(L.CheckInt(3)), float64(L.CheckInt(4))
+	c := optColor(L, 5, colorNames["white"])
+	s.draw(func(screen *ebiten.Image) {
+		ebitenutil.DrawLine(screen, x1, y1, x2, y2, c)
+	})
+	return 0
+}
+
+// guiPixel sets a pixel: gui.pixel(x, y, [color]).
+func (s *Script) guiPixel(L *lua.LState) int {
+	x, y := L.CheckInt(1), L.CheckInt(2)
+	c := optColor(L, 3, colorNames["white"])
+	s.draw(func(screen *ebiten.Image) {
+		screen.Set(x, y, c)
+	})
+	return 0
+}
@@ -0,0 +1,226 @@
+package script
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dqn/gones/nes"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// http://fceux.com/web/help/LuaFunctionsList.html
+
+// Script runs a Lua script against an emulator with an FCEUX-like API.
+// The main chunk runs as a coroutine that is resumed after every frame
+// from emu.frameadvance, so scripts can be written as a loop:
+//
+//	while true do
+//	  gui.text(8, 8, "frame " .. emu.framecount())
+//	  emu.frameadvance()
+//	end
+type Script struct {
+	nes *nes.NES
+	ls  *lua.LState
+	out io.Writer
+
+	main     *lua.LState
+	mainFn   *lua.LFunction
+	finished bool
+
+	before  []*lua.LFunction
+	after   []*lua.LFunction
+	execute map[uint16][]*lua.LFunction
+	// every is called before each instruction
+	every []*lua.LFunction
+
+	// joypad.set overrides for the next frame
+	press, release [4]uint8
+	gui            []drawOp
+}
+
+// New creates a script environment for n and installs its hooks. print
+// and emu.print write to os.Stdout.
+func New(n *nes.NES) *Script {
+	s := &Script{
+		nes:     n,
+		ls:      lua.NewState(),
+		out:     os.Stdout,
+		execute: map[uint16][]*lua.LFunction{},
+	}
+	s.ls.SetGlobal("print", s.ls.NewFunction(s.print))
+	s.register("emu", map[string]lua.LGFunction{
+		"frameadvance":   s.frameAdvance,
+		"framecount":     s.frameCount,
+		"registerbefore": s.registerBefore,
+		"registerafter":  s.registerAfter,
+		"softreset":      s.softReset,
+		"print":          s.print,
+	})
+	s.register("memory", map[string]lua.LGFunction{
+		"readbyte":        s.readByte,
+		"readbytesigned":  s.readByteSigned,
+		"readword":        s.readWord,
+		"writebyte":       s.writeByte,
+		"getregister":     s.getRegister,
+		"setregister":     s.setRegister,
+		"registerexecute": s.registerExecute,
+		"registerexec":    s.registerExecute,
+	})
+	s.register("joypad", map[string]lua.LGFunction{
+		"get":  s.joypadGet,
+		"read": s.joypadGet,
+		"set":  s.joypadSet,
+	})
+	s.register("savestate", map[string]lua.LGFunction{
+		"create": s.savestateCreate,
+		"save":   s.savestateSave,
+		"load":   s.savestateLoad,
+	})
+	s.register("gui", map[string]lua.LGFunction{
+		"text":     s.guiText,
+		"box":      s.guiBox,
+		"drawbox":  s.guiBox,
+		"line":     s.guiLine,
+		"drawline": s.guiLine,
+		"pixel":    s.guiPixel,
+	})
+	s.install()
+	return s
+}
+
+func (s *Script) register(name string, funcs map[string]lua.LGFunction) {
+	t := s.ls.NewTable()
+	s.ls.SetFuncs(t, funcs)
+	s.ls.SetGlobal(name, t)
+}
+
+// install sets the emulator hooks, leaving out the per-instruction hook
+// while no script needs it.
+func (s *Script) install() {
+	h := nes.Hooks{
+		BeforeFrame: s.beforeFrame,
+		AfterFrame:  s.afterFrame,
+		Overlay:     s.drawGUI,
+	}
+	if len(s.every) > 0 || len(s.execute) > 0 {
+		h.Instruction = s.instruction
+	}
+	s.nes.SetHooks(h)
+}
+
+// Load runs the main chunk of the script until it first calls
+// emu.frameadvance or returns.
+func (s *Script) Load(path string) error {
+	fn, err := s.ls.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	s.main, _ = s.ls.NewThread()
+	s.mainFn = fn
+	return s.resume()
+}
+
+func (s *Script) resume() error {
+	if s.main == nil || s.finished {
+		return nil
+	}
+	state, err, _ := s.ls.Resume(s.main, s.mainFn)
+	if err != nil {
+		return err
+	}
+	s.finished = state == lua.ResumeOK
+	return nil
+}
+
+func (s *Script) Close() {
+	s.ls.Close()
+}
+
+func (s *Script) call(fn *lua.LFunction, args ...lua.LValue) error {
+	return s.ls.CallByParam(lua.P{Fn: fn, Protect: true}, args...)
+}
+
+func (s *Script) beforeFrame() error {
+	s.gui = s.gui[:0]
+	for _, fn := range s.before {
+		if err := s.call(fn); err != nil {
+			return err
+		}
+	}
+	for i := range s.press {
+		c := s.nes.Controller(i)
+		c.SetButtons(c.Buttons()&^s.release[i] | s.press[i])
+		s.press[i], s.release[i] = 0, 0
+	}
+	return nil
+}
+
+func (s *Script) afterFrame() error {
+	for _, fn := range s.after {
+		if err := s.call(fn); err != nil {
+			return err
+		}
+	}
+	return s.resume()
+}
+
+func (s *Script) instruction(pc uint16) error {
+	for _, fn := range s.every {
+		if err := s.call(fn, lua.LNumber(pc)); err != nil {
+			return err
+		}
+	}
+	for _, fn := range s.execute[pc] {
+		if err := s.call(fn, lua.LNumber(pc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Script) print(L *lua.LState) int {
+	for i := 1; i <= L.GetTop(); i++ {
+		if i > 1 {
+			fmt.Fprint(s.out, "\t")
+		}
+		fmt.Fprint(s.out, L.ToStringMeta(L.Get(i)).String())
+	}
+	fmt.Fprintln(s.out)
+	return 0
+}
+
+func (s *Script) frameAdvance(L *lua.LState) int {
+	if L != s.main {
+		L.RaiseError("emu.frameadvance can only be called from the main chunk")
+	}
+	return L.Yield()
+}
+
+func (s *Script) frameCount(L *lua.LState) int {
+	L.Push(lua.LNumber(s.nes.Frame()))
+	return 1
+}
+
+// registerBefore and registerAfter replace the frame callbacks; nil removes them.
+func (s *Script) registerBefore(L *lua.LState) int {
+	s.before = optFunctions(L, 1)
+	return 0
+}
+
+func (s *Script) registerAfter(L *lua.LState) int {
+	s.after = optFunctions(L, 1)
+	return 0
+}
+
+func optFunctions(L *lua.LState, n int) []*lua.LFunction {
+	if fn := L.OptFunction(n, nil); fn != nil {
+		return []*lua.LFunction{fn}
+	}
+	return nil
+}
+
+func (s *Script) softReset(L *lua.LState) int {
+	s.nes.CPU().Reset()
+	return 0
+}
@@ -0,0 +1,92 @@
+package wav
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+)
+
+// http://soundfile.sapp.org/doc/WaveFormat/
+const headerSize = 44
+
+// Writer writes 16-bit mono PCM to a WAV file. The sizes in the header are
+// filled in by Close.
+type Writer struct {
+	f    *os.File
+	w    *bufio.Writer
+	size uint32
+}
+
+func Create(path string, sampleRate int) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{f: f, w: bufio.NewWriter(f)}
+	if err := w.writeHeader(uint32(sampleRate)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) writeHeader(sampleRate uint32) error {
+	const (
+		channels      = 1
+		bitsPerSample = 16
+		blockAlign    = channels * bitsPerSample / 8
+	)
+	h := make([]byte, headerSize)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], headerSize-8+w.size)
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(h[22:], channels)
+	binary.LittleEndian.PutUint32(h[24:], sampleRate)
+	binary.LittleEndian.PutUint32(h[28:], sampleRate*blockAlign)
+	binary.LittleEndian.PutUint16(h[32:], blockAlign)
+	binary.LittleEndian.PutUint16(h[34:], bitsPerSample)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], w.size)
+	_, err := w.w.Write(h)
+	return err
+}
+
+// Write appends samples from -1 to 1. Values out of range are clipped.
+func (w *Writer) Write(samples []float32) error {
+	var b [2]byte
+	for _, s := range samples {
+		if s > 1 {
+			s = 1
+		} else if s < -1 {
+			s = -1
+		}
+		binary.LittleEndian.PutUint16(b[:], uint16(int16(s*0x7FFF)))
+		if _, err := w.w.Write(b[:]); err != nil {
+			return err
+		}
+	}
+	w.size += uint32(len(samples) * 2)
+	return nil
+}
+
+// Close fills in the sizes and closes the file.
+func (w *Writer) Close() error {
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], headerSize-8+w.size)
+	if _, err := w.f.WriteAt(b[:], 4); err != nil {
+		w.f.Close()
+		return err
+	}
+	binary.LittleEndian.PutUint32(b[:], w.size)
+	if _, err := w.f.WriteAt(b[:], 40); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}